@@ -0,0 +1,101 @@
+// Package analyzer provides copyfighter as an analysis.Analyzer, for use with
+// go vet -vettool, unitchecker, multichecker, and other drivers.
+package analyzer
+
+import (
+	"fmt"
+	"go/types"
+
+	"github.com/lalaladema/copyfighter"
+	"golang.org/x/tools/go/analysis"
+)
+
+// doc is the documentation of every analyzer made by this package.
+const doc = "report large structs that are passed or copied by value\n\nValues wider than -max bytes, as sized for the target architecture, are reported where receivers, parameters, results, selects, range loops, struct literals, and interface conversions copy them."
+
+// Analyzer reports funcs that pass large structs by value and the other
+// copies of wide values found by copyfighter's checks. It's configured by
+// its flags.
+var Analyzer = &analysis.Analyzer{
+	Name: "copyfighter",
+	Doc:  doc,
+	URL:  "https://github.com/lalaladema/copyfighter",
+	Run:  flagSettings.run,
+}
+
+// Settings configure an analyzer. Their JSON names are those of the
+// analyzer's flags.
+type Settings struct {
+	// Max is the size in bytes values must exceed to be reported.
+	Max          int64 `json:"max"`
+	Fields       bool  `json:"fields"`
+	Containers   bool  `json:"containers"`
+	Assignments  bool  `json:"assignments"`
+	DynamicTypes bool  `json:"dynamic-types"`
+}
+
+// DefaultSettings returns the settings of Analyzer when no flags are given.
+func DefaultSettings() Settings {
+	return Settings{Max: 16}
+}
+
+// New returns an analyzer like Analyzer that is configured by s instead of
+// flags.
+func New(s Settings) *analysis.Analyzer {
+	return &analysis.Analyzer{
+		Name: Analyzer.Name,
+		Doc:  Analyzer.Doc,
+		URL:  Analyzer.URL,
+		Run:  s.run,
+	}
+}
+
+// flagSettings are the settings Analyzer's flags set.
+var flagSettings = &Settings{}
+
+func init() {
+	def := DefaultSettings()
+	Analyzer.Flags.Int64Var(&flagSettings.Max, "max", def.Max, "maximum size in bytes a struct can be before by-value uses are reported")
+	Analyzer.Flags.BoolVar(&flagSettings.Fields, "fields", def.Fields, "report struct fields that hold a wide struct by value")
+	Analyzer.Flags.BoolVar(&flagSettings.Containers, "containers", def.Containers, "report slice and map types of wide elements in type and variable declarations and composite literals")
+	Analyzer.Flags.BoolVar(&flagSettings.Assignments, "assignments", def.Assignments, "report assignments and variable declarations in func bodies that copy an existing wide value")
+	Analyzer.Flags.BoolVar(&flagSettings.DynamicTypes, "dynamic-types", def.DynamicTypes, "report interface variables that may hold a boxed wide value where they are stored in containers or handed to goroutines")
+}
+
+func (s *Settings) run(pass *analysis.Pass) (any, error) {
+	sizes := pass.TypesSizes
+	if sizes == nil {
+		sizes = types.SizesFor("gc", "amd64")
+	}
+	for _, f := range copyfighter.FindInPackage(pass.Fset, pass.Files, pass.TypesInfo, sizes, s.Max) {
+		if f.Check == "field" && !s.Fields || f.Check == "container" && !s.Containers || f.Check == "assign" && !s.Assignments || f.Check == "dynamic-type" && !s.DynamicTypes {
+			continue
+		}
+		d := analysis.Diagnostic{
+			Pos:      f.Pos,
+			Category: f.Check,
+			Message:  f.Message,
+			URL:      f.URL,
+		}
+		// A by-value signature is reported on the declaration of its first
+		// flagged value, like "p Config", and the others are related to it,
+		// so that editors underline each of them.
+		for i, v := range f.Values {
+			if i == 0 && v.End.IsValid() {
+				d.Pos, d.End = v.Pos, v.End
+				continue
+			}
+			what := v.Role
+			if v.Role != "receiver" {
+				what = fmt.Sprintf("%s at index %d", v.Role, v.Index)
+			}
+			d.Related = append(d.Related, analysis.RelatedInformation{
+				Pos:     v.Pos,
+				End:     v.End,
+				Message: fmt.Sprintf("%s is '%s' (%d bytes)", what, v.Type, v.Size),
+			})
+		}
+		pass.Report(d)
+	}
+	return nil, nil
+}
@@ -0,0 +1,37 @@
+package a
+
+type big struct {
+	a, b, c, d int64
+}
+
+func byValue(b big) {} // want `parameter 'b' at index 0 should be made into a pointer`
+
+func byPointer(b *big) {}
+
+type small struct {
+	a int64
+}
+
+func bySmallValue(s small) {}
+
+//copyfighter:ignore callers rely on getting a copy
+func ignoredByValue(b big) {}
+
+//copyfighter:ignore passed by value everywhere on purpose
+type ignoredBig struct {
+	a, b, c, d int64
+}
+
+func byIgnoredValue(b ignoredBig) {}
+
+//copyfighter:ignore until=2000-01-01 fixed by then
+func expiredIgnore(b big) {} // want `parameter 'b' at index 0 should be made into a pointer`
+
+//copyfighter:ignore until=9999-12-31 callers move to pointers first
+func pendingIgnore(b big) {}
+
+func multiLine(
+	n int,
+	b big, // want `parameter 'b' at index 1 should be made into a pointer`
+) {
+}
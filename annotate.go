@@ -0,0 +1,69 @@
+package copyfighter
+
+import (
+	"bytes"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// annotateReason starts the reason of the ignore directives annotateSites
+// adds.
+const annotateReason = "TODO: pass a pointer or say why the copy is fine"
+
+// annotateSites adds an ignore directive above the declaration of the func or
+// type each of sites is about, in fset's files, or writes the additions to
+// diff as unified diffs if it's non-nil. Each directive gives annotateReason
+// and the site's fingerprint, numbered among sites as the json format numbers
+// them, so the suppressed findings can be told apart and found again. A
+// declaration with more than one site gets a directive for each, in the order
+// of sites. It returns the sites it annotated and those it couldn't, which
+// aren't in a func or type declaration in the working directory.
+func annotateSites(sites []copySite, fset *token.FileSet, diff io.Writer) (annotated, left []copySite, err error) {
+	sites = append([]copySite{}, sites...)
+	sort.Stable(sortedCopySites{sites, fset})
+	f := &fixer{fset: fset, edits: make(map[string]map[insertion]bool), diff: diff}
+	lines := make(map[token.Pos][]string)
+	starts := []token.Pos{}
+	seen := make(map[string]int)
+	for _, site := range sites {
+		fingerprint := site.fingerprint(seen)
+		pos := token.NoPos
+		switch {
+		case site.fun != nil:
+			pos = site.fun.Pos()
+		case site.decl != nil:
+			pos = site.decl.Pos()
+		}
+		if !pos.IsValid() || filepath.IsAbs(relPath(fset.Position(pos).Filename)) {
+			left = append(left, site)
+			continue
+		}
+		// A func's or type's name is on the line its declaration
+		// starts, after any doc comment.
+		tf := fset.File(pos)
+		start := tf.LineStart(tf.Line(pos))
+		if lines[start] == nil {
+			starts = append(starts, start)
+		}
+		lines[start] = append(lines[start], ignoreDirective+" "+annotateReason+" (fingerprint "+fingerprint+")\n")
+		annotated = append(annotated, site)
+	}
+	for _, start := range starts {
+		src, err := os.ReadFile(fset.File(start).Name())
+		if err != nil {
+			return nil, nil, err
+		}
+		// Indent the directives like the declaration.
+		line := src[fset.File(start).Offset(start):]
+		indent := string(line[:len(line)-len(bytes.TrimLeft(line, " \t"))])
+		f.insert(start, indent+strings.Join(lines[start], indent))
+	}
+	if err := f.write(); err != nil {
+		return nil, nil, err
+	}
+	return annotated, left, nil
+}
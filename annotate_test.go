@@ -0,0 +1,61 @@
+package copyfighter
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestAnnotateSites(t *testing.T) {
+	sites, fset := checkModule(t, map[string]string{"a.go": `package a
+
+type big struct{ a, b, c int64 }
+
+// take takes b.
+func take(b big) int64 { return b.a }
+
+type (
+	pair struct{ l, r big }
+)
+
+func (p pair) both(x big) {}
+`})
+	diff := &bytes.Buffer{}
+	if _, _, err := annotateSites(sites, fset, diff); err != nil {
+		t.Fatal(err)
+	}
+	if src, _ := os.ReadFile("a.go"); strings.Contains(string(src), ignoreDirective) {
+		t.Errorf("diff changed a.go:\n%s", src)
+	}
+	annotated, left, err := annotateSites(sites, fset, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(annotated) != len(sites) || len(left) != 0 {
+		t.Errorf("annotated %d and left %d of %d sites, want all annotated", len(annotated), len(left), len(sites))
+	}
+	src, err := os.ReadFile("a.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]int)
+	for _, site := range annotated {
+		line := ignoreDirective + " " + annotateReason + " (fingerprint " + site.fingerprint(seen) + ")\n"
+		if !strings.Contains(string(src), line) || !strings.Contains(diff.String(), line) {
+			t.Errorf("no %q for %s in:\n%s\ndiff:\n%s", line, site.message(siteLabels{}), src, diff)
+		}
+	}
+	for _, want := range []string{"// take takes b.\n" + ignoreDirective, "\t" + ignoreDirective + " " + annotateReason} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("annotated a.go doesn't have %q:\n%s", want, src)
+		}
+	}
+
+	again, _ := checkModule(t, map[string]string{"a.go": string(src)})
+	for _, site := range again {
+		if !site.ignored {
+			t.Errorf("annotated site %s isn't ignored", site.message(siteLabels{}))
+		}
+	}
+}
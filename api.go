@@ -0,0 +1,314 @@
+package copyfighter
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/token"
+	"go/types"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Finding is a copy of a wide value reported by one of the checks.
+type Finding struct {
+	// Pos is where the copy happens.
+	Pos token.Pos
+	// Check is the ID of the check that found the copy, like "signature".
+	Check string
+	// Message describes the copy and how to avoid it.
+	Message string
+	// URL is where the check is documented.
+	URL string
+	// Package is the import path of the package the copy is in.
+	Package string
+	// Type is the type of the largest value copied, qualified by its
+	// package's import path.
+	Type string
+	// Size is the size in bytes of the largest value copied.
+	Size int64
+	// Severity is how serious the copy is.
+	Severity Severity
+	// Values are the receiver, parameters, and results of a by-value
+	// signature that should be pointers. They are empty for other findings.
+	Values []Value
+}
+
+// A Value is a receiver, parameter, or result of a by-value signature.
+type Value struct {
+	// Pos and End are where its declaration, like "p Config", starts and
+	// ends. End is token.NoPos if the declaration isn't in the analyzed
+	// files.
+	Pos, End token.Pos
+	// Role is "receiver", "parameter", or "result".
+	Role string
+	// Index is the position of a parameter or result in its list.
+	Index int
+	// Type is the value's type, qualified by its package's import path.
+	Type string
+	// Size is the value's size in bytes.
+	Size int64
+}
+
+// A Severity is how serious a finding is. The findings of Check and Analyze
+// are all warnings; the command line's -warn-at and -error-at make notes of
+// the narrowest findings and errors of the widest.
+type Severity string
+
+const (
+	SeverityNote    Severity = "note"
+	SeverityWarning Severity = "warning"
+	SeverityError   Severity = "error"
+)
+
+// A Result is the findings of an analysis, sorted by position, along with
+// the file set their positions belong to.
+type Result struct {
+	Findings []Finding
+	fset     *token.FileSet
+	sites    []copySite
+}
+
+// newResult returns the result made of sites, which must be sorted.
+func newResult(sites []copySite, fset *token.FileSet) *Result {
+	r := &Result{Findings: []Finding{}, fset: fset, sites: sites}
+	for _, site := range sites {
+		f := Finding{
+			Pos:      site.pos,
+			Check:    site.check,
+			Message:  site.message(siteLabels{}),
+			URL:      docsURL,
+			Size:     site.size,
+			Severity: SeverityWarning,
+		}
+		if pkg := sitePkg(site); pkg != nil {
+			f.Package = pkg.Path()
+		}
+		if t := largestType(site); t != nil {
+			f.Type = types.TypeString(t, nil)
+		}
+		for _, v := range site.values {
+			if v.role != "" {
+				f.Values = append(f.Values, Value{Pos: v.pos, End: v.end, Role: v.role, Index: v.index, Type: types.TypeString(v.typ, nil), Size: v.size})
+			}
+		}
+		r.Findings = append(r.Findings, f)
+	}
+	return r
+}
+
+// largestType returns the type of the largest value site copies, or of the
+// type declaration it's about if it has no values.
+func largestType(site copySite) types.Type {
+	var t types.Type
+	size := int64(-1)
+	for _, v := range site.values {
+		if v.size > size {
+			t, size = v.typ, v.size
+		}
+	}
+	if t == nil && site.decl != nil {
+		t = site.decl.Type()
+	}
+	return t
+}
+
+// group returns the findings of r grouped by key, each group in the order of
+// r.Findings.
+func (r *Result) group(key func(Finding) string) map[string][]Finding {
+	groups := make(map[string][]Finding)
+	for _, f := range r.Findings {
+		k := key(f)
+		groups[k] = append(groups[k], f)
+	}
+	return groups
+}
+
+// ByPackage returns the findings grouped by the import path of their
+// package.
+func (r *Result) ByPackage() map[string][]Finding {
+	return r.group(func(f Finding) string { return f.Package })
+}
+
+// ByType returns the findings grouped by the type of the largest value
+// they copy.
+func (r *Result) ByType() map[string][]Finding {
+	return r.group(func(f Finding) string { return f.Type })
+}
+
+// BySeverity returns the findings grouped by severity.
+func (r *Result) BySeverity() map[Severity][]Finding {
+	groups := make(map[Severity][]Finding)
+	for _, f := range r.Findings {
+		groups[f.Severity] = append(groups[f.Severity], f)
+	}
+	return groups
+}
+
+// A Summary counts the findings of a Result.
+type Summary struct {
+	Findings int
+	// Packages and Types are the number of packages with findings and of
+	// types that findings copy.
+	Packages int
+	Types    int
+	// ByCheck and BySeverity are the number of findings of each check ID
+	// and severity.
+	ByCheck    map[string]int
+	BySeverity map[Severity]int
+}
+
+// Summary returns the counts of r's findings.
+func (r *Result) Summary() Summary {
+	s := Summary{
+		Findings:   len(r.Findings),
+		Packages:   len(r.ByPackage()),
+		ByCheck:    make(map[string]int),
+		BySeverity: make(map[Severity]int),
+	}
+	for t := range r.ByType() {
+		if t != "" {
+			s.Types++
+		}
+	}
+	for _, f := range r.Findings {
+		s.ByCheck[f.Check]++
+		s.BySeverity[f.Severity]++
+	}
+	return s
+}
+
+// String returns s as one line, like "3 findings in 2 packages (2 signature,
+// 1 range)".
+func (s Summary) String() string {
+	ids := make([]string, 0, len(s.ByCheck))
+	for id := range s.ByCheck {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for i, id := range ids {
+		ids[i] = fmt.Sprintf("%d %s", s.ByCheck[id], id)
+	}
+	line := fmt.Sprintf("%s in %s", plural(s.Findings, "finding"), plural(s.Packages, "package"))
+	if len(ids) > 0 {
+		line += " (" + strings.Join(ids, ", ") + ")"
+	}
+	return line
+}
+
+// Formats returns the names of the formats WriteFormat can write, sorted.
+func Formats() []string {
+	return formatNames()
+}
+
+// WriteFormat writes r to w in the named format, which is one of Formats,
+// like "text", "json", or "sarif", as the command writes it with -format.
+func (r *Result) WriteFormat(w io.Writer, format string) error {
+	write, ok := formats[format]
+	if !ok {
+		return fmt.Errorf("unknown format %#v, must be one of: %s", format, strings.Join(formatNames(), ", "))
+	}
+	return write(w, &report{sites: r.sites, fset: r.fset, runID: time.Now().UTC().Format(time.RFC3339)})
+}
+
+// Options configure Check and Analyze.
+type Options struct {
+	// Patterns are the packages to analyze, anything the go command
+	// accepts, like "./..." or "net/http", relative to the working
+	// directory.
+	Patterns []string
+	// MaxWidth is the size in bytes values can have before copies of them
+	// are reported. Zero means 16, like -max.
+	MaxWidth int64
+	// Sizes measures values. Nil means the sizes of the go command's
+	// GOARCH.
+	Sizes types.Sizes
+	// IncludeTests also analyzes the _test.go files of the packages and
+	// their external test packages, like -tests.
+	IncludeTests bool
+}
+
+// checkMu serializes Analyze, since the analysis reads settings that the
+// command's flags hold for the whole process, and Analyze sets the load
+// context and -tests among them for the length of a call.
+var checkMu sync.Mutex
+
+// Check loads and analyzes the packages opts matches like a run of the
+// command with no flags besides those opts sets, and returns its findings,
+// sorted by position. It's Analyze(...).Findings.
+func Check(ctx context.Context, opts Options) ([]Finding, error) {
+	r, err := Analyze(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return r.Findings, nil
+}
+
+// Analyze loads and analyzes the packages opts matches like a run of the
+// command with no flags besides those opts sets, and returns the result.
+// Loading stops when ctx is canceled, and so does the analysis between
+// packages, with ctx's error. Calls run one at a time.
+func Analyze(ctx context.Context, opts Options) (*Result, error) {
+	if len(opts.Patterns) == 0 {
+		return nil, fmt.Errorf("no packages to analyze")
+	}
+	maxWidth := opts.MaxWidth
+	if maxWidth == 0 {
+		maxWidth = 16
+	}
+	sizes := opts.Sizes
+	if sizes == nil {
+		if sizes = types.SizesFor("gc", build.Default.GOARCH); sizes == nil {
+			return nil, fmt.Errorf("unknown GOARCH %#v", build.Default.GOARCH)
+		}
+	}
+
+	checkMu.Lock()
+	defer checkMu.Unlock()
+	loadContext = ctx
+	defer func() { loadContext = context.Background() }()
+	defer func(t bool) { *tests = t }(*tests)
+	*tests = opts.IncludeTests
+
+	filter, err := newFilter(config{})
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	skips := newSkipLog()
+	sites, err := check(opts.Patterns, fset, limits{max: maxWidth}, sizes, shard{}, nil, skips)
+	if err != nil {
+		return nil, err
+	}
+	return newResult(filter.apply(sites, fset, skips), fset), nil
+}
+
+// FindInPackage runs the checks that look at one package at a time on the
+// type checked package made of files and returns their findings, sorted by
+// position. It's AnalyzePackage(...).Findings.
+func FindInPackage(fset *token.FileSet, files []*ast.File, info *types.Info, sizes types.Sizes, maxWidth int64) []Finding {
+	return AnalyzePackage(fset, files, info, sizes, maxWidth).Findings
+}
+
+// AnalyzePackage runs the checks that look at one package at a time on the
+// type checked package made of files and returns the result. Values that
+// sizes measures wider than maxWidth bytes are wide. Findings about funcs and
+// types with a //copyfighter:ignore directive are left out. info must record
+// Types, Defs, Uses, and Instances.
+func AnalyzePackage(fset *token.FileSet, files []*ast.File, info *types.Info, sizes types.Sizes, maxWidth int64) *Result {
+	decls := collectDecls(files, info, fset, sizes, maxWidth, nil)
+	wide := wideTypes{named: decls.named, maxes: decls.maxes, sizes: sizes}
+	sites := findSites(files, info, decls, wide, limits{max: maxWidth}, countCalls(files, info))
+	sort.Sort(sortedCopySites{sites: sites, fset: fset})
+	kept := []copySite{}
+	for _, site := range sites {
+		if !site.ignored {
+			kept = append(kept, site)
+		}
+	}
+	return newResult(kept, fset)
+}
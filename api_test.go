@@ -0,0 +1,135 @@
+package copyfighter
+
+import (
+	"bytes"
+	"context"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAnalyzePackage(t *testing.T) {
+	const src = `package p
+
+type big struct{ a, b, c, d int64 }
+
+func ByValue(b big) {}
+
+func Loop(bs []big) (n int64) {
+	for _, b := range bs {
+		n += b.a
+	}
+	return n
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &types.Info{
+		Types:     make(map[ast.Expr]types.TypeAndValue),
+		Defs:      make(map[*ast.Ident]types.Object),
+		Uses:      make(map[*ast.Ident]types.Object),
+		Instances: make(map[*ast.Ident]types.Instance),
+	}
+	sizes := &types.StdSizes{WordSize: 8, MaxAlign: 8}
+	files := []*ast.File{file}
+	if _, err := (&types.Config{Sizes: sizes}).Check("example.com/p", fset, files, info); err != nil {
+		t.Fatal(err)
+	}
+	r := AnalyzePackage(fset, files, info, sizes, 16)
+	if got := len(r.ByPackage()["example.com/p"]); got != 2 {
+		t.Errorf("ByPackage has %d findings in example.com/p, want 2", got)
+	}
+	if got := len(r.ByType()["example.com/p.big"]); got != 2 {
+		t.Errorf("ByType has %d findings copying example.com/p.big, want 2", got)
+	}
+	if got := len(r.BySeverity()[SeverityWarning]); got != 2 {
+		t.Errorf("BySeverity has %d warnings, want 2", got)
+	}
+	if got, want := r.Summary().String(), "2 findings in 1 package (1 range, 1 signature)"; got != want {
+		t.Errorf("Summary() = %q, want %q", got, want)
+	}
+	for _, f := range r.Findings {
+		if f.Check != "signature" {
+			continue
+		}
+		if len(f.Values) != 1 {
+			t.Fatalf("signature finding has %d values, want 1", len(f.Values))
+		}
+		start, end := fset.Position(f.Values[0].Pos), fset.Position(f.Values[0].End)
+		if got, want := src[start.Offset:end.Offset], "b big"; got != want {
+			t.Errorf("signature value spans %q, want %q", got, want)
+		}
+	}
+	b := &bytes.Buffer{}
+	if err := r.WriteFormat(b, "text"); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(b.String(), "\n"); lines != 2 {
+		t.Errorf("WriteFormat wrote %d lines, want 2:\n%s", lines, b)
+	}
+	if err := r.WriteFormat(b, "bogus"); err == nil {
+		t.Error("WriteFormat of an unknown format succeeded")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":    "module example.com/m\n\ngo 1.22\n",
+		"a.go":      "package a\n\ntype Big struct{ a, b, c int64 }\n\nfunc F(b Big) {}\n",
+		"a_test.go": "package a\n\nfunc helper(b Big) {}\n",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+
+	sizes := &types.StdSizes{WordSize: 8, MaxAlign: 8}
+	for _, opts := range []struct {
+		Options
+		want int
+	}{
+		{Options{Patterns: []string{"./..."}, Sizes: sizes}, 1},
+		{Options{Patterns: []string{"./..."}, Sizes: sizes, IncludeTests: true}, 2},
+		{Options{Patterns: []string{"./..."}, Sizes: sizes, MaxWidth: 24}, 0},
+	} {
+		findings, err := Check(context.Background(), opts.Options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(findings) != opts.want {
+			t.Errorf("Check(%+v) found %v, want %d findings", opts.Options, findings, opts.want)
+		}
+		for _, f := range findings {
+			if f.Package != "example.com/m" || f.Type != "example.com/m.Big" || f.Size != 24 {
+				t.Errorf("Check(%+v) found %+v, want a copy of example.com/m.Big", opts.Options, f)
+			}
+		}
+	}
+	if *tests {
+		t.Error("Check left -tests set")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Check(ctx, Options{Patterns: []string{"./..."}}); err == nil {
+		t.Error("Check with a canceled context succeeded")
+	}
+
+	// A bad setting of the process's flags is an error rather than an exit.
+	*changedFiles = filepath.Join(dir, "missing.txt")
+	defer func() { *changedFiles = "" }()
+	if _, err := Check(context.Background(), Options{Patterns: []string{"./..."}, Sizes: sizes}); err == nil {
+		t.Error("Check with a missing -changed-files list succeeded")
+	}
+}
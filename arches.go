@@ -0,0 +1,83 @@
+package copyfighter
+
+import (
+	"fmt"
+	"go/types"
+	"strings"
+)
+
+// archSizes are the sizes of one of the architectures of an -arch run.
+type archSizes struct {
+	arch  string
+	sizes types.Sizes
+}
+
+// parseArches parses the comma-separated GOARCH values of -arch, like
+// amd64,arm,386,wasm, into the gc compiler's sizes for each.
+func parseArches(s string) ([]archSizes, error) {
+	arches := []archSizes{}
+	for _, arch := range strings.Split(s, ",") {
+		arch = strings.TrimSpace(arch)
+		if arch == "" {
+			continue
+		}
+		sizes := types.SizesFor("gc", arch)
+		if sizes == nil {
+			return nil, fmt.Errorf("unknown GOARCH %#v in -arch", arch)
+		}
+		arches = append(arches, archSizes{arch: arch, sizes: sizes})
+	}
+	if len(arches) == 0 {
+		return nil, fmt.Errorf("-arch lists no architectures")
+	}
+	return arches, nil
+}
+
+// widestSizes are the sizes of an -arch run: every type is as large and as
+// aligned as it is on whichever of the architectures it's largest on, so
+// that values too wide to copy on any of them are reported.
+type widestSizes []archSizes
+
+func (w widestSizes) Alignof(t types.Type) int64 {
+	align := int64(0)
+	for _, a := range w {
+		align = max(align, a.sizes.Alignof(t))
+	}
+	return align
+}
+
+func (w widestSizes) Sizeof(t types.Type) int64 {
+	size := int64(0)
+	for _, a := range w {
+		size = max(size, a.sizes.Sizeof(t))
+	}
+	return size
+}
+
+// Offsetsof returns the offsets of the fields on the architecture where the
+// struct they make up is largest, so that they agree with Sizeof.
+func (w widestSizes) Offsetsof(fields []*types.Var) []int64 {
+	var offsets []int64
+	end := int64(-1)
+	for _, a := range w {
+		o := a.sizes.Offsetsof(fields)
+		e := int64(0)
+		if len(fields) > 0 {
+			e = o[len(o)-1] + a.sizes.Sizeof(fields[len(fields)-1].Type())
+		}
+		if e > end {
+			offsets, end = o, e
+		}
+	}
+	return offsets
+}
+
+// archLabel returns a label with the size of t on each of arches, like
+// " [amd64: 48 bytes, arm: 28 bytes]".
+func archLabel(t types.Type, arches []archSizes) string {
+	parts := []string{}
+	for _, a := range arches {
+		parts = append(parts, fmt.Sprintf("%s: %d bytes", a.arch, a.sizes.Sizeof(t)))
+	}
+	return " [" + strings.Join(parts, ", ") + "]"
+}
@@ -0,0 +1,37 @@
+package copyfighter
+
+import (
+	"go/token"
+	"go/types"
+	"testing"
+)
+
+func TestWidestSizes(t *testing.T) {
+	arches, err := parseArches("amd64, 386")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Pointers are wider on amd64, and int64 is less aligned on 386.
+	fields := []*types.Var{
+		types.NewField(token.NoPos, nil, "b", types.Typ[types.Byte], false),
+		types.NewField(token.NoPos, nil, "n", types.Typ[types.Int64], false),
+		types.NewField(token.NoPos, nil, "p", types.NewPointer(types.Typ[types.Int]), false),
+	}
+	st := types.NewStruct(fields, nil)
+	sizes := widestSizes(arches)
+	if got := sizes.Sizeof(st); got != 24 {
+		t.Errorf("Sizeof = %d, want amd64's 24", got)
+	}
+	if got := sizes.Offsetsof(fields); got[1] != 8 || got[2] != 16 {
+		t.Errorf("Offsetsof = %v, want amd64's [0 8 16]", got)
+	}
+	if got, want := archLabel(st, arches), " [amd64: 24 bytes, 386: 16 bytes]"; got != want {
+		t.Errorf("archLabel = %q, want %q", got, want)
+	}
+
+	for _, bad := range []string{"amd64,vax", " , "} {
+		if _, err := parseArches(bad); err == nil {
+			t.Errorf("parseArches(%q) succeeded, want an error", bad)
+		}
+	}
+}
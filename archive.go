@@ -0,0 +1,135 @@
+package copyfighter
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// extractArchive unpacks the .zip, .tar, .tar.gz, or .tgz file at path into a
+// new temporary directory and returns the directory. Only regular files and
+// directories are extracted; entries that would land outside the directory
+// are an error.
+func extractArchive(path string) (string, error) {
+	dir, err := os.MkdirTemp("", "copyfighter")
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case strings.HasSuffix(path, ".zip"):
+		err = extractZip(path, dir)
+	case strings.HasSuffix(path, ".tar.gz"), strings.HasSuffix(path, ".tgz"), strings.HasSuffix(path, ".tar"):
+		err = extractTar(path, dir)
+	default:
+		err = fmt.Errorf("unsupported archive %#v: must be .zip, .tar, .tar.gz, or .tgz", path)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// archivePath returns where the archive entry name is extracted to in dir.
+func archivePath(dir, name string) (string, error) {
+	p := filepath.Join(dir, filepath.FromSlash(name))
+	if p != dir && !strings.HasPrefix(p, dir+string(filepath.Separator)) {
+		return "", fmt.Errorf("archive entry %#v is outside the archive", name)
+	}
+	return p, nil
+}
+
+// writeArchiveFile creates the file p with the contents of r.
+func writeArchiveFile(p string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(p)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func extractZip(path, dir string) error {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("unable to open archive %#v: %s", path, err)
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		p, err := archivePath(dir, f.Name)
+		if err != nil {
+			return err
+		}
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(p, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("unable to read %#v from archive: %s", f.Name, err)
+		}
+		err = writeArchiveFile(p, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractTar(path, dir string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("unable to open archive %#v: %s", path, err)
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if !strings.HasSuffix(path, ".tar") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("unable to decompress archive %#v: %s", path, err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("unable to read archive %#v: %s", path, err)
+		}
+		p, err := archivePath(dir, hdr.Name)
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(p, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := writeArchiveFile(p, tr); err != nil {
+				return err
+			}
+		}
+	}
+}
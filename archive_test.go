@@ -0,0 +1,102 @@
+package copyfighter
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeZip writes a .zip archive of files to p.
+func writeZip(t *testing.T, p string, files map[string]string) {
+	t.Helper()
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for name, src := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(src)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeTarGz writes a .tar.gz archive of files to p.
+func writeTarGz(t *testing.T, p string, files map[string]string) {
+	t.Helper()
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	for name, src := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(src))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(src)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, c := range []interface{ Close() error }{tw, gw, f} {
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestExtractArchive(t *testing.T) {
+	files := map[string]string{
+		"go.mod":   "module example.com/m\n\ngo 1.22\n",
+		"a/a.go":   "package a\n",
+		"a/b/b.go": "package b\n",
+	}
+	src := t.TempDir()
+	for name, write := range map[string]func(*testing.T, string, map[string]string){"m.zip": writeZip, "m.tar.gz": writeTarGz} {
+		p := filepath.Join(src, name)
+		write(t, p, files)
+		dir, err := extractArchive(p)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for file, want := range files {
+			got, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(file)))
+			if err != nil || string(got) != want {
+				t.Errorf("%s: %s = %q, %v, want %q", name, file, got, err, want)
+			}
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestExtractArchiveOutside(t *testing.T) {
+	src := t.TempDir()
+	for name, write := range map[string]func(*testing.T, string, map[string]string){"evil.zip": writeZip, "evil.tar.gz": writeTarGz} {
+		p := filepath.Join(src, name)
+		write(t, p, map[string]string{"../evil.go": "package evil\n"})
+		dir, err := extractArchive(p)
+		if err == nil || !strings.Contains(err.Error(), "outside the archive") {
+			t.Errorf("%s: extracted to %s with error %v, want an entry outside the archive", name, dir, err)
+		}
+		if _, err := os.Stat(filepath.Join(os.TempDir(), "evil.go")); err == nil {
+			t.Errorf("%s: wrote evil.go outside the archive", name)
+		}
+	}
+	if _, err := extractArchive(filepath.Join(src, "m.rar")); err == nil {
+		t.Error("extracted a .rar archive, want an error")
+	}
+}
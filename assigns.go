@@ -0,0 +1,120 @@
+package copyfighter
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+// findAssignCopies returns a copySite for every assignment or variable
+// declaration in a func body that copies an existing wide value, as in
+// x := cfg, x = *p, or var x = s.items[i]. Composite literals and call
+// results are built in place and aren't reported, and neither are
+// assignments to the blank identifier, which copy nothing, or to interfaces,
+// which box the value.
+func findAssignCopies(files []*ast.File, info *types.Info, wide wideTypes) []copySite {
+	sites := []copySite{}
+	report := func(fun *types.Func, pos token.Pos, lhs, op string, dst types.Type, rhs ast.Expr) {
+		if dst == nil || types.IsInterface(dst) {
+			return
+		}
+		t := info.TypeOf(rhs)
+		if tuple, ok := t.(*types.Tuple); ok {
+			// The value of a comma-ok expression.
+			t = tuple.At(0).Type()
+		}
+		if !copiesValue(rhs, info) || t == nil || !wide.isWide(t) {
+			return
+		}
+		size := wide.sizes.Sizeof(t)
+		sites = append(sites, copySite{
+			check:  checkAssign,
+			pos:    pos,
+			fun:    fun,
+			what:   fmt.Sprintf("'%s %s %s' copies '%s' (%d bytes), use a pointer to it instead", lhs, op, types.ExprString(rhs), typeString(t, fun.Pkg()), size),
+			size:   size,
+			values: []copiedValue{{typ: t, size: size}},
+		})
+	}
+	inspectFuncBodies(files, info, func(fun *types.Func, n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			if n.Tok != token.ASSIGN && n.Tok != token.DEFINE {
+				return true
+			}
+			rhs := n.Rhs
+			if len(n.Lhs) == 2 && len(n.Rhs) == 1 {
+				// The comma-ok forms, v, ok := m[k] and v, ok := x.(T).
+				rhs = []ast.Expr{n.Rhs[0], nil}
+			}
+			if len(rhs) != len(n.Lhs) {
+				return true
+			}
+			for i, lhs := range n.Lhs {
+				if rhs[i] == nil || isBlank(lhs) {
+					continue
+				}
+				report(fun, n.Pos(), types.ExprString(lhs), n.Tok.String(), info.TypeOf(lhs), rhs[i])
+			}
+		case *ast.DeclStmt:
+			gd, ok := n.Decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.VAR {
+				return true
+			}
+			for _, spec := range gd.Specs {
+				vs := spec.(*ast.ValueSpec)
+				if len(vs.Values) != len(vs.Names) {
+					continue
+				}
+				pos := vs.Pos()
+				if len(gd.Specs) == 1 {
+					pos = n.Pos()
+				}
+				for i, name := range vs.Names {
+					if v := info.Defs[name]; v != nil && name.Name != "_" {
+						report(fun, pos, "var "+name.Name, "=", v.Type(), vs.Values[i])
+					}
+				}
+			}
+		}
+		return true
+	})
+	return sites
+}
+
+// copiesValue returns true if e reads an existing value, which assigning e
+// copies, rather than building a new one.
+func copiesValue(e ast.Expr, info *types.Info) bool {
+	switch e := ast.Unparen(e).(type) {
+	case *ast.Ident:
+		_, ok := info.Uses[e].(*types.Var)
+		return ok
+	case *ast.SelectorExpr, *ast.IndexExpr, *ast.StarExpr, *ast.TypeAssertExpr:
+		return true
+	}
+	return false
+}
+
+// isBlank returns true if e is the blank identifier.
+func isBlank(e ast.Expr) bool {
+	id, ok := ast.Unparen(e).(*ast.Ident)
+	return ok && id.Name == "_"
+}
+
+// withoutSitesAt returns the sites that aren't at the position of any of
+// others, so that a statement another check already reports isn't reported
+// again.
+func withoutSitesAt(sites, others []copySite) []copySite {
+	taken := make(map[token.Pos]bool)
+	for _, site := range others {
+		taken[site.pos] = true
+	}
+	out := []copySite{}
+	for _, site := range sites {
+		if !taken[site.pos] {
+			out = append(out, site)
+		}
+	}
+	return out
+}
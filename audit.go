@@ -0,0 +1,71 @@
+package copyfighter
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"io"
+	"sort"
+)
+
+// apiSites returns the sites whose fix changes the exported API, which is
+// what a library must settle before it promises compatibility. The others are
+// recorded in skips.
+func apiSites(sites []copySite, fset *token.FileSet, skips *skipLog) []copySite {
+	api := []copySite{}
+	for _, site := range sites {
+		if site.breaking {
+			api = append(api, site)
+		} else {
+			skips.add(skipNonAPI, siteEntity(site, fset))
+		}
+	}
+	return api
+}
+
+// writeAPIAudit writes the sites of exported funcs and methods grouped by the
+// wide type they copy, largest type first. A site copying more than one wide
+// type is listed under each.
+func writeAPIAudit(w io.Writer, sites []copySite, fset *token.FileSet) error {
+	groups := make(map[string][]copySite)
+	sizes := make(map[string]int64)
+	for _, site := range sites {
+		seen := make(map[string]bool)
+		for _, v := range site.values {
+			name := types.TypeString(v.typ, nil)
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			groups[name] = append(groups[name], site)
+			sizes[name] = v.size
+		}
+	}
+	names := []string{}
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if sizes[names[i]] != sizes[names[j]] {
+			return sizes[names[i]] > sizes[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	typesNoun := "types"
+	if len(names) == 1 {
+		typesNoun = "type"
+	}
+	fmt.Fprintf(w, "%d exported funcs and methods pass %d wide %s by value; fixing any of them is a breaking change\n", len(sites), len(names), typesNoun)
+	for _, name := range names {
+		fmt.Fprintf(w, "\n%s (%d bytes):\n", name, sizes[name])
+		for _, site := range groups[name] {
+			position := fset.Position(site.pos)
+			_, err := fmt.Fprintf(w, "    %s:%d:%d: %s\n", relPath(position.Filename), position.Line, position.Column, site.message(siteLabels{breaking: true}))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
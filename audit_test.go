@@ -0,0 +1,34 @@
+package copyfighter
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestAPIAudit(t *testing.T) {
+	const src = `package a
+
+type Big struct{ a, b, c int64 }
+
+type Huge struct{ a [8]int64 }
+
+func F(b Big, h Huge) {}
+
+func (h Huge) M() {}
+
+func g(b Big) {}
+`
+	sites, fset := checkModule(t, map[string]string{"a.go": src})
+	var buf bytes.Buffer
+	if err := writeAPIAudit(&buf, apiSites(sites, fset, newSkipLog()), fset); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	if !strings.HasPrefix(got, "2 exported funcs and methods pass 2 wide types by value; fixing any of them is a breaking change\n\nexample.com/m.Huge (64 bytes):\n    a.go:7:6: ") {
+		t.Errorf("audit doesn't start with Huge, the widest type:\n%s", got)
+	}
+	if strings.Count(got, "a.go:7:6:") != 2 || strings.Count(got, "a.go:9:15:") != 1 || strings.Contains(got, "a.go:11:") {
+		t.Errorf("audit doesn't list F under both types and M once, without g:\n%s", got)
+	}
+}
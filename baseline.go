@@ -0,0 +1,134 @@
+package copyfighter
+
+import (
+	"bufio"
+	"fmt"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// baselineHeader starts every baseline file.
+const baselineHeader = "# copyfighter baseline: findings recorded here don't fail a run with -baseline"
+
+// baselineKey identifies site in a baseline file by its file, check, func or
+// type, and what it copies, but not by its line, so that edits elsewhere in
+// the file don't make it a new finding.
+func baselineKey(site copySite, fset *token.FileSet) string {
+	parts := []string{relPath(fset.Position(site.pos).Filename), site.check}
+	switch {
+	case site.fun != nil:
+		parts = append(parts, types.ObjectString(site.fun, types.RelativeTo(site.fun.Pkg())))
+	case site.decl != nil:
+		parts = append(parts, site.decl.Name())
+	}
+	if site.what != "" {
+		parts = append(parts, site.what)
+	} else {
+		parts = append(parts, sentence(site.shouldBe))
+	}
+	return strings.Join(parts, "\t")
+}
+
+// writeBaseline writes the keys of sites to w, one per line and sorted. If
+// until isn't empty, every line ends with an until option that records the
+// site until that day.
+func writeBaseline(w io.Writer, sites []copySite, fset *token.FileSet, until string) error {
+	keys := make([]string, 0, len(sites))
+	for _, site := range sites {
+		key := baselineKey(site, fset)
+		if until != "" {
+			key += "\t" + untilOption + until
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if _, err := fmt.Fprintln(w, baselineHeader); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if _, err := fmt.Fprintln(w, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeBaselineFile writes the baseline of sites to the file at p.
+func writeBaselineFile(p string, sites []copySite, fset *token.FileSet, until string) error {
+	f, err := os.Create(p)
+	if err != nil {
+		return fmt.Errorf("unable to create baseline file: %s", err)
+	}
+	if err := writeBaseline(f, sites, fset, until); err != nil {
+		f.Close()
+		return fmt.Errorf("unable to write baseline file: %s", err)
+	}
+	return f.Close()
+}
+
+// baseline counts how many times each key is recorded in a baseline file.
+type baseline map[string]int
+
+// readBaselineFile reads the baseline file at p.
+func readBaselineFile(p string) (baseline, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open baseline file: %s", err)
+	}
+	defer f.Close()
+	return readBaseline(f)
+}
+
+// readBaseline reads a baseline file from r. Lines that end with an until
+// option whose day has passed are left out, so their sites are new again.
+func readBaseline(r io.Reader) (baseline, error) {
+	b := make(baseline)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i := strings.LastIndex(line, "\t"+untilOption); i >= 0 {
+			until, err := time.Parse(dateLayout, line[i+len("\t"+untilOption):])
+			if err != nil {
+				return nil, fmt.Errorf("baseline file line %d: %s isn't a day like 2025-09-01", n, line[i+1:])
+			}
+			if expired(until) {
+				continue
+			}
+			line = line[:i]
+		}
+		b[line]++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read baseline file: %s", err)
+	}
+	return b, nil
+}
+
+// apply returns the sites that b doesn't record, and records the others in
+// skips. Each line of b accounts for one site, so a finding that is repeated
+// more often than when the baseline was written is new.
+func (b baseline) apply(sites []copySite, fset *token.FileSet, skips *skipLog) []copySite {
+	left := make(baseline, len(b))
+	for key, n := range b {
+		left[key] = n
+	}
+	kept := []copySite{}
+	for _, site := range sites {
+		key := baselineKey(site, fset)
+		if left[key] > 0 {
+			left[key]--
+			skips.add(skipBaseline, siteEntity(site, fset))
+			continue
+		}
+		kept = append(kept, site)
+	}
+	return kept
+}
@@ -0,0 +1,76 @@
+package copyfighter
+
+import (
+	"bytes"
+	"go/token"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBaseline(t *testing.T) {
+	fset := token.NewFileSet()
+	file := fset.AddFile("a.go", -1, 100)
+	file.SetLines([]int{0, 10, 20, 30, 40})
+	old := []copySite{
+		{check: checkSelect, pos: file.Pos(12), what: "select case sends a copy"},
+		{check: checkSelect, pos: file.Pos(22), what: "select case sends a copy"},
+		{check: checkLiteral, pos: file.Pos(32), what: "field copies"},
+	}
+	b := &bytes.Buffer{}
+	if err := writeBaseline(b, old, fset, ""); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 4 || lines[0] != baselineHeader || lines[1] != "a.go\tliteral\tfield copies" {
+		t.Fatalf("baseline = %q", b.String())
+	}
+	base := make(baseline)
+	for _, line := range lines[1:] {
+		base[line]++
+	}
+
+	// The same findings on other lines are still recorded, but a third
+	// copy of a finding recorded twice is new.
+	current := []copySite{
+		{check: checkSelect, pos: file.Pos(2), what: "select case sends a copy"},
+		{check: checkSelect, pos: file.Pos(12), what: "select case sends a copy"},
+		{check: checkSelect, pos: file.Pos(22), what: "select case sends a copy"},
+		{check: checkLiteral, pos: file.Pos(42), what: "field copies"},
+		{check: checkLiteral, pos: file.Pos(43), what: "field copies something else"},
+	}
+	skips := newSkipLog()
+	kept := base.apply(current, fset, skips)
+	if len(kept) != 2 || kept[0].pos != current[2].pos || kept[1].pos != current[4].pos {
+		t.Errorf("apply kept %v, want the third select site and the new literal site", kept)
+	}
+	if n := len(skips.entities[skipBaseline]); n != 3 {
+		t.Errorf("skipped %d sites as in the baseline, want 3", n)
+	}
+}
+
+func TestBaselineUntil(t *testing.T) {
+	b, err := readBaseline(strings.NewReader(baselineHeader + "\n" +
+		"a.go\tliteral\tfield copies\tuntil=2000-01-01\n" +
+		"a.go\tliteral\tfield copies\tuntil=9999-12-31\n" +
+		"a.go\tselect\tselect case sends a copy\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (baseline{"a.go\tliteral\tfield copies": 1, "a.go\tselect\tselect case sends a copy": 1}); !reflect.DeepEqual(b, want) {
+		t.Errorf("baseline = %v, want %v without the expired entry", b, want)
+	}
+	if _, err := readBaseline(strings.NewReader("a.go\tliteral\tfield copies\tuntil=soon\n")); err == nil {
+		t.Errorf("read a baseline with a bad until date")
+	}
+
+	fset := token.NewFileSet()
+	file := fset.AddFile("a.go", -1, 10)
+	buf := &bytes.Buffer{}
+	if err := writeBaseline(buf, []copySite{{check: checkLiteral, pos: file.Pos(0), what: "field copies"}}, fset, "2030-01-02"); err != nil {
+		t.Fatal(err)
+	}
+	if want := baselineHeader + "\na.go\tliteral\tfield copies\tuntil=2030-01-02\n"; buf.String() != want {
+		t.Errorf("baseline = %q, want %q", buf, want)
+	}
+}
@@ -0,0 +1,79 @@
+package copyfighter
+
+import (
+	"go/ast"
+	"go/types"
+)
+
+// inspectFuncBodies calls fn for every node in the bodies of the funcs and
+// methods declared in files, along with the func the node is in. Nodes in
+// func literals belong to the declared func that contains them.
+func inspectFuncBodies(files []*ast.File, info *types.Info, fn func(fun *types.Func, n ast.Node) bool) {
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			fd, ok := decl.(*ast.FuncDecl)
+			if !ok || fd.Body == nil {
+				continue
+			}
+			fun, ok := info.Defs[fd.Name].(*types.Func)
+			if !ok {
+				continue
+			}
+			ast.Inspect(fd.Body, func(n ast.Node) bool {
+				if n == nil {
+					return false
+				}
+				return fn(fun, n)
+			})
+		}
+	}
+}
+
+// inspectDecls calls fn for every node in the funcs, methods, types,
+// variables, and constants declared in files, their signatures included,
+// along with what the node is about: the func it's in, or the type
+// declaration it's in outside of funcs, or neither for a package-level
+// variable or constant. pkg is the package the declarations are in.
+func inspectDecls(files []*ast.File, info *types.Info, fn func(pkg *types.Package, fun *types.Func, decl *types.TypeName, n ast.Node) bool) {
+	inspect := func(root ast.Node, pkg *types.Package, fun *types.Func, decl *types.TypeName) {
+		ast.Inspect(root, func(n ast.Node) bool {
+			if n == nil {
+				return false
+			}
+			return fn(pkg, fun, decl, n)
+		})
+	}
+	for _, file := range files {
+		for _, d := range file.Decls {
+			switch d := d.(type) {
+			case *ast.FuncDecl:
+				if fun, ok := info.Defs[d.Name].(*types.Func); ok {
+					inspect(d, fun.Pkg(), fun, nil)
+				}
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						if decl, ok := info.Defs[spec.Name].(*types.TypeName); ok {
+							inspect(spec, decl.Pkg(), nil, decl)
+						}
+					case *ast.ValueSpec:
+						if obj := info.Defs[spec.Names[0]]; obj != nil {
+							inspect(spec, obj.Pkg(), nil, nil)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// underlyingTypeOf returns the underlying type of e, or nil if e has no type,
+// like an expression that doesn't type check in a package -lenient analyzes.
+func underlyingTypeOf(info *types.Info, e ast.Expr) types.Type {
+	t := info.TypeOf(e)
+	if t == nil {
+		return nil
+	}
+	return t.Underlying()
+}
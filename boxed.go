@@ -0,0 +1,124 @@
+package copyfighter
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+)
+
+// boxing is a wide value stored in a variable of a non-empty interface type.
+type boxing struct {
+	fun   *types.Func
+	stmt  ast.Node
+	v     *types.Var
+	value ast.Expr
+	typ   types.Type
+}
+
+// findBoxedReceivers returns a copySite for every statement that stores a
+// wide value in a variable of an interface type with methods, as in
+//
+//	var w io.Writer = buf
+//	w.Write(p)
+//
+// when a method is then called through the variable. Storing the value in the
+// interface copies it once, and every call through the interface runs on that
+// copy, so updates to the original are never seen and the copy is usually on
+// the heap.
+func findBoxedReceivers(files []*ast.File, info *types.Info, wide wideTypes) []copySite {
+	boxings := []boxing{}
+	called := make(map[*types.Var]string)
+	inspectFuncBodies(files, info, func(fun *types.Func, n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			if len(n.Lhs) != len(n.Rhs) {
+				return true
+			}
+			for i, lhs := range n.Lhs {
+				id, ok := lhs.(*ast.Ident)
+				if !ok {
+					continue
+				}
+				obj := info.Defs[id]
+				if obj == nil {
+					obj = info.Uses[id]
+				}
+				if b, ok := boxed(obj, n.Rhs[i], info, wide); ok {
+					b.fun, b.stmt = fun, n
+					boxings = append(boxings, b)
+				}
+			}
+		case *ast.ValueSpec:
+			if len(n.Names) != len(n.Values) {
+				return true
+			}
+			for i, id := range n.Names {
+				if b, ok := boxed(info.Defs[id], n.Values[i], info, wide); ok {
+					b.fun, b.stmt = fun, n
+					boxings = append(boxings, b)
+				}
+			}
+		case *ast.CallExpr:
+			sel, ok := ast.Unparen(n.Fun).(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			id, ok := ast.Unparen(sel.X).(*ast.Ident)
+			if !ok {
+				return true
+			}
+			if v, ok := info.Uses[id].(*types.Var); ok && isMethodInterface(v.Type()) {
+				if _, seen := called[v]; !seen {
+					called[v] = sel.Sel.Name
+				}
+			}
+		}
+		return true
+	})
+
+	sites := []copySite{}
+	for _, b := range boxings {
+		method, ok := called[b.v]
+		if !ok {
+			continue
+		}
+		size := wide.sizes.Sizeof(b.typ)
+		sites = append(sites, copySite{
+			check:  checkBoxedReceiver,
+			pos:    b.stmt.Pos(),
+			fun:    b.fun,
+			what:   fmt.Sprintf("storing '%s' in '%s' boxes a copy of '%s' (%d bytes) that %s.%s and every other call through '%s' runs on, store a pointer in the interface instead", types.ExprString(b.value), b.v.Name(), typeString(b.typ, b.fun.Pkg()), size, b.v.Name(), method, b.v.Name()),
+			size:   size,
+			values: []copiedValue{{typ: b.typ, size: size}},
+		})
+	}
+	return sites
+}
+
+// boxed returns the boxing of value if obj is a variable of an interface type
+// with methods and value, or the operand of its conversion to an interface, is
+// wide.
+func boxed(obj types.Object, value ast.Expr, info *types.Info, wide wideTypes) (boxing, bool) {
+	v, ok := obj.(*types.Var)
+	if !ok || !isMethodInterface(v.Type()) {
+		return boxing{}, false
+	}
+	value = ast.Unparen(value)
+	// Look through explicit conversions, like io.Writer(buf).
+	if call, ok := value.(*ast.CallExpr); ok && len(call.Args) == 1 {
+		if tv, ok := info.Types[call.Fun]; ok && tv.IsType() && types.IsInterface(tv.Type) {
+			value = ast.Unparen(call.Args[0])
+		}
+	}
+	t := info.TypeOf(value)
+	if t == nil || types.IsInterface(t) || !wide.isWide(t) {
+		return boxing{}, false
+	}
+	return boxing{v: v, value: value, typ: t}, true
+}
+
+// isMethodInterface returns true if t is an interface type with methods.
+func isMethodInterface(t types.Type) bool {
+	it, ok := t.Underlying().(*types.Interface)
+	return ok && it.NumMethods() > 0
+}
@@ -0,0 +1,166 @@
+package copyfighter
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+// findBoxings returns a copySite for every conversion of a wide value to an
+// interface type in a func body, explicit, as in any(cfg), or implied by
+// where the value goes: an assignment or declaration of an interface
+// variable, a return of an interface result, an interface parameter,
+// variadic ones like fmt.Println's included, an interface element, key, or
+// field of a composite literal, or a send on a channel of interfaces. The
+// conversion copies the value, usually to the heap. Assignments and
+// declarations are reported at their statements, the others at the value.
+func findBoxings(files []*ast.File, info *types.Info, wide wideTypes) []copySite {
+	sites := []copySite{}
+	lits := []*ast.FuncLit{}
+	// stored are the explicit conversions reported with the statements that
+	// store their results.
+	stored := make(map[*ast.CallExpr]bool)
+	inspectFuncBodies(files, info, func(fun *types.Func, n ast.Node) bool {
+		box := func(pos token.Pos, value ast.Expr, to types.Type, where string) {
+			if to == nil || !types.IsInterface(to) {
+				return
+			}
+			t := info.TypeOf(value)
+			if t == nil || types.IsInterface(t) || !wide.isWide(t) {
+				return
+			}
+			size := wide.sizes.Sizeof(t)
+			sites = append(sites, copySite{
+				check:  checkBoxing,
+				pos:    pos,
+				fun:    fun,
+				what:   fmt.Sprintf("%s '%s' boxes a copy of '%s' (%d bytes) into '%s', usually on the heap, use a pointer instead", where, types.ExprString(value), typeString(t, fun.Pkg()), size, typeString(to, fun.Pkg())),
+				size:   size,
+				values: []copiedValue{{typ: t, size: size}},
+			})
+		}
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			lits = append(lits, n)
+		case *ast.AssignStmt:
+			if len(n.Lhs) != len(n.Rhs) || n.Tok != token.ASSIGN && n.Tok != token.DEFINE {
+				return true
+			}
+			for i, lhs := range n.Lhs {
+				value, to := explicitConversion(n.Rhs[i], info.TypeOf(lhs), info, stored)
+				box(n.Pos(), value, to, "storing")
+			}
+		case *ast.ValueSpec:
+			if n.Type == nil || len(n.Names) != len(n.Values) {
+				return true
+			}
+			for _, value := range n.Values {
+				value, to := explicitConversion(value, info.TypeOf(n.Type), info, stored)
+				box(n.Pos(), value, to, "storing")
+			}
+		case *ast.ReturnStmt:
+			sig := enclosingSignature(n.Pos(), fun, lits, info)
+			if sig.Results().Len() != len(n.Results) {
+				return true
+			}
+			for i, value := range n.Results {
+				box(value.Pos(), value, sig.Results().At(i).Type(), "returning")
+			}
+		case *ast.CallExpr:
+			tv, ok := info.Types[n.Fun]
+			if !ok || stored[n] {
+				return true
+			}
+			if tv.IsType() {
+				if len(n.Args) == 1 {
+					box(n.Args[0].Pos(), n.Args[0], tv.Type, "converting")
+				}
+				return true
+			}
+			sig, ok := tv.Type.Underlying().(*types.Signature)
+			if !ok {
+				return true
+			}
+			params := sig.Params()
+			for i, arg := range n.Args {
+				var to types.Type
+				switch {
+				case sig.Variadic() && i >= params.Len()-1 && !n.Ellipsis.IsValid():
+					to = params.At(params.Len() - 1).Type().(*types.Slice).Elem()
+				case i < params.Len():
+					to = params.At(i).Type()
+				}
+				box(arg.Pos(), arg, to, "passing")
+			}
+		case *ast.CompositeLit:
+			lt := info.TypeOf(n)
+			if lt == nil {
+				return true
+			}
+			for i, elt := range n.Elts {
+				value, key := elt, ast.Expr(nil)
+				if kv, ok := elt.(*ast.KeyValueExpr); ok {
+					value, key = kv.Value, kv.Key
+				}
+				switch u := lt.Underlying().(type) {
+				case *types.Slice:
+					box(value.Pos(), value, u.Elem(), "putting")
+				case *types.Array:
+					box(value.Pos(), value, u.Elem(), "putting")
+				case *types.Map:
+					if key != nil {
+						box(key.Pos(), key, u.Key(), "putting")
+					}
+					box(value.Pos(), value, u.Elem(), "putting")
+				case *types.Struct:
+					var field *types.Var
+					if id, ok := key.(*ast.Ident); ok {
+						field, _ = info.Uses[id].(*types.Var)
+					} else if key == nil && i < u.NumFields() {
+						field = u.Field(i)
+					}
+					if field != nil {
+						box(value.Pos(), value, field.Type(), "putting")
+					}
+				}
+			}
+		case *ast.SendStmt:
+			if ch, ok := underlyingTypeOf(info, n.Chan).(*types.Chan); ok {
+				box(n.Value.Pos(), n.Value, ch.Elem(), "sending")
+			}
+		}
+		return true
+	})
+	return sites
+}
+
+// explicitConversion returns the operand of value and its interface type if
+// value is an explicit conversion to an interface type, as in
+// io.Writer(buf), and records the conversion in stored. Otherwise it returns
+// value and to, the type value is stored as.
+func explicitConversion(value ast.Expr, to types.Type, info *types.Info, stored map[*ast.CallExpr]bool) (ast.Expr, types.Type) {
+	call, ok := ast.Unparen(value).(*ast.CallExpr)
+	if !ok || len(call.Args) != 1 {
+		return value, to
+	}
+	if tv, ok := info.Types[call.Fun]; ok && tv.IsType() && types.IsInterface(tv.Type) {
+		stored[call] = true
+		return call.Args[0], tv.Type
+	}
+	return value, to
+}
+
+// enclosingSignature returns the signature of the innermost func that holds
+// pos: the last of lits, the func literals seen so far in a walk of fun's
+// body, that spans pos, or fun itself.
+func enclosingSignature(pos token.Pos, fun *types.Func, lits []*ast.FuncLit, info *types.Info) *types.Signature {
+	for i := len(lits) - 1; i >= 0; i-- {
+		if lits[i].Pos() <= pos && pos < lits[i].End() {
+			if sig, ok := info.TypeOf(lits[i]).(*types.Signature); ok {
+				return sig
+			}
+		}
+	}
+	return fun.Type().(*types.Signature)
+}
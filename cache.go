@@ -0,0 +1,258 @@
+package copyfighter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/build"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// pkgCache is the cache of the run, if it uses one. Only the main run sets
+// it, so the other commands and the tests always analyze every package.
+var pkgCache *resultCache
+
+// resultCache is an on-disk cache of the matched packages that a run found
+// nothing in, so later runs with the same flags can skip loading them until
+// their sources or the sources of their dependencies change. Packages with
+// findings are analyzed again every time, since their findings refer to type
+// checked objects that can't be stored.
+type resultCache struct {
+	dir string
+	// salt is the hash of everything besides the sources that a package's
+	// findings depend on: the binary, its flags, and the build environment.
+	salt []byte
+	// keys are the keys of the matched packages that are loaded, by import
+	// path, and found what they found.
+	keys  map[string]string
+	found map[string]*cacheEntry
+	// calls are the calls the cached packages make, by full name of the
+	// called func.
+	calls map[string]int
+}
+
+// cacheEntry is what the cache records of a package without findings.
+type cacheEntry struct {
+	// Calls are the number of static calls the package makes to each func,
+	// which count toward the call sites of the funcs reported elsewhere.
+	Calls map[string]int `json:"calls,omitempty"`
+	// Skips are what the analysis of the package skipped, by reason.
+	Skips map[string][]string `json:"skips,omitempty"`
+	// clean is true if the package found nothing, which is the only kind
+	// of entry saved.
+	clean bool
+}
+
+// uncachedFlags are the flags whose values don't change what packages find.
+var uncachedFlags = map[string]bool{
+	"concurrency":  true,
+	"no-cache":     true,
+	"cache-dir":    true,
+	"warn-at":      true,
+	"error-at":     true,
+	"exit-zero":    true,
+	"max-findings": true,
+}
+
+// openCache returns the cache in dir, or in the user cache directory if dir is
+// empty, for runs with the flags set on commandLine.
+func openCache(dir string) (*resultCache, error) {
+	if dir == "" {
+		d, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("unable to find the cache directory: %s", err)
+		}
+		dir = filepath.Join(d, "copyfighter")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("unable to create the cache directory: %s", err)
+	}
+	h := sha256.New()
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("unable to find the copyfighter binary: %s", err)
+	}
+	if err := hashFile(h, exe); err != nil {
+		return nil, fmt.Errorf("unable to read the copyfighter binary: %s", err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	// Skipped entities are given relative to the working directory.
+	fmt.Fprintf(h, "wd %s\ngoos %s\ngoarch %s\ngoflags %s\n", wd, build.Default.GOOS, build.Default.GOARCH, os.Getenv("GOFLAGS"))
+	commandLine.VisitAll(func(f *flag.Flag) {
+		if !uncachedFlags[f.Name] {
+			fmt.Fprintf(h, "-%s=%s\n", f.Name, f.Value)
+		}
+	})
+	return newResultCache(dir, h.Sum(nil)), nil
+}
+
+func newResultCache(dir string, salt []byte) *resultCache {
+	return &resultCache{
+		dir:   dir,
+		salt:  salt,
+		keys:  make(map[string]string),
+		found: make(map[string]*cacheEntry),
+		calls: make(map[string]int),
+	}
+}
+
+// skip returns true if the matched package pkg found nothing in an earlier
+// run, and records what that run skipped in skips. Otherwise it remembers
+// pkg's key, so record can store what it finds. pkg must have been listed
+// with its dependencies, whose keys are memoized in memo.
+func (c *resultCache) skip(pkg *packages.Package, memo map[string]string, skips *skipLog) bool {
+	if c == nil {
+		return false
+	}
+	key, ok := c.key(pkg, memo)
+	if !ok {
+		return false
+	}
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		c.keys[pkg.PkgPath] = key
+		return false
+	}
+	var e cacheEntry
+	if err := json.Unmarshal(data, &e); err != nil {
+		c.keys[pkg.PkgPath] = key
+		return false
+	}
+	for f, n := range e.Calls {
+		c.calls[f] += n
+	}
+	if skips != nil {
+		for reason, entities := range e.Skips {
+			skips.entities[reason] = append(skips.entities[reason], entities...)
+		}
+	}
+	return true
+}
+
+// key returns the hash of pkg's sources and its dependencies' keys, salted,
+// or false if a file can't be read.
+func (c *resultCache) key(pkg *packages.Package, memo map[string]string) (string, bool) {
+	if key, ok := memo[pkg.ID]; ok {
+		return key, key != ""
+	}
+	memo[pkg.ID] = ""
+	h := sha256.New()
+	h.Write(c.salt)
+	fmt.Fprintf(h, "package %s\n", pkg.PkgPath)
+	for _, name := range append(append([]string{}, pkg.GoFiles...), pkg.OtherFiles...) {
+		fmt.Fprintf(h, "%s\n", filepath.Base(name))
+		if err := hashFile(h, name); err != nil {
+			return "", false
+		}
+	}
+	paths := make([]string, 0, len(pkg.Imports))
+	for path := range pkg.Imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		key, ok := c.key(pkg.Imports[path], memo)
+		if !ok {
+			return "", false
+		}
+		fmt.Fprintf(h, "import %s %s\n", path, key)
+	}
+	key := hex.EncodeToString(h.Sum(nil))
+	memo[pkg.ID] = key
+	return key, true
+}
+
+// record records what the analysis of the loaded package pkg found: its
+// sites, and what it skipped.
+func (c *resultCache) record(pkg *packages.Package, sites []copySite, skips *skipLog) {
+	if c == nil {
+		return
+	}
+	if _, ok := c.keys[pkg.PkgPath]; !ok {
+		return
+	}
+	e := &cacheEntry{Calls: make(map[string]int), Skips: skips.entities, clean: len(sites) == 0}
+	c.found[pkg.PkgPath] = e
+	for f, n := range countCalls(pkg.Syntax, pkg.TypesInfo) {
+		e.Calls[f.Origin().FullName()] += n
+	}
+}
+
+// save stores the recorded packages that found nothing.
+func (c *resultCache) save() error {
+	if c == nil {
+		return nil
+	}
+	for path, e := range c.found {
+		if !e.clean {
+			continue
+		}
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if err := writeCacheFile(c.path(c.keys[path]), data); err != nil {
+			return fmt.Errorf("unable to write to the cache: %s", err)
+		}
+	}
+	return nil
+}
+
+// cachedCalls returns the calls the skipped packages make, by full name of
+// the called func.
+func (c *resultCache) cachedCalls() map[string]int {
+	if c == nil {
+		return nil
+	}
+	return c.calls
+}
+
+// path returns the path of the cache file of key, in a subdirectory named
+// after its first two digits like the go command's cache.
+func (c *resultCache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key)
+}
+
+// writeCacheFile writes data to path through a temporary file, so concurrent
+// runs never read a partly written entry.
+func writeCacheFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// hashFile writes the contents of the file at path to h.
+func hashFile(h io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(h, f)
+	return err
+}
@@ -0,0 +1,73 @@
+package copyfighter
+
+import (
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResultCache(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.22\n",
+		"p/p.go": "package p\n\ntype Big struct{ a, b, c int64 }\n\nfunc Use(b Big) {}\n",
+		"c/c.go": "package c\n\nimport \"example.com/m/p\"\n\nfunc F() { p.Use(p.Big{}); p.Use(p.Big{}) }\n",
+	}
+	for name, src := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+	cacheDir := t.TempDir()
+	defer func() { pkgCache = nil }()
+	// run returns the call sites of Use, and the files in the cache.
+	run := func() (int, []string) {
+		t.Helper()
+		pkgCache = newResultCache(cacheDir, []byte("salt"))
+		sites, err := check([]string{"./..."}, token.NewFileSet(), limits{max: 16}, &types.StdSizes{WordSize: 8, MaxAlign: 8}, shard{}, nil, newSkipLog())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sites) != 1 {
+			t.Fatalf("found %d sites, want 1", len(sites))
+		}
+		entries, _ := filepath.Glob(filepath.Join(cacheDir, "*", "*"))
+		return sites[0].calls, entries
+	}
+
+	calls, entries := run()
+	if calls != 2 || len(entries) != 1 {
+		t.Fatalf("first run counted %d calls and cached %v, want 2 calls and the clean package", calls, entries)
+	}
+	// A skipped package counts the calls its entry records.
+	if err := os.WriteFile(entries[0], []byte(`{"calls":{"example.com/m/p.Use":5}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if calls, _ := run(); calls != 5 {
+		t.Errorf("second run counted %d calls, want the 5 of the cached entry", calls)
+	}
+	// Changing a dependency changes the key of the package.
+	if err := os.WriteFile(filepath.Join(dir, "p/p.go"), []byte(files["p/p.go"]+"\nfunc Other(b Big) {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	pkgCache = newResultCache(cacheDir, []byte("salt"))
+	sites, err := check([]string{"./..."}, token.NewFileSet(), limits{max: 16}, &types.StdSizes{WordSize: 8, MaxAlign: 8}, shard{}, nil, newSkipLog())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, site := range sites {
+		if site.fun.Name() == "Use" && site.calls != 2 {
+			t.Errorf("run after a dependency changed counted %d calls, want 2", site.calls)
+		}
+	}
+	if entries, _ := filepath.Glob(filepath.Join(cacheDir, "*", "*")); len(entries) != 2 {
+		t.Errorf("cache has %v after a dependency changed, want a second entry", entries)
+	}
+}
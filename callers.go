@@ -0,0 +1,80 @@
+package copyfighter
+
+import (
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// countCalls returns the number of static call sites of each func and method
+// called in files. Calls through interfaces and func values aren't counted.
+func countCalls(files []*ast.File, info *types.Info) map[*types.Func]int {
+	calls := make(map[*types.Func]int)
+	for _, file := range files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			var id *ast.Ident
+			switch fun := ast.Unparen(call.Fun).(type) {
+			case *ast.Ident:
+				id = fun
+			case *ast.SelectorExpr:
+				id = fun.Sel
+			}
+			if f, ok := info.Uses[id].(*types.Func); ok {
+				calls[f]++
+			}
+			return true
+		})
+	}
+	return calls
+}
+
+// addCallCounts sets the calls of the signature sites to their funcs' static
+// call sites in all of pkgs, rather than in their own packages alone, plus
+// cached, the calls by name made by the packages the cache skipped. Funcs are
+// matched by name, since each package that is type checked from source sees
+// the others' funcs as objects of its own.
+func addCallCounts(sites []copySite, pkgs []*packages.Package, cached map[string]int) {
+	calls := make(map[string]int)
+	for f, n := range cached {
+		calls[f] = n
+	}
+	for _, pkg := range pkgs {
+		if pkg.TypesInfo == nil {
+			continue
+		}
+		for f, n := range countCalls(pkg.Syntax, pkg.TypesInfo) {
+			calls[f.Origin().FullName()] += n
+		}
+	}
+	for i := range sites {
+		if sites[i].check == checkSignature {
+			sites[i].calls = calls[sites[i].fun.Origin().FullName()]
+		}
+	}
+}
+
+// singleCallerFuncs returns the unexported, non-method funcs of the package
+// whose only use is a single call, given the call counts from countCalls.
+// Copying their arguments costs one copy per call of that caller, so they are
+// rarely worth changing.
+func singleCallerFuncs(calls map[*types.Func]int, info *types.Info) map[*types.Func]bool {
+	uses := make(map[*types.Func]int)
+	for _, obj := range info.Uses {
+		if f, ok := obj.(*types.Func); ok {
+			uses[f]++
+		}
+	}
+	single := make(map[*types.Func]bool)
+	for f, n := range calls {
+		s := f.Type().(*types.Signature)
+		if n == 1 && uses[f] == 1 && !f.Exported() && s.Recv() == nil {
+			single[f] = true
+		}
+	}
+	return single
+}
@@ -0,0 +1,57 @@
+package copyfighter
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+)
+
+// findCalls returns a copySite for every call in a func body that copies a
+// wide receiver or argument because the callee takes it by value, whether
+// the callee is a func of the package, of the rest of module, of a
+// dependency, of the standard library, or a func value. The signature check
+// reports where such copies are declared, and these sites where they happen.
+// Composite literal arguments are built in place and aren't reported. The
+// sites of calls to dependencies, as findDependencyCalls defines them, carry
+// the dependency's import path.
+func findCalls(files []*ast.File, info *types.Info, pkg *types.Package, module string, wide wideTypes) []copySite {
+	isDependency := dependencies(pkg, module)
+	sites := []copySite{}
+	inspectFuncBodies(files, info, func(fun *types.Func, n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		allCopied, allValues := callCopies(call, info, fun.Pkg(), wide)
+		copied := []string{}
+		values := []copiedValue{}
+		for i, v := range allValues {
+			if v.role == "parameter" {
+				if _, ok := ast.Unparen(call.Args[v.index]).(*ast.CompositeLit); ok {
+					continue
+				}
+			}
+			copied = append(copied, allCopied[i])
+			values = append(values, v)
+		}
+		if len(values) == 0 {
+			return true
+		}
+		site := copySite{
+			check:  checkCall,
+			pos:    call.Pos(),
+			fun:    fun,
+			what:   fmt.Sprintf("call to '%s' copies %s", types.ExprString(call.Fun), sentence(copied)),
+			values: values,
+		}
+		if callee := staticCallee(call, info); callee != nil && isDependency(callee.Pkg()) {
+			site.dependency = callee.Pkg().Path()
+		}
+		for _, v := range values {
+			site.size = max(site.size, v.size)
+		}
+		sites = append(sites, site)
+		return true
+	})
+	return sites
+}
@@ -0,0 +1,96 @@
+package copyfighter
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+// submitMethods are the names of the methods that errgroup, conc, ants, and
+// similar worker pools use to run a func on another goroutine.
+var submitMethods = map[string]bool{
+	"Go":        true,
+	"TryGo":     true,
+	"Submit":    true,
+	"SubmitErr": true,
+	"TrySubmit": true,
+	"Schedule":  true,
+	"Spawn":     true,
+}
+
+// findPoolCaptures returns a copySite for every func literal that is handed
+// to a goroutine or worker pool inside a range loop and captures the loop's
+// wide value variable, as in:
+//
+//	for _, job := range jobs {
+//		g.Go(func() error { return handle(job) })
+//	}
+//
+// Each iteration copies the element into job, and because the closure
+// outlives the iteration, job usually moves to the heap as well.
+func findPoolCaptures(files []*ast.File, info *types.Info, wide wideTypes) []copySite {
+	sites := []copySite{}
+	inspectFuncBodies(files, info, func(fun *types.Func, n ast.Node) bool {
+		rs, ok := n.(*ast.RangeStmt)
+		if !ok || rs.Tok != token.DEFINE {
+			return true
+		}
+		id, ok := rs.Value.(*ast.Ident)
+		if !ok || id.Name == "_" {
+			return true
+		}
+		v := info.Defs[id]
+		if v == nil || !wide.isWide(v.Type()) {
+			return true
+		}
+		ast.Inspect(rs.Body, func(n ast.Node) bool {
+			var (
+				call  *ast.CallExpr
+				where string
+			)
+			switch n := n.(type) {
+			case *ast.GoStmt:
+				call, where = n.Call, "started by a go statement"
+			case *ast.CallExpr:
+				if sel, ok := ast.Unparen(n.Fun).(*ast.SelectorExpr); ok && submitMethods[sel.Sel.Name] {
+					call, where = n, "passed to "+types.ExprString(sel)
+				}
+			}
+			if call == nil {
+				return true
+			}
+			lits := append([]ast.Expr{call.Fun}, call.Args...)
+			for _, e := range lits {
+				lit, ok := ast.Unparen(e).(*ast.FuncLit)
+				if !ok || !captures(lit, v, info) {
+					continue
+				}
+				size := wide.sizes.Sizeof(v.Type())
+				sites = append(sites, copySite{
+					check:  checkCapture,
+					pos:    lit.Pos(),
+					fun:    fun,
+					what:   fmt.Sprintf("range value '%s' copies '%s' (%d bytes) each iteration and is captured by the func %s, range over the index and capture a pointer to the element instead", v.Name(), typeString(v.Type(), fun.Pkg()), size, where),
+					size:   size,
+					values: []copiedValue{{typ: v.Type(), size: size}},
+				})
+			}
+			return true
+		})
+		return true
+	})
+	return sites
+}
+
+// captures returns true if the func literal refers to v.
+func captures(lit *ast.FuncLit, v types.Object, info *types.Info) bool {
+	found := false
+	ast.Inspect(lit.Body, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && info.Uses[id] == v {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
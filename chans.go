@@ -0,0 +1,48 @@
+package copyfighter
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+// findWideChans returns a copySite for every channel type of a wide element
+// type written in files, as in a declaration, a signature, or a make call,
+// and for every send on such a channel in a func body outside a select,
+// whose cases the select check reports. Every send and receive copies the
+// whole element into or out of the channel.
+func findWideChans(files []*ast.File, info *types.Info, wide wideTypes) []copySite {
+	sites := []copySite{}
+	inSelect := make(map[ast.Stmt]bool)
+	inspectDecls(files, info, func(pkg *types.Package, fun *types.Func, decl *types.TypeName, n ast.Node) bool {
+		add := func(pos token.Pos, elem types.Type, before, after string) {
+			size := wide.sizes.Sizeof(elem)
+			site := copySite{check: checkChan, pos: pos, fun: fun, decl: decl, size: size, values: []copiedValue{{typ: elem, size: size}}}
+			if fun == nil && decl == nil {
+				site.pkg = pkg
+			}
+			site.what = fmt.Sprintf("%s '%s' (%d bytes) %s, use 'chan %s' or a smaller message type instead", before, typeString(elem, pkg), size, after, typeString(types.NewPointer(elem), pkg))
+			sites = append(sites, site)
+		}
+		switch n := n.(type) {
+		case *ast.CommClause:
+			if n.Comm != nil {
+				inSelect[n.Comm] = true
+			}
+		case *ast.ChanType:
+			elem := info.TypeOf(n.Value)
+			if elem != nil && wide.isWide(elem) {
+				add(n.Pos(), elem, "every send and receive on a channel of", "copies all of it")
+			}
+		case *ast.SendStmt:
+			ct, ok := underlyingTypeOf(info, n.Chan).(*types.Chan)
+			if !ok || inSelect[n] || !wide.isWide(ct.Elem()) {
+				return true
+			}
+			add(n.Pos(), ct.Elem(), fmt.Sprintf("sending '%s' copies", types.ExprString(n.Value)), "into the channel")
+		}
+		return true
+	})
+	return sites
+}
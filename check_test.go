@@ -1,25 +1,516 @@
-package main
+package copyfighter
 
 import (
 	"bytes"
+	"fmt"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
 func TestGoldenPath(t *testing.T) {
-	sites, fset, err := check("./testdata", 16, 8, 8)
+	fset := token.NewFileSet()
+	sites, err := check([]string{"./testdata"}, fset, limits{max: 16}, &types.StdSizes{WordSize: 8, MaxAlign: 8}, shard{}, nil, nil)
 	if err != nil {
 		t.Fatalf("unexpected error: %s", err)
 	}
 	b := &bytes.Buffer{}
-	printSites(sites, fset, b)
+	printSites(sites, fset, b, siteLabels{})
 	actual := string(b.Bytes())
 	if goldenData != actual {
 		t.Errorf("output doesn't match, want:\n%s\n=============\ngot:\n%s", goldenData, actual)
 	}
 }
 
-const goldenData = `testdata/inner.go:24:6: parameter 'f' at index 0 should be made into a pointer (func CallsFoo(f Foo))
-testdata/inner.go:28:14: receiver, and parameter 'o' at index 0 should be made into pointers (func (Foo).OnOtherToo(o other))
-testdata/inner.go:32:16: receiver should be made into a pointer (func (other).OnStruct())
-testdata/inner.go:35:16: receiver should be made into a pointer (func (other).OnStruct2())
+const goldenData = `testdata/inner.go:24:6: parameter 'f' at index 0 should be made into a pointer (func CallsFoo(f Foo)); 'Foo' is 48 bytes (declared at testdata/inner.go:22), max 16
+testdata/inner.go:28:14: receiver, and parameter 'o' at index 0 should be made into pointers (func (Foo).OnOtherToo(o other)); 'Foo' is 48 bytes (declared at testdata/inner.go:22), 'other' is 32 bytes (declared at testdata/inner.go:12), max 16
+testdata/inner.go:32:16: receiver should be made into a pointer (func (other).OnStruct()); 'other' is 32 bytes (declared at testdata/inner.go:12), max 16 [implements onStructer]
+testdata/inner.go:35:16: receiver should be made into a pointer (func (other).OnStruct2()); 'other' is 32 bytes (declared at testdata/inner.go:12), max 16
+testdata/inner.go:49:17: every send and receive on a channel of 'other' (32 bytes) copies all of it, use 'chan *other' or a smaller message type instead (func selects(in chan other, out chan other, done chan struct{}))
+testdata/inner.go:49:33: every send and receive on a channel of 'other' (32 bytes) copies all of it, use 'chan *other' or a smaller message type instead (func selects(in chan other, out chan other, done chan struct{}))
+testdata/inner.go:52:3: select case receives a copy of 'other' (32 bytes), use a channel of pointers instead (func selects(in chan other, out chan other, done chan struct{}))
+testdata/inner.go:53:4: sending 'o' copies 'other' (32 bytes) into the channel, use 'chan *other' or a smaller message type instead (func selects(in chan other, out chan other, done chan struct{}))
+testdata/inner.go:54:3: select case sends a copy of 'other' (32 bytes), use a channel of pointers instead (func selects(in chan other, out chan other, done chan struct{}))
+testdata/inner.go:62:6: parameter 'bs' at index 0, and parameter 's' at index 2 should be made into pointers (func aggregates(bs [4]bar, pair [2]bar, s struct{items [3]bar})); '[4]bar' is 32 bytes, 'struct{items [3]bar}' is 24 bytes, max 16
+testdata/inner.go:71:2: range value 'o' copies 'other' (32 bytes) each iteration, range over the index and use the element in place, or over a slice of pointers instead (func submits(g *group, os []other))
+testdata/inner.go:72:8: range value 'o' copies 'other' (32 bytes) each iteration and is captured by the func passed to g.Go, range over the index and capture a pointer to the element instead (func submits(g *group, os []other))
+testdata/inner.go:76:6: range value 'o' copies 'other' (32 bytes) each iteration and is captured by the func started by a go statement, range over the index and capture a pointer to the element instead (func submits(g *group, os []other))
+testdata/inner.go:89:2: field 'cfg' of 'request' holds 'other' by value (32 of its 48 bytes), consider *other
+testdata/inner.go:93:6: parameter 'cfg' at index 0 should be made into a pointer (func literals(cfg other) []request); 'other' is 32 bytes (declared at testdata/inner.go:12), max 16
+testdata/inner.go:94:9: every index, append, and range of a slice of 'request' (48 bytes) copies whole elements; '[]*request' copies a word instead, but allocates each element and adds work for the garbage collector (func literals(cfg other) []request)
+testdata/inner.go:95:9: field 'cfg' of 'request' literal copies 'cfg' of type 'other' (32 bytes), consider making the field a pointer (func literals(cfg other) []request)
+testdata/inner.go:97:4: field 'cfg' of 'request' literal copies 'cfg' of type 'other' (32 bytes), consider making the field a pointer (func literals(cfg other) []request)
+testdata/inner.go:102:2: 'session' embeds 'other' by value (32 of its 40 bytes), consider *other
+testdata/inner.go:107:2: 'v := *o' copies the 'other' (32 bytes) that parameter 'o' points to and 'o' isn't used again, use the pointer directly (func derefs(o *other, keep *other))
+testdata/inner.go:108:2: 'w := *keep' copies 'other' (32 bytes), use a pointer to it instead (func derefs(o *other, keep *other))
+testdata/inner.go:115:2: 'v := *o' copies the 'other' (32 bytes) that receiver 'o' points to and 'o' isn't used again, use the pointer directly (func (*other).OnPtrCopy())
+testdata/inner.go:123:6: parameter 'o' at index 0 should be made into a pointer (func boxes(o other)); 'other' is 32 bytes (declared at testdata/inner.go:12), max 16
+testdata/inner.go:124:6: storing 'o' in 's' boxes a copy of 'other' (32 bytes) that s.OnStruct and every other call through 's' runs on, store a pointer in the interface instead (func boxes(o other))
+testdata/inner.go:126:2: storing 'o' in 't' boxes a copy of 'other' (32 bytes) that t.OnStruct and every other call through 't' runs on, store a pointer in the interface instead (func boxes(o other))
+testdata/inner.go:130:6: storing 'o' boxes a copy of 'other' (32 bytes) into 'onStructer', usually on the heap, use a pointer instead (func boxes(o other))
+testdata/inner.go:138:6: parameter 't' at index 0, and return value at index 0 copy wide type arguments in the instantiations process[Foo] (48 bytes), process[other] (32 bytes), instantiate with pointer types instead (func process[T any](t T) T)
+testdata/inner.go:142:6: return value at index 0 copies wide type arguments in the instantiation first[other] (32 bytes), instantiate with pointer types instead (func first[T any](ts []T) T)
+testdata/inner.go:150:8: every index, append, and range of a slice of 'other' (32 bytes) copies whole elements; '[]*other' copies a word instead, but allocates each element and adds work for the garbage collector (func generics())
+testdata/inner.go:154:6: parameter 'f' at index 2 should be made into a pointer (func mapWrites(m map[string]Foo, p map[string]*Foo, f Foo)); 'Foo' is 48 bytes (declared at testdata/inner.go:22), max 16
+testdata/inner.go:155:2: writing to 'm' copies 'Foo' (48 bytes) into the map, and updating it copies it out and back again, use a map of pointers instead (func mapWrites(m map[string]Foo, p map[string]*Foo, f Foo))
+testdata/inner.go:156:2: 'v := m["a"]' copies 'Foo' (48 bytes), use a pointer to it instead (func mapWrites(m map[string]Foo, p map[string]*Foo, f Foo))
+testdata/inner.go:158:2: writing to 'm' copies 'Foo' (48 bytes) into the map, and updating it copies it out and back again, use a map of pointers instead (func mapWrites(m map[string]Foo, p map[string]*Foo, f Foo))
+testdata/inner.go:160:6: every lookup, store, and range of a map of 'Foo' (48 bytes) copies whole values; 'map[string]*Foo' copies a word instead, but allocates each value and adds work for the garbage collector (func mapWrites(m map[string]Foo, p map[string]*Foo, f Foo))
+testdata/inner.go:164:2: parameter 'o' at index 0 should be made into a pointer (func (consumer).Consume(o other)); 'other' is 32 bytes (declared at testdata/inner.go:12), max 16
+testdata/inner.go:169:16: parameter 'o' at index 0 should be made into a pointer (func (*sink).Consume(o other)); 'other' is 32 bytes (declared at testdata/inner.go:12), max 16 [implements consumer]
+testdata/inner.go:173:6: parameter 'f' at index 0, and return value 'Foo' at index 0 should be made into pointers (func namedResults(f Foo, ok bool) (out Foo, err error)); 'Foo' is 48 bytes (declared at testdata/inner.go:22), max 16
+testdata/inner.go:175:3: assigning to named result 'out' copies 'Foo' (48 bytes) into it (func namedResults(f Foo, ok bool) (out Foo, err error))
+testdata/inner.go:182:62: every send and receive on a channel of 'other' (32 bytes) copies all of it, use 'chan *other' or a smaller message type instead (func ranges(os []other, ptrs []*other, m map[string]other, c chan other, arr *[2]other) (n int64))
+testdata/inner.go:183:2: range value 'o' copies 'other' (32 bytes) each iteration, range over the index and use the element in place, or over a slice of pointers instead (func ranges(os []other, ptrs []*other, m map[string]other, c chan other, arr *[2]other) (n int64))
+testdata/inner.go:192:2: range value 'o' copies 'other' (32 bytes) each iteration, range over the keys and use the element through the map, or use a map of pointers instead (func ranges(os []other, ptrs []*other, m map[string]other, c chan other, arr *[2]other) (n int64))
+testdata/inner.go:195:2: range value 'o' copies 'other' (32 bytes) each iteration, use a channel of pointers instead (func ranges(os []other, ptrs []*other, m map[string]other, c chan other, arr *[2]other) (n int64))
+testdata/inner.go:199:2: range value 'last' copies 'other' (32 bytes) each iteration, range over the index and use the element in place instead (func ranges(os []other, ptrs []*other, m map[string]other, c chan other, arr *[2]other) (n int64))
+testdata/inner.go:204:6: parameter 'o' at index 0 should be made into a pointer (func assigns(o other, p *other, os []other, box any) int64); 'other' is 32 bytes (declared at testdata/inner.go:12), max 16
+testdata/inner.go:205:2: 'x := o' copies 'other' (32 bytes), use a pointer to it instead (func assigns(o other, p *other, os []other, box any) int64)
+testdata/inner.go:206:2: 'x = *p' copies 'other' (32 bytes), use a pointer to it instead (func assigns(o other, p *other, os []other, box any) int64)
+testdata/inner.go:207:2: 'var y = os[0]' copies 'other' (32 bytes), use a pointer to it instead (func assigns(o other, p *other, os []other, box any) int64)
+testdata/inner.go:208:2: 'z := box.(other)' copies 'other' (32 bytes), use a pointer to it instead (func assigns(o other, p *other, os []other, box any) int64)
+testdata/inner.go:212:3: 'w = z' copies 'other' (32 bytes), use a pointer to it instead (func assigns(o other, p *other, os []other, box any) int64)
+testdata/inner.go:217:6: parameter 'o' at index 0 should be made into a pointer (func dynamicTypes(o other, c chan any) []any); 'other' is 32 bytes (declared at testdata/inner.go:12), max 16
+testdata/inner.go:218:6: storing 'o' boxes a copy of 'other' (32 bytes) into 'any', usually on the heap, use a pointer instead (func dynamicTypes(o other, c chan any) []any)
+testdata/inner.go:222:22: 'alias' may hold a boxed copy of 'other' (32 bytes), and appending it keeps the copy alive, box a pointer instead (func dynamicTypes(o other, c chan any) []any)
+testdata/inner.go:223:7: 'box' may hold a boxed copy of 'other' (32 bytes), and sending it keeps the copy alive, box a pointer instead (func dynamicTypes(o other, c chan any) []any)
+testdata/inner.go:224:10: 'alias' may hold a boxed copy of 'other' (32 bytes), and passing it to a goroutine keeps the copy alive, box a pointer instead (func dynamicTypes(o other, c chan any) []any)
+testdata/inner.go:226:8: 'box' may hold a boxed copy of 'other' (32 bytes), and capturing it in a goroutine keeps the copy alive, box a pointer instead (func dynamicTypes(o other, c chan any) []any)
+testdata/inner.go:232:12: 'v' may hold a boxed copy of 'other' (32 bytes), and putting it in a literal keeps the copy alive, box a pointer instead (func keep(v any))
+testdata/inner.go:236:2: call to 'CallsFoo' copies parameter 0 'Foo' (48 bytes) (func calls(f *Foo, o *other, apply func(other)))
+testdata/inner.go:237:2: call to 'f.OnOtherToo' copies the receiver 'Foo' (48 bytes), and parameter 0 'other' (32 bytes) (func calls(f *Foo, o *other, apply func(other)))
+testdata/inner.go:238:2: call to 'apply' copies parameter 0 'other' (32 bytes) (func calls(f *Foo, o *other, apply func(other)))
+testdata/inner.go:240:2: call to 'o.OnStruct' copies the receiver 'other' (32 bytes) (func calls(f *Foo, o *other, apply func(other)))
+testdata/inner.go:244:15: passing '*p' boxes a copy of 'other' (32 bytes) into 'any', usually on the heap, use a pointer instead (func boxings(p *other, c chan any, log func(args ...any)) any)
+testdata/inner.go:245:16: putting '*p' boxes a copy of 'other' (32 bytes) into 'any', usually on the heap, use a pointer instead (func boxings(p *other, c chan any, log func(args ...any)) any)
+testdata/inner.go:246:7: sending '*p' boxes a copy of 'other' (32 bytes) into 'any', usually on the heap, use a pointer instead (func boxings(p *other, c chan any, log func(args ...any)) any)
+testdata/inner.go:247:19: putting '*p' boxes a copy of 'other' (32 bytes) into 'any', usually on the heap, use a pointer instead (func boxings(p *other, c chan any, log func(args ...any)) any)
+testdata/inner.go:249:9: returning '*p' boxes a copy of 'other' (32 bytes) into 'any', usually on the heap, use a pointer instead (func boxings(p *other, c chan any, log func(args ...any)) any)
+testdata/inner.go:252:18: every send and receive on a channel of 'other' (32 bytes) copies all of it, use 'chan *other' or a smaller message type instead
+testdata/inner.go:255:2: sending '*o' copies 'other' (32 bytes) into the channel, use 'chan *other' or a smaller message type instead (func chans(o *other))
+testdata/inner.go:262:16: receiver should be made into a pointer (func (block).sum() (n int64)); 'block' is 64 bytes (declared at testdata/inner.go:260), max 16
+testdata/inner.go:269:6: return value '[32]byte' at index 0 should be made into a pointer (func digest(data []byte) [32]byte); '[32]byte' is 32 bytes, max 16
+testdata/inner.go:277:6: parameter 'o' at index 0, and parameter 'p' at index 1 should be made into pointers (func aliases(o otherAlias, p pairAlias)); 'otherAlias' is 32 bytes (declared at testdata/inner.go:273), 'pairAlias' is 64 bytes (declared at testdata/inner.go:275), max 16
+testdata/inner.go:281:2: 'c := *b' copies the 'block' (64 bytes) that parameter 'b' points to and 'b' isn't used again, use the pointer directly (func localArrays(b *block, rows [][4]int64) (n int64))
+testdata/inner.go:282:2: 'var d = c' copies 'block' (64 bytes), use a pointer to it instead (func localArrays(b *block, rows [][4]int64) (n int64))
+testdata/inner.go:283:2: range value 'row' copies '[4]int64' (32 bytes) each iteration, range over the index and use the element in place, or over a slice of pointers instead (func localArrays(b *block, rows [][4]int64) (n int64))
 `
+
+func TestCheckConcurrency(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/m\n\ngo 1.22\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for i := range 12 {
+		src := fmt.Sprintf(`package p%[1]d
+
+type big struct{ a, b, c int64 }
+
+type list[T any] struct{ items []T }
+
+func F%[1]d(b big) {}
+`, i)
+		p := filepath.Join(dir, fmt.Sprintf("p%d", i), "p.go")
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+
+	defer func(n int) { *concurrency = n }(*concurrency)
+	outputs := []string{}
+	for _, n := range []int{1, 8} {
+		*concurrency = n
+		fset := token.NewFileSet()
+		skips := newSkipLog()
+		sites, err := check([]string{"./..."}, fset, limits{max: 16}, &types.StdSizes{WordSize: 8, MaxAlign: 8}, shard{}, nil, skips)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := &bytes.Buffer{}
+		printSites(sites, fset, b, siteLabels{})
+		fmt.Fprint(b, skips.entities)
+		outputs = append(outputs, b.String())
+	}
+	if outputs[0] != outputs[1] {
+		t.Errorf("-concurrency 8 found:\n%s\nwant what -concurrency 1 found:\n%s", outputs[1], outputs[0])
+	}
+	if n := strings.Count(outputs[0], "should be made into a pointer"); n != 12 {
+		t.Errorf("found %d by-value signatures, want 12:\n%s", n, outputs[0])
+	}
+}
+
+func TestCheckStd(t *testing.T) {
+	sites, err := check([]string{"image"}, token.NewFileSet(), limits{max: 16}, &types.StdSizes{WordSize: 8, MaxAlign: 8}, shard{}, nil, newSkipLog())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	found := false
+	for _, site := range sites {
+		found = found || site.fun != nil && site.fun.FullName() == "(image.Rectangle).Add"
+	}
+	if !found {
+		t.Errorf("found %d sites in image, none for Rectangle.Add", len(sites))
+	}
+
+	// std matches the standard library without its vendored packages.
+	skips := newSkipLog()
+	pkgs, err := loadPackages([]string{"std"}, token.NewFileSet(), shard{index: 1, count: 200}, false, skips, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := skips.entities[skipOtherShard]
+	for _, pkg := range pkgs {
+		paths = append(paths, pkg.PkgPath)
+	}
+	for _, path := range paths {
+		if strings.HasPrefix(path, "vendor/") {
+			t.Errorf("std matched the vendored package %s", path)
+		}
+	}
+	if len(skips.entities[skipOtherShard]) < 100 {
+		t.Errorf("std matched %d packages of other shards, want the standard library's", len(skips.entities[skipOtherShard]))
+	}
+}
+
+func TestCacheLines(t *testing.T) {
+	sites, err := check([]string{"./testdata"}, token.NewFileSet(), limits{max: 16}, &types.StdSizes{WordSize: 8, MaxAlign: 8}, shard{}, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, test := range []struct {
+		size int64
+		want string
+	}{
+		{24, "[spans 1 cache line]"},
+		{32, "[spans 1 cache line]"},
+		{72, "[spans 3 cache lines]"},
+	} {
+		site := sites[0]
+		site.size = test.size
+		if got := site.message(siteLabels{cacheLineSize: 32}); !strings.HasSuffix(got, test.want) {
+			t.Errorf("%d bytes: got %q, want it labeled %s", test.size, got, test.want)
+		}
+	}
+	if got := sites[0].message(siteLabels{}); strings.Contains(got, "cache line") {
+		t.Errorf("got %q, want no cache line label without -cachelines", got)
+	}
+}
+
+func TestSingleCaller(t *testing.T) {
+	const src = `package a
+
+type Big struct{ a, b, c int64 }
+
+func once(b Big) {}
+
+func twice(b Big) {}
+
+func stored(b Big) {}
+
+var f = stored
+
+func Once(b Big) {}
+
+func run() {
+	once(Big{})
+	twice(Big{})
+	twice(Big{})
+	stored(Big{})
+	Once(Big{})
+}
+`
+	sites, _ := checkModule(t, map[string]string{"a.go": src})
+	single := []string{}
+	for _, site := range sites {
+		if site.singleCaller {
+			single = append(single, site.fun.Name())
+		}
+	}
+	if got := strings.Join(single, " "); got != "once" {
+		t.Errorf("got single-caller funcs %q, want only once", got)
+	}
+}
+
+// checkModule writes files to a temporary module, changes to its directory,
+// and returns the sites check finds in all of its packages.
+func checkModule(t *testing.T, files map[string]string) ([]copySite, *token.FileSet) {
+	t.Helper()
+	dir := t.TempDir()
+	if _, ok := files["go.mod"]; !ok {
+		files["go.mod"] = "module example.com/m\n\ngo 1.22\n"
+	}
+	for name, src := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+	fset := token.NewFileSet()
+	sites, err := check([]string{"./..."}, fset, limits{max: 16}, &types.StdSizes{WordSize: 8, MaxAlign: 8}, shard{}, nil, newSkipLog())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sites, fset
+}
+
+func TestCheckPatterns(t *testing.T) {
+	dir := t.TempDir()
+	const src = `package p
+
+type big struct{ a, b, c int64 }
+
+func F(b big) {}
+`
+	for _, name := range []string{"a/a.go", "b/b.go", "c/c.go", "README.md"} {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/m\n\ngo 1.22\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+
+	patterns := packagePatterns([]string{"c", "a", "./a/...", "README.md"})
+	if got := strings.Join(patterns, " "); got != "./c ./a ./a/..." {
+		t.Fatalf("packagePatterns = %q, want \"./c ./a ./a/...\"", got)
+	}
+	fset := token.NewFileSet()
+	sites, err := check(patterns, fset, limits{max: 16}, &types.StdSizes{WordSize: 8, MaxAlign: 8}, shard{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := []string{}
+	for _, site := range sites {
+		if site.check == checkSignature {
+			files = append(files, relPath(fset.Position(site.pos).Filename))
+		}
+	}
+	if got := strings.Join(files, " "); got != "a/a.go c/c.go" {
+		t.Errorf("found sites in %q, want \"a/a.go c/c.go\"", got)
+	}
+}
+
+func TestCheckTags(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.22\n",
+		"a.go":   "package a\n\ntype big struct{ a, b, c int64 }\n",
+		"tagged.go": `//go:build integration
+
+package a
+
+func F(b big) {}
+`,
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+
+	for _, tags := range []string{"", "integration"} {
+		*buildTags = tags
+		skips := newSkipLog()
+		sites, err := check([]string{"."}, token.NewFileSet(), limits{max: 16}, &types.StdSizes{WordSize: 8, MaxAlign: 8}, shard{}, nil, skips)
+		*buildTags = ""
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, wantSkipped := 0, 1
+		if tags != "" {
+			want, wantSkipped = 1, 0
+		}
+		if len(sites) != want || len(skips.entities[skipConstrained]) != wantSkipped {
+			t.Errorf("-tags %q: found %d sites and skipped %v, want %d sites and %d skipped files", tags, len(sites), skips.entities[skipConstrained], want, wantSkipped)
+		}
+	}
+}
+
+func TestCheckLenient(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.22\n",
+		"a.go": `package a
+
+type big struct{ a, b, c int64 }
+
+func F(b big) {}
+
+func G(b big) { undefined(b) }
+`,
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+
+	if _, err := check([]string{"."}, token.NewFileSet(), limits{max: 16}, &types.StdSizes{WordSize: 8, MaxAlign: 8}, shard{}, nil, newSkipLog()); err == nil {
+		t.Fatal("check of a package with type errors succeeded without -lenient")
+	}
+	*lenient = true
+	defer func() { *lenient = false }()
+	skips := newSkipLog()
+	sites, err := check([]string{"."}, token.NewFileSet(), limits{max: 16}, &types.StdSizes{WordSize: 8, MaxAlign: 8}, shard{}, nil, skips)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sites) != 2 {
+		t.Errorf("found %d sites, want the signatures of F and G", len(sites))
+	}
+	if partial := skips.entities[skipPartialPkg]; len(partial) != 1 || !strings.Contains(partial[0], "undefined") {
+		t.Errorf("recorded %v as partial, want the package with its error", partial)
+	}
+}
+
+func TestCheckExclude(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":                "module example.com/m\n\ngo 1.22\n",
+		"a.go":                  "package a\n\nimport \"example.com/m/internal/gen\"\n\ntype big struct{ gen.Big }\n\nfunc F(b big) {}\n",
+		"internal/gen/gen.go":   "package gen\n\ntype Big struct{ a, b, c int64 }\n\nfunc G(b Big) {}\n",
+		"internal/gen/v2/v2.go": "package v2\n\ntype Big struct{ a, b, c int64 }\n\nfunc H(b Big) {}\n",
+	}
+	for name, src := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+	*excludePatterns = stringsFlag{".../internal/gen/..."}
+	defer func() { *excludePatterns = nil }()
+
+	skips := newSkipLog()
+	sites, err := check([]string{"./..."}, token.NewFileSet(), limits{max: 16}, &types.StdSizes{WordSize: 8, MaxAlign: 8}, shard{}, nil, skips)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sites) != 1 || sites[0].fun.Name() != "F" {
+		t.Errorf("found %v, want the signature of F only", sites)
+	}
+	if excluded := skips.entities[skipExcludedLoad]; len(excluded) != 2 {
+		t.Errorf("recorded %v as excluded, want both generated packages", excluded)
+	}
+	// A run that excludes every package it matches finds nothing.
+	sites, err = check([]string{"./internal/..."}, token.NewFileSet(), limits{max: 16}, &types.StdSizes{WordSize: 8, MaxAlign: 8}, shard{}, nil, newSkipLog())
+	if err != nil || len(sites) != 0 {
+		t.Errorf("check of excluded packages = %v, %v, want nothing", sites, err)
+	}
+}
+
+func TestCheckTests(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":    "module example.com/m\n\ngo 1.22\n",
+		"a.go":      "package a\n\ntype Big struct{ a, b, c int64 }\n",
+		"a_test.go": "package a\n\nfunc helper(b Big) {}\n",
+		"x_test.go": "package a_test\n\nimport \"example.com/m\"\n\nfunc helper(b a.Big) {}\n",
+		"only/o_test.go": `package only
+
+type big struct{ a, b, c int64 }
+
+func helper(b big) {}
+`,
+	}
+	for name, src := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+
+	*tests = true
+	defer func() { *tests = false }()
+	fset := token.NewFileSet()
+	sites, err := check([]string{"./..."}, fset, limits{max: 16}, &types.StdSizes{WordSize: 8, MaxAlign: 8}, shard{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := []string{}
+	for _, site := range sites {
+		if site.check == checkSignature {
+			found = append(found, relPath(fset.Position(site.pos).Filename))
+		}
+	}
+	if got := strings.Join(found, " "); got != "a_test.go only/o_test.go x_test.go" {
+		t.Errorf("found sites in %q, want \"a_test.go only/o_test.go x_test.go\"", got)
+	}
+}
+
+func TestCheckCallCounts(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.22\n",
+		"a/a.go": `package a
+
+type Big struct{ a, b, c int64 }
+
+func Load(b Big) {}
+
+func init() { Load(Big{}) }
+`,
+		"b/b.go": `package b
+
+import "example.com/m/a"
+
+func run(b *a.Big) {
+	a.Load(*b)
+	a.Load(*b)
+}
+`,
+	}
+	for name, src := range files {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+
+	sites, err := check([]string{"./..."}, token.NewFileSet(), limits{max: 16}, &types.StdSizes{WordSize: 8, MaxAlign: 8}, shard{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := 0
+	for _, site := range sites {
+		if site.check != checkSignature {
+			continue
+		}
+		found++
+		if site.calls != 3 {
+			t.Errorf("%s has %d calls, want the 3 in both packages", site.fun.Name(), site.calls)
+		}
+	}
+	if found != 1 {
+		t.Errorf("found %d signature sites, want Load's", found)
+	}
+}
@@ -0,0 +1,210 @@
+package copyfighter
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// The checks that find copySites.
+const (
+	checkSignature      = "signature"
+	checkSelect         = "select"
+	checkCapture        = "capture"
+	checkLiteral        = "literal"
+	checkDuplicate      = "duplicate"
+	checkField          = "field"
+	checkDeref          = "deref"
+	checkBoxedReceiver  = "boxed-receiver"
+	checkInstantiation  = "instantiation"
+	checkMapWrite       = "map-write"
+	checkNamedResult    = "named-result"
+	checkRange          = "range"
+	checkAssign         = "assign"
+	checkDynamicType    = "dynamic-type"
+	checkDependencyCall = "dependency-call"
+	checkCall           = "call"
+	checkBoxing         = "boxing"
+	checkChan           = "chan"
+	checkContainer      = "container"
+)
+
+// docsURL is where the checks are documented for readers of the structured
+// output formats.
+const docsURL = "https://github.com/lalaladema/copyfighter#checks"
+
+// checkInfo describes a check to people reading its findings.
+type checkInfo struct {
+	name        string
+	description string
+	rationale   string
+}
+
+// checks maps each check ID to its description.
+var checks = map[string]checkInfo{
+	checkSignature: {
+		name:        "Large struct passed by value",
+		description: "A receiver, parameter, or result is a wide value instead of a pointer to one.",
+		rationale: "Every call copies its receiver, arguments, and results. Wide values passed by value " +
+			"are copied on each call, costing memory bandwidth and, when they escape, allocations.",
+	},
+	checkInstantiation: {
+		name:        "Generic func instantiated with large structs",
+		description: "A generic func's type-parameter receiver, parameters, or results are wide in some of its instantiations.",
+		rationale: "An instantiation copies its type arguments' values like any other func. Reporting " +
+			"each instantiation separately repeats the same finding, so they are listed together on " +
+			"the generic func. A generic func declared in another package can't be fixed from here, " +
+			"so each of its instantiations is reported where it's made.",
+	},
+	checkSelect: {
+		name:        "Large struct sent or received in select",
+		description: "A select case sends or receives a wide value over a channel.",
+		rationale: "Selects usually run in a loop, and each send or receive copies the whole value " +
+			"into or out of the channel's buffer. A channel of pointers copies one word instead.",
+	},
+	checkCapture: {
+		name:        "Large range value captured by a goroutine",
+		description: "A range loop's wide value variable is captured by a func started as a goroutine or handed to a worker pool.",
+		rationale: "The range value is a copy of the element made on every iteration, and capturing it " +
+			"usually moves it to the heap as well. Ranging over the index and capturing a pointer to the " +
+			"element avoids both.",
+	},
+	checkLiteral: {
+		name:        "Large value copied into a struct literal",
+		description: "A field of a struct literal is set to an existing wide value.",
+		rationale: "Setting the field copies the whole value into the new struct, and every copy of " +
+			"the struct copies it again. A pointer field shares the existing value.",
+	},
+	checkDuplicate: {
+		name:        "Duplicate wide struct types",
+		description: "Wide struct types in several packages have identical fields, tags included.",
+		rationale: "Copied DTOs produce the same findings in every package that declares them, and " +
+			"converting between them copies the whole value. Consolidating them into one type fixes " +
+			"the findings once.",
+	},
+	checkField: {
+		name:        "Struct field holds a large struct by value",
+		description: "A struct field holds a wide struct by value, or a struct embeds one.",
+		rationale: "The field's size is part of the outer struct's, so it multiplies every copy of the " +
+			"outer struct. A pointer field shrinks it to one word.",
+	},
+	checkDeref: {
+		name:        "Pointer to a large struct dereferenced into a copy",
+		description: "A func takes a pointer to a wide value but starts by copying the value out of it and never uses the pointer again.",
+		rationale: "The pointer was meant to avoid copying the value, but the copy still happens at the " +
+			"start of every call. Use the fields through the pointer instead.",
+	},
+	checkBoxedReceiver: {
+		name:        "Large struct boxed into an interface its methods are called through",
+		description: "A wide value is stored in a variable of an interface type with methods, which are then called through the variable.",
+		rationale: "Storing the value in the interface copies it, usually to the heap, and every call " +
+			"through the interface runs on that copy, so it never sees updates to the original. " +
+			"Storing a pointer copies one word and shares the value.",
+	},
+	checkContainer: {
+		name:        "Slice or map of large structs",
+		description: "A type declaration, variable declaration, or composite literal has a slice or map type whose element is a wide value.",
+		rationale: "Indexing the slice or map into a variable, appending to the slice, and ranging " +
+			"over either copies whole elements, and map values can't even be updated in place. A " +
+			"slice or map of pointers copies a word instead, but allocates every element on its " +
+			"own, gives the garbage collector more to scan, and loses the locality of elements " +
+			"stored side by side, so it pays off where elements are copied more often than created.",
+	},
+	checkMapWrite: {
+		name:        "Large struct written into a map",
+		description: "An assignment stores a wide value into a map element.",
+		rationale: "The write copies the whole value into the map's bucket. Map elements can't be " +
+			"updated in place, so changing one means copying it out, changing the copy, and " +
+			"writing it back. A map of pointers copies one word and can be updated through it.",
+	},
+	checkNamedResult: {
+		name:        "Large struct held in a named result",
+		description: "A func assigns an existing value to a named result of a wide type.",
+		rationale: "The named result is a variable of its own, so every return copies it out to the " +
+			"caller, and assigning another value to it copies that value in first. Returning a " +
+			"pointer, or an unnamed result built in the return statement, avoids the copies.",
+	},
+	checkRange: {
+		name:        "Large struct copied by a range loop",
+		description: "A range loop's value variable holds a copy of each wide element of a slice, array, map, or channel.",
+		rationale: "Every iteration copies the whole element into the variable before the body runs, " +
+			"whether or not the body uses all of it. Ranging over the index and using the element in " +
+			"place, or ranging over pointers, copies nothing or one word.",
+	},
+	checkAssign: {
+		name:        "Large struct copied by an assignment",
+		description: "An assignment or variable declaration in a func body copies an existing wide value.",
+		rationale: "Assigning a value copies all of it, even when the code only reads a few fields " +
+			"of the copy. Taking a pointer to the value shares it instead. Assignments are " +
+			"everywhere, so the check only runs with -assignments.",
+	},
+	checkDynamicType: {
+		name:        "Interface holding a large struct kept in a container or goroutine",
+		description: "An interface variable that may hold a boxed wide value is stored in a slice, map, channel, or literal, or handed to a goroutine.",
+		rationale: "Boxing a value copies all of it to the heap, and storing the interface keeps that " +
+			"copy alive as long as the container or goroutine, though the interface itself is two " +
+			"words. Boxing a pointer shares the value instead. Which values a variable may hold is " +
+			"found by data flow within the package, so the check only runs with -dynamic-types.",
+	},
+	checkDependencyCall: {
+		name:        "Large struct copied by a call into a dependency",
+		description: "A call passes a wide receiver or parameter by value to a func of a dependency whose signature takes it that way.",
+		rationale: "The copy is the dependency's design rather than the caller's, so it can only be " +
+			"avoided by wrapping the API, calling another one, or replacing the dependency. " +
+			"Counting the calls and the bytes they copy per dependency shows what each costs. " +
+			"The check only runs with -run-checks-on-deps.",
+	},
+	checkBoxing: {
+		name:        "Large struct converted to an interface",
+		description: "A wide value is converted to an interface type, explicitly or by being assigned, returned, passed, sent, or put in a literal where an interface is expected.",
+		rationale: "An interface holds a pointer to its dynamic value, so converting a wide value to one " +
+			"copies it, usually to the heap, on every conversion. Converting a pointer copies one " +
+			"word and allocates nothing. Statements the boxed-receiver check reports aren't " +
+			"reported again.",
+	},
+	checkChan: {
+		name:        "Channel of large structs",
+		description: "A channel type's element is a wide value, or a send outside a select copies one into a channel.",
+		rationale: "Every send copies the whole element into the channel's buffer and every receive " +
+			"copies it out again, so a busy channel copies it over and over. A channel of pointers, " +
+			"or of a smaller message type, copies a word or a few. Sends in selects are reported by " +
+			"the select check.",
+	},
+	checkCall: {
+		name:        "Large struct copied by a call",
+		description: "A call passes a wide receiver or argument to a func, method, or func value that takes it by value.",
+		rationale: "The signature check reports where a copy is declared, but the copy happens at every " +
+			"call, including calls into dependencies and the standard library whose signatures can't " +
+			"be changed. Listing the calls shows where the copies are made in the package's own code. " +
+			"The check only runs with -calls.",
+	},
+}
+
+// checkIDs returns the IDs of the checks, sorted.
+func checkIDs() []string {
+	ids := make([]string, 0, len(checks))
+	for id := range checks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// explain writes the description and rationale of the check with the given
+// ID, or a list of the checks if id is empty.
+func explain(w io.Writer, id string) error {
+	if id == "" {
+		for _, id := range checkIDs() {
+			if _, err := fmt.Fprintf(w, "%-10s %s\n", id, checks[id].name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	info, ok := checks[id]
+	if !ok {
+		return fmt.Errorf("unknown check %q, known checks are %v", id, checkIDs())
+	}
+	_, err := fmt.Fprintf(w, "%s: %s\n\n%s\n\n%s\n\nSee %s\n", id, info.name, info.description, info.rationale, docsURL)
+	return err
+}
@@ -0,0 +1,23 @@
+package copyfighter
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	for _, id := range []string{checkSignature, checkSelect, checkCapture, checkLiteral, checkDuplicate, checkField, checkDeref, checkBoxedReceiver, checkInstantiation, checkMapWrite, checkNamedResult, checkRange, checkAssign, checkDynamicType, checkDependencyCall, checkCall, checkBoxing, checkChan, checkContainer} {
+		b := &bytes.Buffer{}
+		if err := explain(b, id); err != nil {
+			t.Errorf("explain(%q): %s", id, err)
+			continue
+		}
+		if !strings.HasPrefix(b.String(), id+": ") {
+			t.Errorf("explain(%q) = %q, want it to start with the ID", id, b.String())
+		}
+	}
+	if err := explain(&bytes.Buffer{}, "bogus"); err == nil {
+		t.Error("explain of an unknown check succeeded")
+	}
+}
@@ -0,0 +1,73 @@
+package copyfighter
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+// The parts of the Checkstyle XML report that writeCheckstyle uses.
+type (
+	checkstyleReport struct {
+		XMLName xml.Name         `xml:"checkstyle"`
+		Version string           `xml:"version,attr"`
+		Files   []checkstyleFile `xml:"file"`
+	}
+	checkstyleFile struct {
+		Name   string            `xml:"name,attr"`
+		Errors []checkstyleError `xml:"error"`
+	}
+	checkstyleError struct {
+		Line     int    `xml:"line,attr"`
+		Column   int    `xml:"column,attr"`
+		Severity string `xml:"severity,attr"`
+		Message  string `xml:"message,attr"`
+		// Source is the check ID after "copyfighter.", the way Checkstyle
+		// names a check by its module.
+		Source string `xml:"source,attr"`
+	}
+)
+
+// checkstyleSeverities map the severities of sites to those of errors.
+var checkstyleSeverities = map[Severity]string{
+	SeverityNote:    "info",
+	SeverityWarning: "warning",
+	SeverityError:   "error",
+}
+
+// writeCheckstyle writes the sites as a Checkstyle XML report, with a file
+// element per file holding an error element per site, as Jenkins and other
+// CI systems read it. Messages start with the check ID and the widest type's
+// size, which the format has no attributes for.
+func writeCheckstyle(w io.Writer, r *report) error {
+	out := checkstyleReport{Version: "4.3", Files: []checkstyleFile{}}
+	names, sites := r.sitesByFile()
+	for _, name := range names {
+		f := checkstyleFile{Name: name}
+		for _, site := range sites[name] {
+			position := r.fset.Position(site.pos)
+			f.Errors = append(f.Errors, checkstyleError{
+				Line:     position.Line,
+				Column:   position.Column,
+				Severity: checkstyleSeverities[r.tiers.of(site)],
+				Message:  site.labeledMessage(r.labels),
+				Source:   "copyfighter." + site.check,
+			})
+		}
+		out.Files = append(out.Files, f)
+	}
+	return writeXML(w, out)
+}
+
+// writeXML writes v as an indented XML document.
+func writeXML(w io.Writer, v any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
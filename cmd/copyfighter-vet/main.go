@@ -0,0 +1,13 @@
+// Command copyfighter-vet runs copyfighter's analyzer as a vet tool:
+//
+//	go vet -vettool=$(which copyfighter-vet) ./...
+package main
+
+import (
+	"github.com/lalaladema/copyfighter/analyzer"
+	"golang.org/x/tools/go/analysis/unitchecker"
+)
+
+func main() {
+	unitchecker.Main(analyzer.Analyzer)
+}
@@ -0,0 +1,8 @@
+// Command copyfighter reports Go funcs that pass large structs by value.
+package main
+
+import "github.com/lalaladema/copyfighter"
+
+func main() {
+	copyfighter.Main()
+}
@@ -0,0 +1,90 @@
+package copyfighter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// The parts of a Code Climate issue that GitLab's Code Quality reports use.
+type (
+	codeClimateIssue struct {
+		Type        string              `json:"type"`
+		CheckName   string              `json:"check_name"`
+		Description string              `json:"description"`
+		Categories  []string            `json:"categories"`
+		Severity    string              `json:"severity"`
+		Fingerprint string              `json:"fingerprint"`
+		Location    codeClimateLocation `json:"location"`
+	}
+	codeClimateLocation struct {
+		Path  string           `json:"path"`
+		Lines codeClimateLines `json:"lines"`
+	}
+	codeClimateLines struct {
+		Begin int `json:"begin"`
+	}
+)
+
+// codeClimateSeverities map the severities of sites to those of issues.
+var codeClimateSeverities = map[Severity]string{
+	SeverityNote:    "info",
+	SeverityWarning: "minor",
+	SeverityError:   "major",
+}
+
+// writeCodeClimate writes the sites as a JSON array of Code Climate issues,
+// which GitLab reads as a Code Quality report and shows in merge requests.
+func writeCodeClimate(w io.Writer, r *report) error {
+	issues := []codeClimateIssue{}
+	seen := make(map[string]int)
+	for _, site := range r.sites {
+		position := r.fset.Position(site.pos)
+		issues = append(issues, codeClimateIssue{
+			Type:        "issue",
+			CheckName:   site.check,
+			Description: site.message(r.labels),
+			Categories:  []string{"Performance"},
+			Severity:    codeClimateSeverities[r.tiers.of(site)],
+			Fingerprint: site.fingerprint(seen),
+			Location: codeClimateLocation{
+				Path:  relPath(position.Filename),
+				Lines: codeClimateLines{Begin: position.Line},
+			},
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(issues)
+}
+
+// fingerprint returns the hash that tells site apart from the other sites of
+// a report, made of its package, check, func or type, and what it copies,
+// like the parameters of a by-value signature, so that it stays the same
+// when lines move or the func moves to another file of its package. Sites that
+// share all of those are numbered in the order they come in, counted in seen.
+func (site copySite) fingerprint(seen map[string]int) string {
+	id := site.check
+	if pkg := sitePkg(site); pkg != nil {
+		id = pkg.Path() + "\t" + id
+	}
+	switch {
+	case site.fun != nil:
+		id += "\t" + site.fun.FullName()
+	case site.decl != nil:
+		id += "\t" + site.decl.Name()
+	}
+	if site.what != "" {
+		id += "\t" + site.what
+	} else {
+		id += "\t" + sentence(site.shouldBe)
+	}
+	seen[id]++
+	if n := seen[id]; n > 1 {
+		id += fmt.Sprintf("\t%d", n)
+	}
+	h := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,179 @@
+package copyfighter
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strings"
+)
+
+// confidence is how sure a site is that the compiler keeps its copies. The
+// zero value is unknownCopy, which is the confidence of a site nothing is
+// known about.
+type confidence int
+
+const (
+	unknownCopy confidence = iota
+	likelyOptimized
+	definitelyCopied
+)
+
+// confidenceNames are the confidences as -min-confidence takes them.
+var confidenceNames = map[confidence]string{
+	likelyOptimized:  "likely-optimized",
+	unknownCopy:      "unknown",
+	definitelyCopied: "definitely-copied",
+}
+
+// confidenceRanks orders the confidences from least to most sure the copy
+// happens.
+var confidenceRanks = map[confidence]int{
+	likelyOptimized:  0,
+	unknownCopy:      1,
+	definitelyCopied: 2,
+}
+
+// parseConfidence parses a -min-confidence value.
+func parseConfidence(s string) (confidence, error) {
+	for c, name := range confidenceNames {
+		if s == name {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown confidence %#v, must be one of: likely-optimized, unknown, definitely-copied", s)
+}
+
+// atLeast returns true if c is as sure as min that the copy happens.
+func (c confidence) atLeast(min confidence) bool {
+	return confidenceRanks[c] >= confidenceRanks[min]
+}
+
+// label returns the label -confidence adds to messages.
+func (c confidence) label() string {
+	return " [" + strings.ReplaceAll(confidenceNames[c], "-", " ") + "]"
+}
+
+// inlineBudget is the cost up to which the gc compiler inlines a func, and
+// callCost what it adds for each call in the func's body, assuming the callee
+// isn't inlined itself. Costs here are estimated by counting syntax nodes
+// rather than the compiler's IR nodes.
+const (
+	inlineBudget = 80
+	callCost     = 57
+)
+
+// addConfidence sets how sure each signature site is that its copies are
+// made. A copy is likely optimized away if its func is never called, because
+// the linker drops it, or if the func is small enough to be inlined into
+// every caller, because the compiler can then use the caller's value in place.
+// It's definitely made if the func is too big to inline, or if the body
+// takes the address of a flagged value or captures it in a func literal,
+// which moves the copy to the heap. Other sites, like those of funcs also
+// used as values or called through interfaces, are unknown.
+func addConfidence(sites []copySite, files []*ast.File, info *types.Info, calls map[*types.Func]int) {
+	decls := make(map[*types.Func]*ast.FuncDecl)
+	for _, file := range files {
+		for _, d := range file.Decls {
+			if fd, ok := d.(*ast.FuncDecl); ok {
+				if fun, ok := info.Defs[fd.Name].(*types.Func); ok {
+					decls[fun] = fd
+				}
+			}
+		}
+	}
+	for i := range sites {
+		site := &sites[i]
+		decl := decls[site.fun]
+		if site.check != checkSignature || decl == nil || decl.Body == nil {
+			continue
+		}
+		switch {
+		case isDead(site.fun, calls[site.fun]+site.refs):
+			site.confidence = likelyOptimized
+		case escapes(decl, flaggedVars(site.fun, *site), info):
+			site.confidence = definitelyCopied
+		case !inlinable(decl, info):
+			site.confidence = definitelyCopied
+		case site.refs == 0 && len(site.satisfactions) == 0:
+			site.confidence = likelyOptimized
+		}
+	}
+}
+
+// isDead returns true if fun is an unexported func, not a method, that isn't
+// used in its package.
+func isDead(fun *types.Func, uses int) bool {
+	if fun.Exported() || fun.Type().(*types.Signature).Recv() != nil || uses > 0 {
+		return false
+	}
+	return fun.Name() != "init" && !(fun.Name() == "main" && fun.Pkg().Name() == "main")
+}
+
+// escapes returns true if the body of decl takes the address of any of vars,
+// or of their fields or elements, or uses them in a func literal.
+func escapes(decl *ast.FuncDecl, vars []*types.Var, info *types.Info) bool {
+	for _, v := range vars {
+		if takesAddress(decl.Body, v, info) || usedInFuncLit(decl.Body, v, info) {
+			return true
+		}
+	}
+	return false
+}
+
+// usedInFuncLit returns true if v is used in a func literal in body.
+func usedInFuncLit(body *ast.BlockStmt, v *types.Var, info *types.Info) bool {
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		if lit, ok := n.(*ast.FuncLit); ok {
+			found = found || refersTo(lit.Body, v, info)
+		}
+		return !found
+	})
+	return found
+}
+
+// refersTo returns true if n uses v.
+func refersTo(n ast.Node, v *types.Var, info *types.Info) bool {
+	found := false
+	ast.Inspect(n, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && info.Uses[id] == v {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// inlinable estimates whether the gc compiler inlines decl: it isn't marked
+// //go:noinline, doesn't defer, start goroutines, select, or recover, and
+// its cost is within inlineBudget.
+func inlinable(decl *ast.FuncDecl, info *types.Info) bool {
+	if decl.Doc != nil {
+		for _, c := range decl.Doc.List {
+			if strings.HasPrefix(c.Text, "//go:noinline") {
+				return false
+			}
+		}
+	}
+	cost := 0
+	ok := true
+	ast.Inspect(decl.Body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case nil:
+			return false
+		case *ast.DeferStmt, *ast.GoStmt, *ast.SelectStmt:
+			ok = false
+		case *ast.CallExpr:
+			if tv, found := info.Types[n.Fun]; found && (tv.IsType() || tv.IsBuiltin()) {
+				if id, isIdent := ast.Unparen(n.Fun).(*ast.Ident); isIdent && id.Name == "recover" {
+					ok = false
+				}
+			} else {
+				cost += callCost
+			}
+		}
+		cost++
+		return ok && cost <= inlineBudget
+	})
+	return ok && cost <= inlineBudget
+}
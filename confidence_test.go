@@ -0,0 +1,81 @@
+package copyfighter
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"testing"
+)
+
+func TestConfidence(t *testing.T) {
+	const src = `package p
+
+type big struct{ a, b, c, d int64 }
+
+func unused(b big) int64 { return b.a }
+
+func Small(b big) int64 { return b.a + b.b }
+
+func Escapes(b big) *int64 { return &b.a }
+
+func Captured(b big) func() int64 { return func() int64 { return b.a } }
+
+func Loop(bs []big, b big) int64 {
+	var n int64
+	for _, x := range bs {
+		n += x.a * b.a
+	}
+	sink(n)
+	sink(n)
+	return n
+}
+
+func sink(int64) {}
+
+func Tiny(b big) int64 { return b.c }
+
+var Value = Small
+
+//go:noinline
+func NoInline(b big) int64 { return b.a }
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &types.Info{
+		Types:      make(map[ast.Expr]types.TypeAndValue),
+		Defs:       make(map[*ast.Ident]types.Object),
+		Uses:       make(map[*ast.Ident]types.Object),
+		Selections: make(map[*ast.SelectorExpr]*types.Selection),
+		Instances:  make(map[*ast.Ident]types.Instance),
+	}
+	sizes := &types.StdSizes{WordSize: 8, MaxAlign: 8}
+	files := []*ast.File{file}
+	if _, err := (&types.Config{Sizes: sizes}).Check("p", fset, files, info); err != nil {
+		t.Fatal(err)
+	}
+	decls := collectDecls(files, info, fset, sizes, 16, nil)
+	sites := findSites(files, info, decls, wideTypes{named: decls.named, sizes: sizes}, limits{max: 16}, countCalls(files, info))
+	got := make(map[string]confidence)
+	for _, site := range sites {
+		if site.check == checkSignature {
+			got[site.fun.Name()] = site.confidence
+		}
+	}
+	for name, want := range map[string]confidence{
+		"unused":   likelyOptimized,
+		"Small":    unknownCopy,
+		"Tiny":     likelyOptimized,
+		"Escapes":  definitelyCopied,
+		"Captured": definitelyCopied,
+		"Loop":     definitelyCopied,
+		"NoInline": definitelyCopied,
+	} {
+		if got[name] != want {
+			t.Errorf("confidence of %s = %s, want %s", name, confidenceNames[got[name]], confidenceNames[want])
+		}
+	}
+}
@@ -0,0 +1,508 @@
+package copyfighter
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/types"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// configFileName is the file, at the root of the analyzed module, that
+// configures a run.
+const configFileName = ".copyfighter.yml"
+
+// config is what a config file sets. Settings the file leaves out are zero.
+type config struct {
+	// flags are the values of the flags the file sets, by flag name.
+	flags map[string]string
+	// excludePackages are the patterns of the packages whose findings
+	// aren't reported.
+	excludePackages []string
+	// excludeTypes are the patterns of the types that findings aren't
+	// reported about.
+	excludeTypes []string
+	// packageWeights are the weights of the packages matching each
+	// pattern, which their findings' sizes are multiplied by.
+	packageWeights map[string]float64
+}
+
+// configFlags maps the keys of a config file that set a flag to the flag.
+var configFlags = map[string]string{
+	"max":       "max",
+	"check-max": "check-max",
+	"check":     "check",
+	"word-size": "wordSize",
+	"max-align": "maxAlign",
+	"format":    "format",
+}
+
+// configDir returns the directory to look for the config file of a run on
+// the pattern p in: the root of the module of the directory p starts at, or
+// of the working directory for import path patterns. Outside of any module,
+// it's the directory itself.
+func configDir(p string) string {
+	dir, ok := patternDir(p)
+	if !ok {
+		dir = "."
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "."
+	}
+	if root, ok := moduleRoot(dir); ok {
+		return root
+	}
+	return dir
+}
+
+// readConfig reads the config file in dir. A missing file sets nothing.
+func readConfig(dir string) (config, error) {
+	p := filepath.Join(dir, configFileName)
+	data, err := os.ReadFile(p)
+	if os.IsNotExist(err) {
+		return config{}, nil
+	}
+	if err != nil {
+		return config{}, fmt.Errorf("unable to read config file: %s", err)
+	}
+	return parseConfig(relPath(p), data)
+}
+
+// parseConfig parses the config file named name. It takes the part of YAML
+// that a flat map of settings needs: scalars, which may be quoted, lists
+// given either inline in brackets or as indented "- " items, and maps of
+// check IDs to sizes for check-max and of package patterns to weights for
+// package-weights, with comments starting with "#".
+func parseConfig(name string, data []byte) (config, error) {
+	c := config{flags: make(map[string]string)}
+	var (
+		key     string
+		keyLine int
+		items   []string
+		pairs   map[string]string
+	)
+	// finish applies the key whose value is on the lines after it.
+	finish := func() error {
+		if key == "" {
+			return nil
+		}
+		var err error
+		if pairs != nil {
+			err = c.setMap(key, pairs)
+		} else {
+			err = c.set(key, "", items)
+		}
+		if err != nil {
+			return fmt.Errorf("%s:%d: %s", name, keyLine, err)
+		}
+		key, items, pairs = "", nil, nil
+		return nil
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := stripComment(scanner.Text())
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		errorf := func(format string, args ...any) error {
+			return fmt.Errorf("%s:%d: %s", name, line, fmt.Sprintf(format, args...))
+		}
+		if text[0] == ' ' || text[0] == '\t' {
+			if key == "" {
+				return config{}, errorf("unexpected indentation")
+			}
+			if item, ok := strings.CutPrefix(trimmed, "-"); ok && pairs == nil {
+				items = append(items, unquote(strings.TrimSpace(item)))
+				continue
+			}
+			k, v, ok := strings.Cut(trimmed, ":")
+			if !ok || items != nil {
+				return config{}, errorf("can't mix a list and a map in the value of %#v", key)
+			}
+			if pairs == nil {
+				pairs = make(map[string]string)
+			}
+			pairs[unquote(strings.TrimSpace(k))] = unquote(strings.TrimSpace(v))
+			continue
+		}
+		if err := finish(); err != nil {
+			return config{}, err
+		}
+		k, v, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			return config{}, errorf("want KEY: VALUE, got %#v", trimmed)
+		}
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if v == "" {
+			key, keyLine = k, line
+			continue
+		}
+		var err error
+		if list, ok := strings.CutPrefix(v, "["); ok {
+			list, ok = strings.CutSuffix(list, "]")
+			if !ok {
+				return config{}, errorf("unterminated list in the value of %#v", k)
+			}
+			items := []string{}
+			for _, item := range strings.Split(list, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, unquote(item))
+				}
+			}
+			err = c.set(k, "", items)
+		} else {
+			err = c.set(k, unquote(v), nil)
+		}
+		if err != nil {
+			return config{}, errorf("%s", err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return config{}, fmt.Errorf("unable to read config file: %s", err)
+	}
+	if err := finish(); err != nil {
+		return config{}, err
+	}
+	return c, nil
+}
+
+// stripComment removes the comment from a line of a config file: everything
+// from a "#" that starts the line or follows a space, outside of quotes.
+func stripComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return strings.TrimRight(line[:i], " \t")
+		}
+	}
+	return strings.TrimRight(line, " \t\r")
+}
+
+// unquote returns s without the quotes around it, if it has any.
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		if s[0] == '"' {
+			if u, err := strconv.Unquote(s); err == nil {
+				return u
+			}
+		}
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// set sets key to the scalar value, or to the list items if it isn't a
+// scalar.
+func (c *config) set(key, value string, items []string) error {
+	switch key {
+	case "exclude-packages":
+		if items == nil && value != "" {
+			items = []string{value}
+		}
+		c.excludePackages = append(c.excludePackages, items...)
+		return nil
+	case "exclude-types":
+		if items == nil && value != "" {
+			items = []string{value}
+		}
+		c.excludeTypes = append(c.excludeTypes, items...)
+		return nil
+	case "check":
+		if items != nil {
+			value = strings.Join(items, ",")
+		}
+		if _, _, err := parseChecks(value); err != nil {
+			return err
+		}
+		c.flags[key] = value
+		return nil
+	case "package-weights":
+		return fmt.Errorf("package-weights must be a map of package patterns to weights")
+	case "check-max":
+		if items != nil {
+			return fmt.Errorf("check-max must be a map of check IDs to sizes")
+		}
+		if _, err := parseLimits(value, 0); err != nil {
+			return err
+		}
+		c.flags[key] = value
+		return nil
+	}
+	name, ok := configFlags[key]
+	if !ok {
+		return fmt.Errorf("unknown setting %#v, known settings are %s", key, strings.Join(configKeys(), ", "))
+	}
+	if items != nil {
+		return fmt.Errorf("%s must be a single value", key)
+	}
+	if name != "format" {
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return fmt.Errorf("invalid %s %#v, must be a number of bytes", key, value)
+		}
+	}
+	c.flags[name] = value
+	return nil
+}
+
+// setMap sets key to the map pairs. Only check-max takes a map, of check IDs
+// to sizes, and package-weights, of package patterns to weights.
+func (c *config) setMap(key string, pairs map[string]string) error {
+	if key == "package-weights" {
+		if c.packageWeights == nil {
+			c.packageWeights = make(map[string]float64)
+		}
+		for pattern, w := range pairs {
+			weight, err := strconv.ParseFloat(w, 64)
+			if err != nil || weight <= 0 {
+				return fmt.Errorf("invalid weight %#v of %s, must be a positive number", w, pattern)
+			}
+			c.packageWeights[pattern] = weight
+		}
+		return nil
+	}
+	if key != "check-max" {
+		return fmt.Errorf("%s can't be a map", key)
+	}
+	ids := make([]string, 0, len(pairs))
+	for id := range pairs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for i, id := range ids {
+		ids[i] = id + "=" + pairs[id]
+	}
+	return c.set(key, strings.Join(ids, ","), nil)
+}
+
+// configKeys returns the keys a config file can set, sorted.
+func configKeys() []string {
+	keys := []string{"exclude-packages", "exclude-types", "package-weights"}
+	for key := range configFlags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// apply sets the flags that c sets but the command line doesn't give, so
+// the command line takes precedence over the config file.
+func (c config) apply() error {
+	for name, value := range c.flags {
+		if flagSet(name) {
+			continue
+		}
+		if err := commandLine.Set(name, value); err != nil {
+			return fmt.Errorf("invalid %s in %s: %s", name, configFileName, err)
+		}
+	}
+	return nil
+}
+
+// matchPackagePattern returns true if the package import path matches the
+// pattern, in which "..." matches any string, as in the go command's
+// patterns. A pattern ending in "/..." also matches the path before it.
+func matchPackagePattern(pattern, path string) bool {
+	re := regexp.QuoteMeta(pattern)
+	re = strings.ReplaceAll(re, `\.\.\.`, `.*`)
+	if strings.HasSuffix(re, `/.*`) {
+		re = strings.TrimSuffix(re, `/.*`) + `(/.*)?`
+	}
+	ok, err := regexp.MatchString("^"+re+"$", path)
+	return err == nil && ok
+}
+
+// defaultAllowlist are the patterns, as matchTypePattern matches them, of the
+// standard library types that are passed by value by convention, however
+// wide, and that findings aren't reported about unless -no-default-allowlist
+// is given.
+var defaultAllowlist = []string{
+	"time.Time",
+	"reflect.Value",
+	"net/netip.Addr",
+	"net/netip.AddrPort",
+	"net/netip.Prefix",
+	"log/slog.Attr",
+	"log/slog.Value",
+	"log/slog.Record",
+	"go/token.Position",
+	"image.Rectangle",
+	"database/sql.Null*",
+}
+
+// matchTypePattern returns true if the named type, qualified by its import
+// path like "net/http.Request", matches the pattern, in which "*" matches
+// any string.
+func matchTypePattern(pattern string, tn *types.TypeName) bool {
+	if tn.Pkg() == nil {
+		return false
+	}
+	re := strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, `.*`)
+	ok, err := regexp.MatchString("^"+re+"$", tn.Pkg().Path()+"."+tn.Name())
+	return err == nil && ok
+}
+
+// stringsFlag is the value of a flag that can be given several times.
+type stringsFlag []string
+
+// stringsVar defines a stringsFlag with the name and usage on commandLine.
+func stringsVar(name, usage string) *stringsFlag {
+	f := &stringsFlag{}
+	commandLine.Var(f, name, usage)
+	return f
+}
+
+func (f *stringsFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
+
+// regexpsFlag is the value of a flag that can be given several times, each
+// with a regular expression.
+type regexpsFlag []*regexp.Regexp
+
+// regexpsVar defines a regexpsFlag with the name and usage on commandLine.
+func regexpsVar(name, usage string) *regexpsFlag {
+	f := &regexpsFlag{}
+	commandLine.Var(f, name, usage)
+	return f
+}
+
+func (f *regexpsFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	exprs := []string{}
+	for _, re := range *f {
+		exprs = append(exprs, re.String())
+	}
+	return strings.Join(exprs, ",")
+}
+
+func (f *regexpsFlag) Set(s string) error {
+	re, err := regexp.Compile(s)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, re)
+	return nil
+}
+
+// matchTypeName returns true if one of res matches the name of the type tn,
+// qualified by its package's import path, like "example.com/m.Config".
+func (res regexpsFlag) matchTypeName(tn *types.TypeName) bool {
+	if tn.Pkg() == nil {
+		return false
+	}
+	for _, re := range res {
+		if re.MatchString(tn.Pkg().Path() + "." + tn.Name()) {
+			return true
+		}
+	}
+	return false
+}
+
+// value returns the value of the named flag for a run with c: the flag's if
+// the command line gives it, or else c's, or else the flag's default.
+func (c config) value(name string) string {
+	if v, ok := c.flags[name]; ok && !flagSet(name) {
+		return v
+	}
+	return commandLine.Lookup(name).Value.String()
+}
+
+// limits returns the limits of a run with c.
+func (c config) limits() (limits, error) {
+	max, err := strconv.ParseInt(c.value("max"), 10, 64)
+	if err != nil {
+		return limits{}, fmt.Errorf("invalid max %#v", c.value("max"))
+	}
+	l, err := parseLimits(c.value("check-max"), max)
+	if err != nil {
+		return limits{}, err
+	}
+	l.roles, l.off, err = parseChecks(c.value("check"))
+	return l, err
+}
+
+// sitePkg returns the package site is in.
+func sitePkg(site copySite) *types.Package {
+	switch {
+	case site.fun != nil:
+		return site.fun.Pkg()
+	case site.decl != nil:
+		return site.decl.Pkg()
+	}
+	return site.pkg
+}
+
+// inExcludedPackage returns true if site is in a package matching one of
+// patterns.
+func inExcludedPackage(site copySite, patterns []string) bool {
+	pkg := sitePkg(site)
+	return pkg != nil && excludedPackage(pkg.Path(), patterns)
+}
+
+// excludedPackage returns true if the import path matches one of patterns.
+func excludedPackage(path string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matchPackagePattern(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// packageWeight returns the weight of the package with the import path: that
+// of the longest of the patterns of weights that matches it, or 1 if none
+// does.
+func packageWeight(weights map[string]float64, path string) float64 {
+	weight, longest := 1.0, -1
+	for pattern, w := range weights {
+		if len(pattern) > longest && matchPackagePattern(pattern, path) {
+			weight, longest = w, len(pattern)
+		}
+	}
+	return weight
+}
+
+// aboutExcludedTypes returns true if site is about the declaration of a type
+// that excluded returns true for, or if all of its flagged values are of such
+// types.
+func aboutExcludedTypes(site copySite, excluded func(*types.TypeName) bool) bool {
+	if site.decl != nil && excluded(site.decl) {
+		return true
+	}
+	if len(site.values) == 0 {
+		return false
+	}
+	for _, v := range site.values {
+		named, ok := types.Unalias(v.typ).(*types.Named)
+		if !ok || !excluded(named.Origin().Obj()) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,158 @@
+package copyfighter
+
+import (
+	"go/token"
+	"go/types"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	const src = `# Shared by every CI job.
+max: 32
+word-size: 8 # amd64 and arm64
+format: "json"
+check-max:
+  map-write: 64
+  boxed-receiver: 8
+exclude-packages: [example.com/m/gen/..., "example.com/m/internal/pb"]
+exclude-types:
+  - "*.Config"
+  - example.com/m/proto.*
+package-weights:
+  example.com/m/internal/hotpath/...: 10
+  example.com/m/tools/...: 0.1
+`
+	cfg, err := parseConfig(configFileName, []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantFlags := map[string]string{
+		"max":       "32",
+		"wordSize":  "8",
+		"format":    "json",
+		"check-max": "boxed-receiver=8,map-write=64",
+	}
+	if !reflect.DeepEqual(cfg.flags, wantFlags) {
+		t.Errorf("flags = %v, want %v", cfg.flags, wantFlags)
+	}
+	if want := []string{"example.com/m/gen/...", "example.com/m/internal/pb"}; !reflect.DeepEqual(cfg.excludePackages, want) {
+		t.Errorf("excluded packages = %v, want %v", cfg.excludePackages, want)
+	}
+	if want := []string{"*.Config", "example.com/m/proto.*"}; !reflect.DeepEqual(cfg.excludeTypes, want) {
+		t.Errorf("excluded types = %v, want %v", cfg.excludeTypes, want)
+	}
+	if want := map[string]float64{"example.com/m/internal/hotpath/...": 10, "example.com/m/tools/...": 0.1}; !reflect.DeepEqual(cfg.packageWeights, want) {
+		t.Errorf("package weights = %v, want %v", cfg.packageWeights, want)
+	}
+	for path, want := range map[string]float64{"example.com/m/internal/hotpath": 10, "example.com/m/tools/gen": 0.1, "example.com/m": 1} {
+		if got := packageWeight(cfg.packageWeights, path); got != want {
+			t.Errorf("weight of %s = %v, want %v", path, got, want)
+		}
+	}
+	if r := newReport([]copySite{{size: 16}, {size: 16, weight: 10}}, token.NewFileSet()); r.sites[0].weight != 10 {
+		t.Errorf("report lists %+v first, want the site weighing 10", r.sites[0])
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	for src, want := range map[string]string{
+		"maximum: 32\n":                   `.copyfighter.yml:1: unknown setting "maximum", known settings are check, check-max, exclude-packages, exclude-types, format, max, max-align, package-weights, word-size`,
+		"max: wide\n":                     `.copyfighter.yml:1: invalid max "wide", must be a number of bytes`,
+		"check-max:\n  nope: 8\n":         `.copyfighter.yml:1: unknown check "nope" in check sizes, known checks are ` + strings.Join(checkIDs(), ", "),
+		"max: [1, 2]\n":                   `.copyfighter.yml:1: max must be a single value`,
+		"  max: 32\n":                     `.copyfighter.yml:1: unexpected indentation`,
+		"exclude-types:\n  - a\n  b: c\n": `.copyfighter.yml:3: can't mix a list and a map in the value of "exclude-types"`,
+		"package-weights:\n  a/...: x\n":  `.copyfighter.yml:1: invalid weight "x" of a/..., must be a positive number`,
+		"package-weights: 10\n":           `.copyfighter.yml:1: package-weights must be a map of package patterns to weights`,
+	} {
+		if _, err := parseConfig(configFileName, []byte(src)); err == nil || err.Error() != want {
+			t.Errorf("parsing %q: got error %v, want %s", src, err, want)
+		}
+	}
+}
+
+func TestMatchPackagePattern(t *testing.T) {
+	for _, tt := range []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"example.com/m/gen/...", "example.com/m/gen", true},
+		{"example.com/m/gen/...", "example.com/m/gen/v1", true},
+		{"example.com/m/gen/...", "example.com/m/generate", false},
+		{"example.com/.../pb", "example.com/m/api/pb", true},
+		{"example.com/m", "example.com/m/sub", false},
+	} {
+		if got := matchPackagePattern(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("matchPackagePattern(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestExcludeTypesFlag(t *testing.T) {
+	var res regexpsFlag
+	for _, expr := range []string{`^github.com/aws/aws-sdk-go/.*`, `\.Options$`} {
+		if err := res.Set(expr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := res.Set("("); err == nil {
+		t.Error("Set accepted an invalid regular expression")
+	}
+	named := func(path, name string) *types.Named {
+		tn := types.NewTypeName(token.NoPos, types.NewPackage(path, "p"), name, nil)
+		return types.NewNamed(tn, types.NewStruct(nil, nil), nil)
+	}
+	sdk, opts, ours := named("github.com/aws/aws-sdk-go/service/s3", "PutObjectInput"), named("example.com/m", "Options"), named("example.com/m", "Config")
+	f := siteFilter{excludeTypeRes: res}
+	for _, tt := range []struct {
+		values []types.Type
+		want   bool
+	}{
+		{[]types.Type{sdk}, true},
+		{[]types.Type{sdk, opts}, true},
+		{[]types.Type{sdk, ours}, false},
+		{[]types.Type{ours}, false},
+	} {
+		site := copySite{}
+		for _, v := range tt.values {
+			site.values = append(site.values, copiedValue{typ: v})
+		}
+		if got := aboutExcludedTypes(site, f.excludesType); got != tt.want {
+			t.Errorf("aboutExcludedTypes with values %v = %v, want %v", tt.values, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultAllowlist(t *testing.T) {
+	named := func(path, name string) *types.Named {
+		tn := types.NewTypeName(token.NoPos, types.NewPackage(path, path[strings.LastIndex(path, "/")+1:]), name, nil)
+		return types.NewNamed(tn, types.NewStruct(nil, nil), nil)
+	}
+	site := func(ts ...types.Type) copySite {
+		s := copySite{}
+		for _, typ := range ts {
+			s.values = append(s.values, copiedValue{typ: typ})
+		}
+		return s
+	}
+	tm, nullString, ours := named("time", "Time"), named("database/sql", "NullString"), named("example.com/m", "Time")
+	f := siteFilter{allowlist: defaultAllowlist}
+	for _, tt := range []struct {
+		site copySite
+		want bool
+	}{
+		{site(tm), true},
+		{site(tm, nullString), true},
+		{site(tm, ours), false},
+		{site(ours), false},
+	} {
+		if got := aboutExcludedTypes(tt.site, f.allows); got != tt.want {
+			t.Errorf("aboutExcludedTypes of %v on the default allowlist = %v, want %v", tt.site.values, got, tt.want)
+		}
+	}
+	if aboutExcludedTypes(site(tm), siteFilter{}.allows) {
+		t.Error("an empty allowlist allows time.Time")
+	}
+}
@@ -0,0 +1,72 @@
+package copyfighter
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+)
+
+// findWideContainers returns a copySite for every slice or map type of a wide
+// element type written in a type declaration, a variable declaration's type,
+// or a composite literal's type. Indexing, appending to, and ranging over the
+// slice or map copies whole elements, again and again. The message weighs
+// that against what a slice or map of pointers costs instead.
+func findWideContainers(files []*ast.File, info *types.Info, wide wideTypes) []copySite {
+	sites := []copySite{}
+	inspectDecls(files, info, func(pkg *types.Package, fun *types.Func, decl *types.TypeName, n ast.Node) bool {
+		var typ ast.Expr
+		switch n := n.(type) {
+		case *ast.TypeSpec:
+			typ = n.Type
+		case *ast.ValueSpec:
+			typ = n.Type
+		case *ast.CompositeLit:
+			typ = n.Type
+		}
+		if typ == nil {
+			return true
+		}
+		ast.Inspect(typ, func(n ast.Node) bool {
+			var elem types.Type
+			var what string
+			switch n := n.(type) {
+			case *ast.ArrayType:
+				if n.Len != nil {
+					return true
+				}
+				elem = info.TypeOf(n.Elt)
+				if elem == nil || !wide.isWide(elem) {
+					return true
+				}
+				what = fmt.Sprintf("every index, append, and range of a slice of '%[1]s' (%[2]d bytes) copies whole elements; '[]%[3]s' copies a word instead, but allocates each element and adds work for the garbage collector",
+					typeString(elem, pkg), wide.sizes.Sizeof(elem), typeString(types.NewPointer(elem), pkg))
+			case *ast.MapType:
+				elem = info.TypeOf(n.Value)
+				if elem == nil || !wide.isWide(elem) {
+					return true
+				}
+				what = fmt.Sprintf("every lookup, store, and range of a map of '%[1]s' (%[2]d bytes) copies whole values; 'map[%[3]s]%[4]s' copies a word instead, but allocates each value and adds work for the garbage collector",
+					typeString(elem, pkg), wide.sizes.Sizeof(elem), typeString(info.TypeOf(n.Key), pkg), typeString(types.NewPointer(elem), pkg))
+			default:
+				return true
+			}
+			size := wide.sizes.Sizeof(elem)
+			site := copySite{
+				check:  checkContainer,
+				pos:    n.Pos(),
+				fun:    fun,
+				decl:   decl,
+				what:   what,
+				size:   size,
+				values: []copiedValue{{typ: elem, size: size}},
+			}
+			if fun == nil && decl == nil {
+				site.pkg = pkg
+			}
+			sites = append(sites, site)
+			return true
+		})
+		return true
+	})
+	return sites
+}
@@ -0,0 +1,156 @@
+package copyfighter
+
+import (
+	"fmt"
+	"go/types"
+	"math"
+
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/callgraph/rta"
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+// addCopyCosts sets the cost of each site with a func to the bytes it copies
+// per run of the program whose main package is main: the bytes of its
+// flagged values times the number of paths through the program's call graph
+// from main.main and the package initializers to its func. The call graph is
+// built from the program's SSA form by rapid type analysis, which resolves
+// calls through interfaces and func values to the types and funcs the
+// program actually creates. The calls within a recursive cycle are counted
+// once, and funcs the analysis finds unreachable cost nothing.
+func addCopyCosts(sites []copySite, main *packages.Package) error {
+	prog, pkgs := ssautil.AllPackages([]*packages.Package{main}, ssa.InstantiateGenerics)
+	prog.Build()
+	if pkgs[0] == nil {
+		return fmt.Errorf("unable to build SSA form of %#v", main.PkgPath)
+	}
+	roots := []*ssa.Function{}
+	for _, name := range []string{"main", "init"} {
+		if f := pkgs[0].Func(name); f != nil {
+			roots = append(roots, f)
+		}
+	}
+	graph := rta.Analyze(roots, true).CallGraph
+	runs := make(map[*types.Func]float64)
+	for node, n := range countPaths(graph, roots) {
+		if node.Func == nil {
+			continue
+		}
+		if f, ok := node.Func.Object().(*types.Func); ok {
+			runs[f.Origin()] += n
+		}
+	}
+	for i := range sites {
+		site := &sites[i]
+		if site.fun == nil {
+			continue
+		}
+		bytes := int64(0)
+		for _, v := range site.values {
+			bytes += v.size
+		}
+		site.cost = saturate(runs[site.fun.Origin()] * float64(bytes))
+	}
+	return nil
+}
+
+// countPaths returns the number of paths from roots to each node of graph
+// they reach, counting every call site as a path of its own. The nodes of a
+// cycle are reached as often as the cycle is entered.
+func countPaths(graph *callgraph.Graph, roots []*ssa.Function) map[*callgraph.Node]float64 {
+	starts := []*callgraph.Node{}
+	for _, root := range roots {
+		if node := graph.Nodes[root]; node != nil {
+			starts = append(starts, node)
+		}
+	}
+	sccs := stronglyConnected(starts)
+	component := make(map[*callgraph.Node]int)
+	for i, scc := range sccs {
+		for _, node := range scc {
+			component[node] = i
+		}
+	}
+	entered := make([]float64, len(sccs))
+	for _, node := range starts {
+		entered[component[node]]++
+	}
+	// Tarjan's algorithm finds the components callees first, so walking them
+	// backwards visits every caller's before its callees'.
+	for i := len(sccs) - 1; i >= 0; i-- {
+		for _, node := range sccs[i] {
+			for _, edge := range node.Out {
+				if j := component[edge.Callee]; j != i {
+					entered[j] += entered[i]
+				}
+			}
+		}
+	}
+	paths := make(map[*callgraph.Node]float64, len(component))
+	for node, i := range component {
+		paths[node] = entered[i]
+	}
+	return paths
+}
+
+// stronglyConnected returns the strongly connected components of the call
+// graph nodes reachable from starts, each callee's before its callers', by
+// Tarjan's algorithm.
+func stronglyConnected(starts []*callgraph.Node) [][]*callgraph.Node {
+	index := make(map[*callgraph.Node]int)
+	low := make(map[*callgraph.Node]int)
+	onStack := make(map[*callgraph.Node]bool)
+	stack := []*callgraph.Node{}
+	sccs := [][]*callgraph.Node{}
+	var visit func(*callgraph.Node)
+	visit = func(node *callgraph.Node) {
+		index[node] = len(index)
+		low[node] = index[node]
+		stack = append(stack, node)
+		onStack[node] = true
+		for _, edge := range node.Out {
+			callee := edge.Callee
+			if _, ok := index[callee]; !ok {
+				visit(callee)
+				low[node] = min(low[node], low[callee])
+			} else if onStack[callee] {
+				low[node] = min(low[node], index[callee])
+			}
+		}
+		if low[node] != index[node] {
+			return
+		}
+		scc := []*callgraph.Node{}
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			scc = append(scc, top)
+			if top == node {
+				break
+			}
+		}
+		sccs = append(sccs, scc)
+	}
+	for _, node := range starts {
+		if _, ok := index[node]; !ok {
+			visit(node)
+		}
+	}
+	return sccs
+}
+
+// saturate returns f as an int64, or the largest int64 if it doesn't fit.
+func saturate(f float64) int64 {
+	if f >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(f)
+}
+
+// costLabel returns the label of a site's cost.
+func (site copySite) costLabel() string {
+	return fmt.Sprintf(" [copies %d bytes per run]", site.cost)
+}
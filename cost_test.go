@@ -0,0 +1,77 @@
+package copyfighter
+
+import (
+	"go/types"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyCosts(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.22\n",
+		"a/a.go": `package a
+
+type Big struct{ a, b, c int64 }
+
+func Load(b Big) {}
+
+func Unused(b Big) {}
+
+func Loop(b Big, n int) {
+	if n > 0 {
+		Loop(b, n-1)
+	}
+}
+`,
+		"cmd/main.go": `package main
+
+import "example.com/m/a"
+
+func step(b *a.Big) {
+	a.Load(*b)
+	a.Load(*b)
+}
+
+func main() {
+	var b a.Big
+	a.Load(b)
+	step(&b)
+	a.Loop(b, 3)
+}
+`,
+	}
+	for name, src := range files {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+
+	*sortBy = "cost"
+	defer func() { *sortBy = "position" }()
+	sites, _, err := checkProgram("./cmd", limits{max: 16}, &types.StdSizes{WordSize: 8, MaxAlign: 8}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Load is reached once from main and twice through step, and the
+	// recursive Loop once.
+	want := map[string]int64{"Load": 3 * 24, "Unused": 0, "Loop": 24}
+	for _, site := range sites {
+		if site.check != checkSignature {
+			continue
+		}
+		name := site.fun.Name()
+		if site.cost != want[name] {
+			t.Errorf("%s costs %d bytes per run, want %d", name, site.cost, want[name])
+		}
+		delete(want, name)
+	}
+	if len(want) > 0 {
+		t.Errorf("found no signature sites for %v", want)
+	}
+}
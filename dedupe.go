@@ -0,0 +1,46 @@
+package copyfighter
+
+import (
+	"fmt"
+	"go/token"
+	"path/filepath"
+)
+
+// canonicalPath returns p as an absolute path with its symlinks resolved, so
+// that a file or directory reached through several paths has one identity.
+// Parts that can't be resolved are left as they are.
+func canonicalPath(p string) string {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return p
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved
+	}
+	return abs
+}
+
+// dedupeSites returns sites without the repeats of a site: later sites from
+// the same check, with the same message, at the same position once symlinks
+// are resolved. Repeats come from a package that is matched through several
+// paths, like a GOPATH directory that is also symlinked under another name.
+func dedupeSites(sites []copySite, fset *token.FileSet) []copySite {
+	seen := make(map[string]bool)
+	canonical := make(map[string]string)
+	out := sites[:0:0]
+	for _, site := range sites {
+		position := fset.Position(site.pos)
+		file, ok := canonical[position.Filename]
+		if !ok {
+			file = canonicalPath(position.Filename)
+			canonical[position.Filename] = file
+		}
+		key := fmt.Sprintf("%s:%d:%d %s %s", file, position.Line, position.Column, site.check, site.message(siteLabels{}))
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, site)
+	}
+	return out
+}
@@ -0,0 +1,33 @@
+package copyfighter
+
+import (
+	"go/token"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDedupeSites(t *testing.T) {
+	dir := t.TempDir()
+	real := filepath.Join(dir, "a.go")
+	if err := os.WriteFile(real, []byte("package a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "b.go")
+	if err := os.Symlink(real, link); err != nil {
+		t.Skip(err)
+	}
+	fset := token.NewFileSet()
+	a := fset.AddFile(real, -1, 10)
+	b := fset.AddFile(link, -1, 10)
+	sites := []copySite{
+		{check: checkSelect, pos: a.Pos(2), what: "copy"},
+		{check: checkSelect, pos: b.Pos(2), what: "copy"},
+		{check: checkSelect, pos: b.Pos(3), what: "copy"},
+		{check: checkLiteral, pos: b.Pos(2), what: "copy"},
+	}
+	got := dedupeSites(sites, fset)
+	if len(got) != 3 || got[0].pos != sites[0].pos || got[1].pos != sites[2].pos || got[2].check != checkLiteral {
+		t.Errorf("dedupeSites kept %v, want all but the second site", got)
+	}
+}
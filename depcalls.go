@@ -0,0 +1,150 @@
+package copyfighter
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"log"
+	"sort"
+	"strings"
+)
+
+// findDependencyCalls returns a copySite for every call in a func body to a
+// func or method of a dependency whose signature takes a wide receiver or
+// parameter by value, so that the call has to copy it. A dependency is a
+// package outside module, or, if module is empty, any package other than
+// pkg. The standard library is left out: its APIs can be neither wrapped
+// away nor replaced. Unlike the package's own named types, a dependency's
+// are too wide if they are any struct or array over the maximum size.
+func findDependencyCalls(files []*ast.File, info *types.Info, pkg *types.Package, module string, wide wideTypes) []copySite {
+	isDependency := dependencies(pkg, module)
+	sites := []copySite{}
+	inspectFuncBodies(files, info, func(fun *types.Func, n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		callee := staticCallee(call, info)
+		if callee == nil || !isDependency(callee.Pkg()) {
+			return true
+		}
+		copied, values := callCopies(call, info, fun.Pkg(), wide)
+		if len(values) == 0 {
+			return true
+		}
+		site := copySite{
+			check:      checkDependencyCall,
+			pos:        call.Pos(),
+			fun:        fun,
+			what:       fmt.Sprintf("call to '%s' copies %s, as its signature demands, wrap it or use another API", callee.FullName(), sentence(copied)),
+			values:     values,
+			dependency: callee.Pkg().Path(),
+		}
+		for _, v := range values {
+			site.size = max(site.size, v.size)
+		}
+		sites = append(sites, site)
+		return true
+	})
+	return sites
+}
+
+// dependencies returns a func that tells whether a package is a dependency
+// of pkg, as findDependencyCalls defines them.
+func dependencies(pkg *types.Package, module string) func(*types.Package) bool {
+	return func(p *types.Package) bool {
+		if p == nil || p == pkg || isStdPath(p.Path()) {
+			return false
+		}
+		return module == "" || p.Path() != module && !strings.HasPrefix(p.Path(), module+"/")
+	}
+}
+
+// staticCallee returns the func or method that call calls by name, or nil if
+// it calls a func value or isn't a call of a func.
+func staticCallee(call *ast.CallExpr, info *types.Info) *types.Func {
+	var id *ast.Ident
+	switch f := ast.Unparen(call.Fun).(type) {
+	case *ast.Ident:
+		id = f
+	case *ast.SelectorExpr:
+		id = f.Sel
+	}
+	callee, _ := info.Uses[id].(*types.Func)
+	return callee
+}
+
+// callCopies returns the receiver and parameters that call copies because
+// they are passed by value and are of any struct or array type wider than
+// wide's maximum, described for people in the package from and as values.
+// The elements of variadic parameters are left out.
+func callCopies(call *ast.CallExpr, info *types.Info, from *types.Package, wide wideTypes) ([]string, []copiedValue) {
+	isWide := func(t types.Type) bool {
+		switch t.Underlying().(type) {
+		case *types.Struct, *types.Array:
+			return !hasTypeParam(t) && wide.sizes.Sizeof(t) > wide.max
+		}
+		return false
+	}
+	sig, ok := underlyingTypeOf(info, call.Fun).(*types.Signature)
+	if !ok || info.Types[call.Fun].IsType() {
+		return nil, nil
+	}
+	copied := []string{}
+	values := []copiedValue{}
+	if sel, ok := ast.Unparen(call.Fun).(*ast.SelectorExpr); ok {
+		if s := info.Selections[sel]; s != nil && s.Kind() == types.MethodVal {
+			if recv := s.Obj().Type().(*types.Signature).Recv(); recv != nil && isWide(recv.Type()) {
+				size := wide.sizes.Sizeof(recv.Type())
+				copied = append(copied, fmt.Sprintf("the receiver '%s' (%d bytes)", typeString(recv.Type(), from), size))
+				values = append(values, copiedValue{typ: recv.Type(), size: size, role: "receiver"})
+			}
+		}
+	}
+	for i := 0; i < sig.Params().Len() && i < len(call.Args); i++ {
+		t := sig.Params().At(i).Type()
+		if sig.Variadic() && i == sig.Params().Len()-1 || !isWide(t) {
+			continue
+		}
+		size := wide.sizes.Sizeof(t)
+		copied = append(copied, fmt.Sprintf("parameter %d '%s' (%d bytes)", i, typeString(t, from), size))
+		values = append(values, copiedValue{typ: t, size: size, role: "parameter", index: i})
+	}
+	return copied, values
+}
+
+// isStdPath returns true if path is the import path of a standard library
+// package, whose first element, unlike a module path's, has no dot.
+func isStdPath(path string) bool {
+	first, _, _ := strings.Cut(path, "/")
+	return !strings.Contains(first, ".")
+}
+
+// logDependencyCalls logs how many of the calls among sites copy values for
+// each dependency, and how many bytes those calls copy, costliest first.
+func logDependencyCalls(sites []copySite) {
+	calls := make(map[string]int)
+	bytes := make(map[string]int64)
+	for _, site := range sites {
+		if site.check != checkDependencyCall {
+			continue
+		}
+		calls[site.dependency]++
+		for _, v := range site.values {
+			bytes[site.dependency] += v.size
+		}
+	}
+	deps := make([]string, 0, len(calls))
+	for dep := range calls {
+		deps = append(deps, dep)
+	}
+	sort.Slice(deps, func(i, j int) bool {
+		if bytes[deps[i]] != bytes[deps[j]] {
+			return bytes[deps[i]] > bytes[deps[j]]
+		}
+		return deps[i] < deps[j]
+	})
+	for _, dep := range deps {
+		log.Printf("%s: %s copy %d bytes", dep, plural(calls[dep], "call"), bytes[dep])
+	}
+}
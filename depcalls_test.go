@@ -0,0 +1,81 @@
+package copyfighter
+
+import (
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDependencyCalls(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, src string) {
+		t.Helper()
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("dep/go.mod", "module example.com/dep\n\ngo 1.22\n")
+	write("dep/dep.go", `package dep
+
+type Options struct{ A, B, C int64 }
+
+func New(o Options, names ...string) *Options { return &o }
+
+func (o Options) Valid() bool { return o.A > 0 }
+
+func Small(n int64) {}
+`)
+	write("app/go.mod", "module example.com/app\n\ngo 1.22\n\nrequire example.com/dep v0.0.0\n\nreplace example.com/dep => ../dep\n")
+	write("app/app.go", `package app
+
+import "example.com/dep"
+
+func run(o *dep.Options) bool {
+	dep.Small(1)
+	return dep.New(*o, "a").Valid()
+}
+`)
+	t.Chdir(filepath.Join(dir, "app"))
+
+	fset := token.NewFileSet()
+	sites, err := check([]string{"./..."}, fset, limits{max: 16}, &types.StdSizes{WordSize: 8, MaxAlign: 8}, shard{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	calls := []string{}
+	for _, site := range sites {
+		switch site.check {
+		case checkDependencyCall:
+			got = append(got, site.dependency+": "+site.what)
+		case checkCall:
+			calls = append(calls, site.dependency+": "+site.what)
+		}
+	}
+	want := []string{
+		"example.com/dep: call to '(example.com/dep.Options).Valid' copies the receiver 'example.com/dep.Options' (24 bytes), as its signature demands, wrap it or use another API",
+		"example.com/dep: call to 'example.com/dep.New' copies parameter 0 'example.com/dep.Options' (24 bytes), as its signature demands, wrap it or use another API",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got dependency calls\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	wantCalls := []string{
+		"example.com/dep: call to 'dep.New(*o, \"a\").Valid' copies the receiver 'example.com/dep.Options' (24 bytes)",
+		"example.com/dep: call to 'dep.New' copies parameter 0 'example.com/dep.Options' (24 bytes)",
+	}
+	if strings.Join(calls, "\n") != strings.Join(wantCalls, "\n") {
+		t.Errorf("got calls\n%s\nwant\n%s", strings.Join(calls, "\n"), strings.Join(wantCalls, "\n"))
+	}
+	// With both checks enabled, dependency calls are reported once.
+	f := siteFilter{optIn: map[string]bool{checkDependencyCall: true, checkCall: true}}
+	if kept := f.apply(sites, fset, nil); len(kept) != len(sites)-len(calls) {
+		t.Errorf("kept %d of %d sites with both checks, want the %d calls left out", len(kept), len(sites), len(calls))
+	}
+}
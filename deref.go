@@ -0,0 +1,132 @@
+package copyfighter
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+// findWastedPointers returns a copySite for every func that takes a pointer
+// to a wide struct but starts by copying the struct out of it, as in
+//
+//	func handle(p *Big) {
+//		v := *p
+//		...
+//	}
+//
+// and never uses the pointer again. Passing the pointer saved nothing, since
+// the body makes the same copy the caller would have.
+func findWastedPointers(files []*ast.File, info *types.Info, wide wideTypes) []copySite {
+	sites := []copySite{}
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			fd, ok := decl.(*ast.FuncDecl)
+			if !ok || fd.Body == nil || len(fd.Body.List) == 0 {
+				continue
+			}
+			fun, ok := info.Defs[fd.Name].(*types.Func)
+			if !ok {
+				continue
+			}
+			first := fd.Body.List[0]
+			v, star := firstDeref(first)
+			if v == nil {
+				continue
+			}
+			pid, ok := ast.Unparen(star.X).(*ast.Ident)
+			if !ok {
+				continue
+			}
+			p, ok := info.Uses[pid].(*types.Var)
+			if !ok || !isParam(fun, p) && !isRecv(fun, p) {
+				continue
+			}
+			pt, ok := p.Type().(*types.Pointer)
+			if !ok || !wide.isWide(pt.Elem()) || usedAfter(fd.Body.List[1:], p, info) {
+				continue
+			}
+			role := "parameter"
+			if isRecv(fun, p) {
+				role = "receiver"
+			}
+			size := wide.sizes.Sizeof(pt.Elem())
+			sites = append(sites, copySite{
+				check:  checkDeref,
+				pos:    first.Pos(),
+				fun:    fun,
+				what:   fmt.Sprintf("'%s := *%s' copies the '%s' (%d bytes) that %s '%s' points to and '%s' isn't used again, use the pointer directly", v.Name, p.Name(), typeString(pt.Elem(), fun.Pkg()), size, role, p.Name(), p.Name()),
+				size:   size,
+				values: []copiedValue{{typ: pt.Elem(), size: size}},
+			})
+		}
+	}
+	return sites
+}
+
+// firstDeref returns the variable and dereference of a statement of the form
+// "v := *p" or "var v = *p".
+func firstDeref(stmt ast.Stmt) (*ast.Ident, *ast.StarExpr) {
+	var (
+		lhs ast.Expr
+		rhs ast.Expr
+	)
+	switch s := stmt.(type) {
+	case *ast.AssignStmt:
+		if s.Tok != token.DEFINE || len(s.Lhs) != 1 || len(s.Rhs) != 1 {
+			return nil, nil
+		}
+		lhs, rhs = s.Lhs[0], s.Rhs[0]
+	case *ast.DeclStmt:
+		gd, ok := s.Decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.VAR || len(gd.Specs) != 1 {
+			return nil, nil
+		}
+		vs := gd.Specs[0].(*ast.ValueSpec)
+		if len(vs.Names) != 1 || len(vs.Values) != 1 {
+			return nil, nil
+		}
+		lhs, rhs = vs.Names[0], vs.Values[0]
+	default:
+		return nil, nil
+	}
+	id, ok := lhs.(*ast.Ident)
+	if !ok || id.Name == "_" {
+		return nil, nil
+	}
+	star, ok := ast.Unparen(rhs).(*ast.StarExpr)
+	if !ok {
+		return nil, nil
+	}
+	return id, star
+}
+
+// isParam returns true if v is one of the parameters of fun.
+func isParam(fun *types.Func, v *types.Var) bool {
+	params := fun.Type().(*types.Signature).Params()
+	for i := 0; i < params.Len(); i++ {
+		if params.At(i) == v {
+			return true
+		}
+	}
+	return false
+}
+
+// isRecv returns true if v is the receiver of fun.
+func isRecv(fun *types.Func, v *types.Var) bool {
+	return fun.Type().(*types.Signature).Recv() == v
+}
+
+// usedAfter returns true if any of stmts refers to v.
+func usedAfter(stmts []ast.Stmt, v *types.Var, info *types.Info) bool {
+	used := false
+	for _, stmt := range stmts {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok && info.Uses[id] == v {
+				used = true
+			}
+			return !used
+		})
+	}
+	return used
+}
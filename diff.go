@@ -0,0 +1,170 @@
+package copyfighter
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines around each change in a
+// unified diff, as diff -u and gofmt -d print them.
+const diffContext = 3
+
+// diffOp is a line of an edit script: kept if kind is ' ', deleted if '-',
+// and inserted if '+'.
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// writeUnifiedDiff writes the unified diff from old to new, the contents of
+// the file name before and after a fix, to w. The fixes insert text within
+// lines and the annotations whole lines, so the edit script is short. Nothing
+// is written if they are the same.
+func writeUnifiedDiff(w io.Writer, name string, old, new []byte) error {
+	ops := diffLines(splitLines(string(old)), splitLines(string(new)))
+	changed := []int{}
+	for i, op := range ops {
+		if op.kind != ' ' {
+			changed = append(changed, i)
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- a/%s\n+++ b/%s\n", name, name)
+	for i := 0; i < len(changed); {
+		// Grow the hunk while the next change is close enough for their
+		// contexts to touch.
+		j := i
+		for j+1 < len(changed) && changed[j+1]-changed[j] <= 2*diffContext+1 {
+			j++
+		}
+		start := max(changed[i]-diffContext, 0)
+		end := min(changed[j]+diffContext+1, len(ops))
+		oldStart, newStart := diffLineCounts(ops[:start])
+		oldLines, newLines := diffLineCounts(ops[start:end])
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", oldStart+1, oldLines, newStart+1, newLines)
+		for _, op := range ops[start:end] {
+			writeDiffLine(&out, string(op.kind), op.line)
+		}
+		i = j + 1
+	}
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+// diffLineCounts returns the number of lines of the old and the new file that
+// ops cover.
+func diffLineCounts(ops []diffOp) (old, new int) {
+	for _, op := range ops {
+		if op.kind != '+' {
+			old++
+		}
+		if op.kind != '-' {
+			new++
+		}
+	}
+	return old, new
+}
+
+// diffLines returns the shortest edit script that turns a into b, found with
+// Myers' algorithm. Each run of changed lines has its deletions before its
+// insertions, as diff -u prints them.
+func diffLines(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	// trace holds v as it was before each number of edits was tried.
+	trace := [][]int{}
+	found := false
+	for d := 0; d <= n+m && !found; d++ {
+		trace = append(trace, slices.Clone(v))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[offset+k-1] < v[offset+k+1] {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+
+	reversed := []diffOp{}
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		prev := k - 1
+		if k == -d || k != d && v[offset+k-1] < v[offset+k+1] {
+			prev = k + 1
+		}
+		prevX := v[offset+prev]
+		prevY := prevX - prev
+		for x > prevX && y > prevY {
+			x, y = x-1, y-1
+			reversed = append(reversed, diffOp{' ', a[x]})
+		}
+		if d > 0 {
+			if x == prevX {
+				reversed = append(reversed, diffOp{'+', b[prevY]})
+			} else {
+				reversed = append(reversed, diffOp{'-', a[prevX]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+	slices.Reverse(reversed)
+
+	ops := make([]diffOp, 0, len(reversed))
+	for i := 0; i < len(reversed); {
+		if reversed[i].kind == ' ' {
+			ops = append(ops, reversed[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(reversed) && reversed[j].kind != ' ' {
+			j++
+		}
+		for _, kind := range []byte{'-', '+'} {
+			for _, op := range reversed[i:j] {
+				if op.kind == kind {
+					ops = append(ops, op)
+				}
+			}
+		}
+		i = j
+	}
+	return ops
+}
+
+// splitLines returns the lines of s, each with its newline.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// writeDiffLine writes line to a diff with prefix, marking a last line
+// without a newline as diff -u does.
+func writeDiffLine(out *strings.Builder, prefix, line string) {
+	out.WriteString(prefix)
+	out.WriteString(line)
+	if !strings.HasSuffix(line, "\n") {
+		out.WriteString("\n\\ No newline at end of file\n")
+	}
+}
@@ -0,0 +1,62 @@
+package copyfighter
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteUnifiedDiff(t *testing.T) {
+	old := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\nn\no\np\nq"
+	new := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\nn\no\nP\nQ"
+	b := &bytes.Buffer{}
+	if err := writeUnifiedDiff(b, "x.go", []byte(old), []byte(new)); err != nil {
+		t.Fatal(err)
+	}
+	want := `--- a/x.go
++++ b/x.go
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -13,5 +13,5 @@
+ m
+ n
+ o
+-p
+-q
+\ No newline at end of file
++P
++Q
+\ No newline at end of file
+`
+	if b.String() != want {
+		t.Errorf("diff:\n%s\nwant:\n%s", b, want)
+	}
+
+	b.Reset()
+	if err := writeUnifiedDiff(b, "x.go", []byte("a\nb\nc\nd\ne\n"), []byte("a\nb\nc\nX\nd\ne\nY\n")); err != nil {
+		t.Fatal(err)
+	}
+	want = `--- a/x.go
++++ b/x.go
+@@ -1,5 +1,7 @@
+ a
+ b
+ c
++X
+ d
+ e
++Y
+`
+	if b.String() != want {
+		t.Errorf("diff of inserted lines:\n%s\nwant:\n%s", b, want)
+	}
+
+	b.Reset()
+	if err := writeUnifiedDiff(b, "x.go", []byte(old), []byte(old)); err != nil || b.Len() > 0 {
+		t.Errorf("diff of unchanged file = %q, %v, want nothing", b, err)
+	}
+}
@@ -0,0 +1,182 @@
+package copyfighter
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ignoreDirective starts a line of a func's or type's doc comment to
+// suppress the findings about it. The rest of the line says why, and may
+// start with an until option.
+const ignoreDirective = "//copyfighter:ignore"
+
+// untilOption, like "until=2025-09-01", ends an ignore directive's
+// suppression after the given day, so the findings come back.
+const untilOption = "until="
+
+// dateLayout is how until options and baseline entries write days.
+const dateLayout = "2006-01-02"
+
+// maxDirective starts a line of a type's doc comment, like
+// "//copyfighter:max=128", to set the size in bytes that values of the type
+// must exceed to be reported, in place of -max and -check-max. The rest of
+// the line after the size says why.
+const maxDirective = "//copyfighter:max="
+
+// ignoredDecls returns the funcs and types declared in files whose doc
+// comments have an ignore directive that hasn't expired, with its reason.
+// Directives whose until date isn't a day are recorded in skips and don't
+// suppress anything.
+func ignoredDecls(files []*ast.File, info *types.Info, fset *token.FileSet, skips *skipLog) map[types.Object]string {
+	ignored := make(map[types.Object]string)
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if reason, ok := ignoreReason(decl.Doc, fset, decl.Name.Name, skips); ok {
+					ignored[info.Defs[decl.Name]] = reason
+				}
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					ts, ok := spec.(*ast.TypeSpec)
+					if !ok {
+						continue
+					}
+					doc := ts.Doc
+					if ignoreComment(doc) == nil && len(decl.Specs) == 1 {
+						doc = decl.Doc
+					}
+					if reason, ok := ignoreReason(doc, fset, ts.Name.Name, skips); ok {
+						ignored[info.Defs[ts.Name]] = reason
+					}
+				}
+			}
+		}
+	}
+	return ignored
+}
+
+// ignoreReason returns the reason given by the ignore directive in doc, the
+// doc comment of the func or type name, if it has one that hasn't expired.
+func ignoreReason(doc *ast.CommentGroup, fset *token.FileSet, name string, skips *skipLog) (string, bool) {
+	c := ignoreComment(doc)
+	if c == nil {
+		return "", false
+	}
+	reason := strings.TrimSpace(strings.TrimPrefix(c.Text, ignoreDirective))
+	rest, ok := strings.CutPrefix(reason, untilOption)
+	if !ok {
+		return reason, true
+	}
+	date, reason, _ := strings.Cut(rest, " ")
+	until, err := time.Parse(dateLayout, date)
+	if err != nil {
+		skips.add(skipBadDirective, fmt.Sprintf("%s: %s", positionOf(fset, c, name), c.Text))
+		return "", false
+	}
+	return strings.TrimSpace(reason), !expired(until)
+}
+
+// ignoreComment returns the line of doc with an ignore directive, if it has
+// one.
+func ignoreComment(doc *ast.CommentGroup) *ast.Comment {
+	if doc == nil {
+		return nil
+	}
+	for _, c := range doc.List {
+		rest, ok := strings.CutPrefix(c.Text, ignoreDirective)
+		if ok && (rest == "" || rest[0] == ' ' || rest[0] == '\t') {
+			return c
+		}
+	}
+	return nil
+}
+
+// expired returns true if the day until has passed in local time.
+func expired(until time.Time) bool {
+	y, m, d := time.Now().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC).After(until)
+}
+
+// typeMaxes returns the sizes that the max directives in the doc comments of
+// the types declared in files set. Directives whose size isn't a number are
+// recorded in skips.
+func typeMaxes(files []*ast.File, info *types.Info, fset *token.FileSet, skips *skipLog) map[*types.TypeName]int64 {
+	maxes := make(map[*types.TypeName]int64)
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			decl, ok := decl.(*ast.GenDecl)
+			if !ok || decl.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range decl.Specs {
+				ts := spec.(*ast.TypeSpec)
+				c := maxComment(ts.Doc)
+				if c == nil && len(decl.Specs) == 1 {
+					c = maxComment(decl.Doc)
+				}
+				tn, ok := info.Defs[ts.Name].(*types.TypeName)
+				if c == nil || !ok {
+					continue
+				}
+				size, _, _ := strings.Cut(strings.TrimPrefix(c.Text, maxDirective), " ")
+				n, err := strconv.ParseInt(strings.TrimSpace(size), 10, 64)
+				if err != nil || n < 0 {
+					skips.add(skipBadDirective, fmt.Sprintf("%s: %s", positionOf(fset, c, ts.Name.Name), c.Text))
+					continue
+				}
+				maxes[tn] = n
+			}
+		}
+	}
+	return maxes
+}
+
+// maxComment returns the line of doc with a max directive, if it has one.
+func maxComment(doc *ast.CommentGroup) *ast.Comment {
+	if doc == nil {
+		return nil
+	}
+	for _, c := range doc.List {
+		if strings.HasPrefix(c.Text, maxDirective) {
+			return c
+		}
+	}
+	return nil
+}
+
+// isIgnored returns true if ignored has obj.
+func isIgnored(ignored map[types.Object]string, obj types.Object) bool {
+	_, ok := ignored[obj]
+	return ok
+}
+
+// addIgnored sets the ignored of the sites about a func or type in ignored:
+// the sites of the func, those about the type's declaration, and those whose
+// flagged values are all of the type.
+func addIgnored(sites []copySite, ignored map[types.Object]string) {
+	if len(ignored) == 0 {
+		return
+	}
+	for i := range sites {
+		site := &sites[i]
+		if site.fun != nil && isIgnored(ignored, site.fun) || site.decl != nil && isIgnored(ignored, site.decl) {
+			site.ignored = true
+			continue
+		}
+		all := len(site.values) > 0
+		for _, v := range site.values {
+			named, ok := v.typ.(*types.Named)
+			if !ok || !isIgnored(ignored, named.Origin().Obj()) {
+				all = false
+				break
+			}
+		}
+		site.ignored = all
+	}
+}
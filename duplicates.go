@@ -0,0 +1,59 @@
+package copyfighter
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// findDuplicateStructs returns one copySite for every group of wide struct
+// types in structs that have identical fields, tags included, and are declared
+// in more than one package. Copied DTOs are better fixed by consolidating the
+// types than by changing how every copy is passed around. Identical types in
+// one package, like the versions of a wire format, are usually kept apart on
+// purpose. The site is placed at the first declaration of the group and lists
+// the others.
+func findDuplicateStructs(structs []*types.TypeName, sizes types.Sizes, fset *token.FileSet) []copySite {
+	groups := make(map[string][]*types.TypeName)
+	for _, tn := range structs {
+		key := types.TypeString(tn.Type().Underlying(), nil)
+		groups[key] = append(groups[key], tn)
+	}
+	sites := []copySite{}
+	for _, group := range groups {
+		if !spansPackages(group) {
+			continue
+		}
+		sort.Slice(group, func(i, j int) bool {
+			return positionLess(fset.Position(group[i].Pos()), fset.Position(group[j].Pos()))
+		})
+		first := group[0]
+		others := []string{}
+		for _, tn := range group[1:] {
+			position := fset.Position(tn.Pos())
+			others = append(others, fmt.Sprintf("%s at %s:%d", tn.Name(), relPath(position.Filename), position.Line))
+		}
+		size := sizes.Sizeof(first.Type())
+		sites = append(sites, copySite{
+			pos:   first.Pos(),
+			what:  fmt.Sprintf("wide struct '%s' (%d bytes) has the same fields as %s, consolidate them into one type", first.Name(), size, strings.Join(others, ", ")),
+			decl:  first,
+			check: checkDuplicate,
+			size:  size,
+		})
+	}
+	return sites
+}
+
+// spansPackages returns true if the types of group are declared in more than
+// one package.
+func spansPackages(group []*types.TypeName) bool {
+	for _, tn := range group[1:] {
+		if tn.Pkg().Path() != group[0].Pkg().Path() {
+			return true
+		}
+	}
+	return false
+}
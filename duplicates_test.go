@@ -0,0 +1,27 @@
+package copyfighter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDuplicateStructs(t *testing.T) {
+	sites, fset := checkModule(t, map[string]string{
+		"a/a.go": "package a\n\ntype User struct{ ID, Age, Score int64 }\n\ntype Order struct{ ID, Total, Count int64; Note string }\n",
+		"b/b.go": "package b\n\ntype UserDTO struct{ ID, Age, Score int64 }\n",
+		"c/c.go": "package c\n\ntype Small struct{ ID int64 }\n\ntype Other struct{ ID, Age, Score int32 }\n",
+		// Identical types in one package aren't duplicates.
+		"d/d.go": "package d\n\ntype HeaderV1 struct{ Kind, Length, Flags, Seq int64 }\n\ntype HeaderV2 struct{ Kind, Length, Flags, Seq int64 }\n",
+	})
+	found := []string{}
+	for _, site := range sites {
+		if site.check == checkDuplicate {
+			position := fset.Position(site.pos)
+			found = append(found, relPath(position.Filename)+": "+site.what)
+		}
+	}
+	want := "a/a.go: wide struct 'User' (24 bytes) has the same fields as UserDTO at b/b.go:3, consolidate them into one type"
+	if got := strings.Join(found, "\n"); got != want {
+		t.Errorf("got duplicates:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,191 @@
+package copyfighter
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// heldTypes are the wide concrete types each interface variable of a
+// package may hold.
+type heldTypes map[*types.Var][]types.Type
+
+// add records that v may hold t, and returns true if it's new.
+func (d heldTypes) add(v *types.Var, t types.Type) bool {
+	for _, held := range d[v] {
+		if types.Identical(held, t) {
+			return false
+		}
+	}
+	d[v] = append(d[v], t)
+	return true
+}
+
+// findDynamicCopies returns a copySite for every place an interface variable
+// that may hold a boxed wide value is stored in a container or handed to a
+// goroutine: appended to a slice, written into a map or slice element or a
+// struct literal, sent on a channel, passed to a go statement's func, or
+// captured by it. Storing the interface keeps the boxed copy alive for as long
+// as the container or goroutine lives, and the copy was made when the value
+// was boxed, however small the interface's declared type looks.
+//
+// What a variable may hold is found by flow-insensitive data flow within the
+// package: wide values assigned or passed to an interface variable, and the
+// variables that are assigned or passed on from one that holds them.
+func findDynamicCopies(files []*ast.File, info *types.Info, wide wideTypes) []copySite {
+	held := make(heldTypes)
+	flows := make(map[*types.Var][]*types.Var)
+	// assign records that src is assigned or passed to dst.
+	assign := func(dst *types.Var, src ast.Expr) {
+		if dst == nil || !types.IsInterface(dst.Type()) {
+			return
+		}
+		if v := varOf(src, info); v != nil && types.IsInterface(v.Type()) {
+			flows[v] = append(flows[v], dst)
+			return
+		}
+		if t := info.TypeOf(src); t != nil && !types.IsInterface(t) && wide.isWide(t) {
+			held.add(dst, t)
+		}
+	}
+	inspectFuncBodies(files, info, func(fun *types.Func, n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			if len(n.Lhs) == len(n.Rhs) {
+				for i, lhs := range n.Lhs {
+					assign(varOf(lhs, info), n.Rhs[i])
+				}
+			}
+		case *ast.ValueSpec:
+			if len(n.Names) == len(n.Values) {
+				for i, name := range n.Names {
+					v, _ := info.Defs[name].(*types.Var)
+					assign(v, n.Values[i])
+				}
+			}
+		case *ast.CallExpr:
+			var id *ast.Ident
+			switch f := ast.Unparen(n.Fun).(type) {
+			case *ast.Ident:
+				id = f
+			case *ast.SelectorExpr:
+				id = f.Sel
+			}
+			callee, ok := info.Uses[id].(*types.Func)
+			if !ok || callee.Pkg() != fun.Pkg() {
+				return true
+			}
+			sig := callee.Type().(*types.Signature)
+			for i, arg := range n.Args {
+				if i < sig.Params().Len() && !(sig.Variadic() && i >= sig.Params().Len()-1) {
+					assign(sig.Params().At(i), arg)
+				}
+			}
+		}
+		return true
+	})
+	for changed := true; changed; {
+		changed = false
+		for src, dsts := range flows {
+			for _, dst := range dsts {
+				for _, t := range held[src] {
+					changed = held.add(dst, t) || changed
+				}
+			}
+		}
+	}
+	if len(held) == 0 {
+		return []copySite{}
+	}
+	for _, ts := range held {
+		sort.Slice(ts, func(i, j int) bool { return wide.sizes.Sizeof(ts[i]) > wide.sizes.Sizeof(ts[j]) })
+	}
+
+	sites := []copySite{}
+	// report reports the use of the interface e, described by how.
+	report := func(fun *types.Func, e ast.Expr, how string) {
+		v := varOf(e, info)
+		if v == nil || len(held[v]) == 0 {
+			return
+		}
+		names := []string{}
+		values := []copiedValue{}
+		for _, t := range held[v] {
+			size := wide.sizes.Sizeof(t)
+			names = append(names, fmt.Sprintf("'%s' (%d bytes)", typeString(t, fun.Pkg()), size))
+			values = append(values, copiedValue{typ: t, size: size})
+		}
+		sites = append(sites, copySite{
+			check:  checkDynamicType,
+			pos:    e.Pos(),
+			fun:    fun,
+			what:   fmt.Sprintf("'%s' may hold a boxed copy of %s, and %s keeps the copy alive, box a pointer instead", v.Name(), strings.Join(names, " or "), how),
+			size:   values[0].size,
+			values: values,
+		})
+	}
+	inspectFuncBodies(files, info, func(fun *types.Func, n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.CallExpr:
+			if id, ok := ast.Unparen(n.Fun).(*ast.Ident); ok && id.Name == "append" && len(n.Args) > 1 {
+				if _, ok := info.Uses[id].(*types.Builtin); ok {
+					for _, arg := range n.Args[1:] {
+						report(fun, arg, "appending it")
+					}
+				}
+			}
+		case *ast.AssignStmt:
+			if len(n.Lhs) != len(n.Rhs) {
+				return true
+			}
+			for i, lhs := range n.Lhs {
+				if _, ok := ast.Unparen(lhs).(*ast.IndexExpr); ok {
+					report(fun, n.Rhs[i], "storing it")
+				}
+			}
+		case *ast.SendStmt:
+			report(fun, n.Value, "sending it")
+		case *ast.CompositeLit:
+			for _, elt := range n.Elts {
+				if kv, ok := elt.(*ast.KeyValueExpr); ok {
+					elt = kv.Value
+				}
+				report(fun, elt, "putting it in a literal")
+			}
+		case *ast.GoStmt:
+			for _, arg := range n.Call.Args {
+				report(fun, arg, "passing it to a goroutine")
+			}
+			if lit, ok := ast.Unparen(n.Call.Fun).(*ast.FuncLit); ok {
+				// Report the first use of each captured variable.
+				captured := make(map[*types.Var]bool)
+				ast.Inspect(lit.Body, func(n ast.Node) bool {
+					id, ok := n.(*ast.Ident)
+					if !ok {
+						return true
+					}
+					v, ok := info.Uses[id].(*types.Var)
+					if ok && !captured[v] && (v.Pos() < lit.Pos() || v.Pos() >= lit.End()) {
+						captured[v] = true
+						report(fun, id, "capturing it in a goroutine")
+					}
+					return true
+				})
+			}
+		}
+		return true
+	})
+	return sites
+}
+
+// varOf returns the variable e names, if it's an identifier of one.
+func varOf(e ast.Expr, info *types.Info) *types.Var {
+	id, ok := ast.Unparen(e).(*ast.Ident)
+	if !ok {
+		return nil
+	}
+	v, _ := info.ObjectOf(id).(*types.Var)
+	return v
+}
@@ -0,0 +1,136 @@
+package copyfighter
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/build"
+	"go/types"
+	"io"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// goEnv is the configuration of the go command that an analysis follows, so
+// that it sees the same files and sizes as go build does for the same
+// environment, go env -w settings included.
+type goEnv struct {
+	GOOS    string
+	GOARCH  string
+	GOPATH  string
+	GOROOT  string
+	GOFLAGS string
+}
+
+var (
+	goEnvOnce sync.Once
+	goEnvVal  goEnv
+	goEnvErr  error
+)
+
+// readGoEnv returns the go command's configuration, read once with go env.
+func readGoEnv() (goEnv, error) {
+	goEnvOnce.Do(func() {
+		out, err := exec.Command("go", "env", "-json", "GOOS", "GOARCH", "GOPATH", "GOROOT", "GOFLAGS").Output()
+		if err != nil {
+			goEnvErr = fmt.Errorf("unable to run go env: %s", err)
+			return
+		}
+		if err := json.Unmarshal(out, &goEnvVal); err != nil {
+			goEnvErr = fmt.Errorf("unable to parse go env output: %s", err)
+		}
+	})
+	return goEnvVal, goEnvErr
+}
+
+// applyGoEnv makes build.Default, which decides the register ABI and the
+// files of export data lookups, match env. The -goroot and -tags flags take
+// precedence over GOROOT and GOFLAGS.
+func applyGoEnv(env goEnv) {
+	build.Default.GOOS = env.GOOS
+	build.Default.GOARCH = env.GOARCH
+	build.Default.GOPATH = env.GOPATH
+	build.Default.GOROOT = env.GOROOT
+	if *goroot != "" {
+		build.Default.GOROOT = filepath.Clean(*goroot)
+	}
+	if *buildTags != "" {
+		build.Default.BuildTags = parseTags(*buildTags)
+	}
+}
+
+// parseTags returns the tags of a -tags flag, which are separated by commas
+// or, as older go commands took them, spaces.
+func parseTags(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
+
+// mustTarget reads the go command's configuration, applies it with the
+// -goos and -goarch flags taking precedence, and returns it along with the
+// sizes to use. It exits on any error.
+func mustTarget() (goEnv, types.Sizes) {
+	env, err := readGoEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *goos != "" {
+		env.GOOS = *goos
+	}
+	if *goarch != "" {
+		env.GOARCH = *goarch
+	}
+	applyGoEnv(env)
+	sizes, err := targetSizes(env)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return env, sizes
+}
+
+// targetSizes returns the sizes to measure values with: those of the gc
+// compiler for GOARCH, unless -arch, -wordSize, or -maxAlign is given.
+func targetSizes(env goEnv) (types.Sizes, error) {
+	if *archFlag != "" {
+		if flagSet("wordSize") || flagSet("maxAlign") {
+			return nil, fmt.Errorf("-arch can't be used with -wordSize or -maxAlign")
+		}
+		arches, err := parseArches(*archFlag)
+		if err != nil {
+			return nil, err
+		}
+		return widestSizes(arches), nil
+	}
+	if flagSet("wordSize") || flagSet("maxAlign") {
+		return &types.StdSizes{WordSize: *wordSize, MaxAlign: *maxAlign}, nil
+	}
+	sizes := types.SizesFor("gc", env.GOARCH)
+	if sizes == nil {
+		return nil, fmt.Errorf("unknown GOARCH %#v, pass -wordSize and -maxAlign or another -goarch", env.GOARCH)
+	}
+	return sizes, nil
+}
+
+// flagSet returns true if the named flag was given on the command line.
+func flagSet(name string) bool {
+	set := false
+	commandLine.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// writeConfig writes the configuration an analysis would run with.
+func writeConfig(w io.Writer, env goEnv, sizes types.Sizes) error {
+	ptr := types.Typ[types.UnsafePointer]
+	_, err := fmt.Fprintf(w, "GOOS=%s\nGOARCH=%s\nGOPATH=%s\nGOROOT=%s\nGOFLAGS=%s\ntags=%s\nmax=%d\nwordSize=%d\nmaxAlign=%d\n",
+		env.GOOS, env.GOARCH, env.GOPATH, build.Default.GOROOT, env.GOFLAGS, strings.Join(build.Default.BuildTags, ","),
+		*maxStructWidth, sizes.Sizeof(ptr), sizes.Alignof(types.Typ[types.Int64]))
+	return err
+}
@@ -0,0 +1,46 @@
+package copyfighter
+
+import (
+	"go/build"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func TestGoosGoarch(t *testing.T) {
+	saved := build.Default
+	defer func() {
+		build.Default = saved
+		*goos, *goarch = "", ""
+	}()
+	checkModule(t, map[string]string{
+		"a.go":         "package a\n\ntype Ints struct{ a, b, c int }\n\nfunc F(i Ints) {}\n",
+		"w_windows.go": "package a\n\ntype Big struct{ a, b, c int64 }\n\nfunc W(b Big) {}\n",
+	})
+	for _, tt := range []struct {
+		goos, goarch string
+		want         string
+	}{
+		// An int is 4 bytes on 386, so Ints is only wide on amd64, and
+		// W is only declared on windows.
+		{"windows", "386", "W"},
+		{"linux", "amd64", "F"},
+		{"windows", "amd64", "F W"},
+	} {
+		*goos, *goarch = tt.goos, tt.goarch
+		_, sizes := mustTarget()
+		sites, err := check([]string{"."}, token.NewFileSet(), limits{max: 16}, sizes, shard{}, nil, newSkipLog())
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := []string{}
+		for _, site := range sites {
+			if site.check == checkSignature {
+				names = append(names, site.fun.Name())
+			}
+		}
+		if got := strings.Join(names, " "); got != tt.want {
+			t.Errorf("-goos %s -goarch %s found the signatures of %q, want %q", tt.goos, tt.goarch, got, tt.want)
+		}
+	}
+}
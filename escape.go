@@ -0,0 +1,99 @@
+package copyfighter
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/token"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// inlining records which funcs the compiler can inline, by the position of
+// their names as "file:line:col" with absolute file paths.
+type inlining map[string]bool
+
+// readInlining builds the packages matched by patterns, as loadConfig
+// configures the go command, with -gcflags=-m=2, which reports for every func
+// whether it can be inlined.
+func readInlining(patterns []string) (inlining, error) {
+	cfg := loadConfig(patterns, 0)
+	args := append([]string{"build", "-o", os.DevNull, "-gcflags=-m=2"}, cfg.BuildFlags...)
+	cmd := exec.Command("go", append(args, patterns...)...)
+	cmd.Env = cfg.Env
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("unable to run escape analysis: %s\n%s", err, stderr.String())
+	}
+	return parseInlining(&stderr)
+}
+
+// parseInlining parses the "can inline" and "cannot inline" lines of the
+// compiler's -m=2 output, whose paths are relative to the working directory.
+func parseInlining(r io.Reader) (inlining, error) {
+	in := make(inlining)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		pos, msg, ok := strings.Cut(scanner.Text(), ": ")
+		if !ok {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(msg, "can inline "):
+			in[absPath(pos)] = true
+		case strings.HasPrefix(msg, "cannot inline "):
+			in[absPath(pos)] = false
+		}
+	}
+	return in, scanner.Err()
+}
+
+// escapes returns true if the compiler reported that it can't inline the func
+// whose name is at pos. A pointer such a func returns to a value it makes
+// moves the value to the heap, which costs more than copying it out. Funcs
+// the compiler didn't report on aren't known to escape.
+func (in inlining) escapes(pos token.Position) bool {
+	can, ok := in[fmt.Sprintf("%s:%d:%d", absPath(pos.Filename), pos.Line, pos.Column)]
+	return ok && !can
+}
+
+// apply drops the results of signature sites in funcs that can't be inlined,
+// recording each site that loses them in skips, and returns the sites that
+// are left.
+func (in inlining) apply(sites []copySite, fset *token.FileSet, skips *skipLog) []copySite {
+	kept := []copySite{}
+	for _, site := range sites {
+		if site.check != checkSignature || !in.escapes(fset.Position(site.pos)) {
+			kept = append(kept, site)
+			continue
+		}
+		var (
+			shouldBe []string
+			values   []copiedValue
+			size     int64
+		)
+		for i, v := range site.values {
+			if v.role == "result" {
+				continue
+			}
+			shouldBe = append(shouldBe, site.shouldBe[i])
+			values = append(values, v)
+			size = max(size, v.size)
+		}
+		if len(values) == len(site.values) {
+			kept = append(kept, site)
+			continue
+		}
+		skips.add(skipEscapingResult, siteEntity(site, fset))
+		if len(values) == 0 {
+			continue
+		}
+		site.shouldBe, site.values, site.size = shouldBe, values, size
+		kept = append(kept, site)
+	}
+	return kept
+}
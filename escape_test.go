@@ -0,0 +1,90 @@
+package copyfighter
+
+import (
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseInlining(t *testing.T) {
+	out := `# example.com/m
+p.go:5:6: can inline Small with cost 2 as: func() Big { return Big{} }
+p.go:9:6: cannot inline Loud: unhandled op DEFER
+p.go:10:9: Big{} escapes to heap
+`
+	in, err := parseInlining(strings.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for pos, want := range map[token.Position]bool{
+		{Filename: "p.go", Line: 5, Column: 6}:  false,
+		{Filename: "p.go", Line: 9, Column: 6}:  true,
+		{Filename: "p.go", Line: 10, Column: 9}: false,
+	} {
+		if got := in.escapes(pos); got != want {
+			t.Errorf("escapes(%s) = %v, want %v", pos, got, want)
+		}
+	}
+}
+
+func TestInliningApply(t *testing.T) {
+	dir := t.TempDir()
+	src := `package p
+
+type Big struct{ a [8]int64 }
+
+func Small(b Big) Big { return b }
+
+func Loud(b Big) Big {
+	for i := range b.a {
+		defer println(i)
+	}
+	return b
+}
+
+func Made() Big {
+	var b Big
+	defer println(b.a[0])
+	return b
+}
+`
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/m\n\ngo 1.22\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "p.go"), []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+
+	fset := token.NewFileSet()
+	sites, err := check([]string{"."}, fset, limits{max: 16}, &types.StdSizes{WordSize: 8, MaxAlign: 8}, shard{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in, err := readInlining([]string{"."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	skips := newSkipLog()
+	got := map[string][]string{}
+	for _, site := range in.apply(sites, fset, skips) {
+		if site.check == checkSignature {
+			got[site.fun.Name()] = site.shouldBe
+		}
+	}
+	if len(got["Small"]) != 2 {
+		t.Errorf("Small should be %q, want its parameter and result", got["Small"])
+	}
+	if len(got["Loud"]) != 1 || !strings.HasPrefix(got["Loud"][0], "parameter") {
+		t.Errorf("Loud should be %q, want its parameter alone", got["Loud"])
+	}
+	if _, ok := got["Made"]; ok {
+		t.Errorf("Made is reported, want its result left out")
+	}
+	if n := len(skips.entities[skipEscapingResult]); n != 2 {
+		t.Errorf("skipped %d sites for escaping results, want 2", n)
+	}
+}
@@ -0,0 +1,68 @@
+package copyfighter
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+)
+
+// The statuses a run exits with besides 0. A run that can't analyze what it
+// was given, because of bad flags, packages that don't load, or a crash,
+// exits with exitError, so that CI logs tell it apart from a run that found
+// too much.
+const (
+	exitError    = 1
+	exitFindings = 2
+)
+
+// exitStatus returns the status a run whose failing findings number n exits
+// with: exitFindings if there are more than -max-findings of them, unless
+// -exit-zero is given.
+func exitStatus(n int) int {
+	if *exitZero || n <= *maxFindings {
+		return 0
+	}
+	return exitFindings
+}
+
+// exitIfFailing exits with the status of a run whose failing findings number
+// n, if it isn't 0.
+func exitIfFailing(n int) {
+	if status := exitStatus(n); status != 0 {
+		os.Exit(status)
+	}
+}
+
+// parseCommandLine parses args into commandLine. It exits with status 0 for
+// -h and exitError for bad flags, which commandLine has already reported,
+// rather than with flag's status 2, which is that of findings.
+func parseCommandLine(args []string) {
+	err := commandLine.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		os.Exit(exitError)
+	}
+	if *maxFindings < 0 {
+		log.Fatalf("-max-findings can't be negative")
+	}
+}
+
+// exitOnPanic, deferred, reports a panic of the goroutine it's deferred in
+// and exits with exitError, where the runtime would exit with status 2.
+func exitOnPanic() {
+	if p := recover(); p != nil {
+		log.Printf("panic: %v\n\n%s", p, debug.Stack())
+		os.Exit(exitError)
+	}
+}
+
+// recoveredError returns the panic value p of the analysis of the package
+// at path as an error, with the stack it was raised on.
+func recoveredError(path string, p any) error {
+	return fmt.Errorf("internal error analyzing package %#v: %v\n\n%s", path, p, debug.Stack())
+}
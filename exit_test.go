@@ -0,0 +1,24 @@
+package copyfighter
+
+import "testing"
+
+func TestExitStatus(t *testing.T) {
+	defer func() { *exitZero, *maxFindings = false, 0 }()
+	for _, tt := range []struct {
+		exitZero    bool
+		maxFindings int
+		failing     int
+		want        int
+	}{
+		{false, 0, 0, 0},
+		{false, 0, 1, exitFindings},
+		{false, 3, 3, 0},
+		{false, 3, 4, exitFindings},
+		{true, 0, 10, 0},
+	} {
+		*exitZero, *maxFindings = tt.exitZero, tt.maxFindings
+		if got := exitStatus(tt.failing); got != tt.want {
+			t.Errorf("exitStatus(%d) with -exit-zero=%v -max-findings=%d = %d, want %d", tt.failing, tt.exitZero, tt.maxFindings, got, tt.want)
+		}
+	}
+}
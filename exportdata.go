@@ -0,0 +1,73 @@
+package copyfighter
+
+import (
+	"fmt"
+	"go/build"
+	"go/token"
+	"go/types"
+	"sort"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// checkExportData returns the sites of the exported funcs and methods of the
+// package with the given import path, read from its compiled export data
+// rather than its source. The go command builds the export data, or reuses
+// it from its build cache, so no installed package archives are needed. Only
+// signatures are available in export data, so copies inside func bodies
+// can't be found this way. The unexported funcs and methods, and the types
+// that can't be sized, are recorded in skips.
+func checkExportData(path string, lim limits, sizes types.Sizes, skips *skipLog) ([]copySite, *token.FileSet, error) {
+	fset := token.NewFileSet()
+	// Without syntax, go/packages reads the types of the package itself
+	// from export data, like those of its dependencies.
+	cfg := loadConfig([]string{path}, packages.NeedName|packages.NeedTypes)
+	cfg.Fset = fset
+	pkgs, err := packages.Load(cfg, path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to load export data for %#v: %s", path, err)
+	}
+	if len(pkgs) != 1 {
+		return nil, nil, fmt.Errorf("%#v matches %d packages, -export-data takes one import path", path, len(pkgs))
+	}
+	if len(pkgs[0].Errors) > 0 {
+		return nil, nil, fmt.Errorf("unable to load export data for %#v: %s", path, pkgs[0].Errors[0])
+	}
+	pkg := pkgs[0].Types
+
+	named := make(map[*types.TypeName]bool)
+	funcs := []*types.Func{}
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		switch obj := scope.Lookup(name).(type) {
+		case *types.TypeName:
+			if isGeneric(obj.Type()) {
+				skips.add(skipGenericType, path+"."+obj.Name())
+			} else {
+				named[obj] = true
+			}
+			t, ok := obj.Type().(*types.Named)
+			if !ok || obj.IsAlias() || !obj.Exported() {
+				continue
+			}
+			for i := 0; i < t.NumMethods(); i++ {
+				if m := t.Method(i); m.Exported() {
+					funcs = append(funcs, m)
+				} else {
+					skips.add(skipUnexported, m.FullName())
+				}
+			}
+		case *types.Func:
+			if obj.Exported() {
+				funcs = append(funcs, obj)
+			} else {
+				skips.add(skipUnexported, obj.FullName())
+			}
+		}
+	}
+
+	wide := wideTypes{named: named, sizes: sizes, max: lim.of(checkSignature)}
+	sites := lim.enabled(findCopySites(funcs, wide, abiRegs[build.Default.GOARCH], lim.roles))
+	sort.Sort(sortedCopySites{sites: sites, fset: fset})
+	return sites, fset, nil
+}
@@ -0,0 +1,43 @@
+package copyfighter
+
+import (
+	"go/types"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckExportData(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.22\n",
+		"p/p.go": `package p
+
+type Big struct{ a, b, c int64 }
+
+func Use(b Big) {}
+
+func use(b Big) {}
+`,
+	}
+	for name, src := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+
+	// Packages of the main module have no installed archives, only the
+	// export data the go command builds.
+	sites, _, err := checkExportData("example.com/m/p", limits{max: 16}, &types.StdSizes{WordSize: 8, MaxAlign: 8}, newSkipLog())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sites) != 1 || sites[0].fun.Name() != "Use" {
+		t.Errorf("found %v, want the signature of Use", sites)
+	}
+}
@@ -0,0 +1,37 @@
+package copyfighter
+
+import (
+	"fmt"
+	"go/types"
+)
+
+// findWideFields returns a copySite for every field of the struct types in
+// structs that holds a wide struct by value. Every copy of the outer struct
+// copies the field too, so the choice multiplies.
+func findWideFields(structs []*types.TypeName, wide wideTypes) []copySite {
+	sites := []copySite{}
+	for _, tn := range structs {
+		st := tn.Type().Underlying().(*types.Struct)
+		outer := wide.sizes.Sizeof(tn.Type())
+		for i := 0; i < st.NumFields(); i++ {
+			f := st.Field(i)
+			if !wide.isWide(f.Type()) {
+				continue
+			}
+			holds := fmt.Sprintf("field '%s' of '%s' holds", f.Name(), tn.Name())
+			if f.Embedded() {
+				holds = fmt.Sprintf("'%s' embeds", tn.Name())
+			}
+			size := wide.sizes.Sizeof(f.Type())
+			sites = append(sites, copySite{
+				check:  checkField,
+				pos:    f.Pos(),
+				decl:   tn,
+				what:   fmt.Sprintf("%s '%s' by value (%d of its %d bytes), consider *%s", holds, typeString(f.Type(), tn.Pkg()), size, outer, typeString(f.Type(), tn.Pkg())),
+				size:   size,
+				values: []copiedValue{{typ: f.Type(), size: size}},
+			})
+		}
+	}
+	return sites
+}
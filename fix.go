@@ -0,0 +1,707 @@
+package copyfighter
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"sort"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// fixSignatures rewrites the by-value signatures among sites into pointer ones
+// in the source of the packages matched by patterns, and returns the sites it
+// didn't fix followed by those it did. Along with a signature, the body of its
+// func is changed to dereference the receiver and parameters where it uses
+// their values, and its calls in the matched packages and their tests take the
+// address of their arguments and dereference the result.
+//
+// A func is only fixed if that keeps the behavior of the program: its body
+// must not change or take the address of a value that becomes a pointer, as
+// that would change the caller's copy instead, it must only return composite
+// literals or its own local variables, and it must only be called, never used
+// as a value, with arguments whose addresses can be taken.
+//
+// If diff is non-nil, the files are left alone and the rewrites are written
+// to it as unified diffs instead.
+func fixSignatures(patterns []string, sites []copySite, diff io.Writer) ([]copySite, []copySite, error) {
+	f, err := planFixes(patterns, sites)
+	if err != nil {
+		return nil, nil, err
+	}
+	f.diff = diff
+	if err := f.write(); err != nil {
+		return nil, nil, err
+	}
+
+	unfixed, fixed := []copySite{}, []copySite{}
+	for _, site := range sites {
+		if f.fixes(site.fun) && site.check == checkSignature {
+			fixed = append(fixed, site)
+		} else {
+			unfixed = append(unfixed, site)
+		}
+	}
+	return unfixed, fixed, nil
+}
+
+// planFixes returns a fixer holding the edits that fix the by-value
+// signatures among sites in the packages matched by patterns, as
+// fixSignatures describes, without making them.
+func planFixes(patterns []string, sites []copySite) (*fixer, error) {
+	f := &fixer{
+		fset:    token.NewFileSet(),
+		targets: make(map[string]copySite),
+		broken:  make(map[string]bool),
+		found:   make(map[string]bool),
+		parents: make(map[ast.Node]ast.Node),
+		vars:    make(map[*types.Var]bool),
+		edits:   make(map[string]map[insertion]bool),
+	}
+	for _, site := range sites {
+		if site.check == checkSignature && canFix(site) {
+			f.targets[site.fun.FullName()] = site
+		}
+	}
+	if len(f.targets) == 0 {
+		return f, nil
+	}
+	pkgs, err := loadPackages(patterns, f.fset, shard{}, true, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, pkg := range pkgs {
+		if len(pkg.Errors) > 0 {
+			return nil, fmt.Errorf("unable to type check package %#v: %s", pkg.PkgPath, pkg.Errors[0])
+		}
+		for _, file := range pkg.Syntax {
+			f.recordParents(file)
+		}
+	}
+	for _, pkg := range pkgs {
+		f.checkDecls(pkg)
+		f.checkUses(pkg)
+	}
+	for name := range f.targets {
+		if !f.found[name] {
+			f.broken[name] = true
+		}
+	}
+	for _, pkg := range pkgs {
+		f.collectVars(pkg)
+	}
+	for _, pkg := range pkgs {
+		f.editDecls(pkg)
+		f.editCalls(pkg)
+	}
+	return f, nil
+}
+
+// canFix returns true if the signature of site is one fixSignatures knows how
+// to rewrite. The exported API is left alone, since its importers outside the
+// matched packages would no longer compile, and so are generic funcs, methods
+// that implement interfaces, variadic parameters, results other than a single
+// unnamed one, and receivers that make their type satisfy interfaces.
+func canFix(site copySite) bool {
+	if site.breaking {
+		return false
+	}
+	sig := site.fun.Type().(*types.Signature)
+	if sig.TypeParams().Len() > 0 || sig.RecvTypeParams().Len() > 0 || len(site.implements) > 0 {
+		return false
+	}
+	for _, v := range site.values {
+		switch v.role {
+		case "receiver":
+			if len(site.satisfactions) > 0 {
+				return false
+			}
+		case "parameter":
+			if sig.Variadic() && v.index == sig.Params().Len()-1 {
+				return false
+			}
+		case "result":
+			if sig.Results().Len() != 1 || sig.Results().At(0).Name() != "" {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// fixer holds the state of fixSignatures. The packages are loaded with their
+// tests, so a file can be type checked more than once with different objects.
+// Funcs are told apart by their full names, which every copy shares, and an
+// edit made in several copies is made once.
+type fixer struct {
+	fset *token.FileSet
+	// targets are the sites to fix, by the full name of their func.
+	targets map[string]copySite
+	// broken are the full names of targets that can't be fixed.
+	broken map[string]bool
+	// found are the full names of targets whose declaration was seen.
+	found map[string]bool
+	// parents maps the nodes of the loaded files to the nodes they are in.
+	parents map[ast.Node]ast.Node
+	// vars are the receivers and parameters that become pointers.
+	vars map[*types.Var]bool
+	// edits are the insertions to make, by file name.
+	edits map[string]map[insertion]bool
+	// diff, if non-nil, gets the edits as unified diffs instead of the
+	// files.
+	diff io.Writer
+}
+
+// insertion is text to insert at an offset of a file, in place of the cut
+// bytes that follow it.
+type insertion struct {
+	offset int
+	cut    int
+	text   string
+}
+
+func (f *fixer) recordParents(file *ast.File) {
+	stack := []ast.Node{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return false
+		}
+		if len(stack) > 0 {
+			f.parents[n] = stack[len(stack)-1]
+		}
+		stack = append(stack, n)
+		return true
+	})
+}
+
+// target returns the site of the func obj, if it is a target.
+func (f *fixer) target(obj types.Object) (copySite, bool) {
+	fn, ok := obj.(*types.Func)
+	if !ok {
+		return copySite{}, false
+	}
+	site, ok := f.targets[fn.Origin().FullName()]
+	return site, ok
+}
+
+// fixes returns true if fun is fixed.
+func (f *fixer) fixes(fun *types.Func) bool {
+	if fun == nil {
+		return false
+	}
+	name := fun.FullName()
+	_, ok := f.targets[name]
+	return ok && !f.broken[name]
+}
+
+// fixedVars returns the receiver and parameters of fun that site flags.
+func flaggedVars(fun *types.Func, site copySite) []*types.Var {
+	sig := fun.Type().(*types.Signature)
+	vars := []*types.Var{}
+	for _, v := range site.values {
+		switch v.role {
+		case "receiver":
+			vars = append(vars, sig.Recv())
+		case "parameter":
+			vars = append(vars, sig.Params().At(v.index))
+		}
+	}
+	return vars
+}
+
+// flagsResult returns true if site flags the result of its func.
+func flagsResult(site copySite) bool {
+	for _, v := range site.values {
+		if v.role == "result" {
+			return true
+		}
+	}
+	return false
+}
+
+// flagsParam returns true if site flags the parameter at index i.
+func flagsParam(site copySite, i int) bool {
+	for _, v := range site.values {
+		if v.role == "parameter" && v.index == i {
+			return true
+		}
+	}
+	return false
+}
+
+// targetDecls calls fn for the declarations of the targets in pkg.
+func (f *fixer) targetDecls(pkg *packages.Package, fn func(decl *ast.FuncDecl, fun *types.Func, site copySite)) {
+	for _, file := range pkg.Syntax {
+		for _, d := range file.Decls {
+			decl, ok := d.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			fun, ok := pkg.TypesInfo.Defs[decl.Name].(*types.Func)
+			if !ok {
+				continue
+			}
+			if site, ok := f.target(fun); ok {
+				fn(decl, fun, site)
+			}
+		}
+	}
+}
+
+// checkDecls marks the targets declared in pkg whose bodies can't be fixed as
+// broken.
+func (f *fixer) checkDecls(pkg *packages.Package) {
+	info := pkg.TypesInfo
+	f.targetDecls(pkg, func(decl *ast.FuncDecl, fun *types.Func, site copySite) {
+		name := fun.FullName()
+		f.found[name] = true
+		if decl.Body == nil {
+			f.broken[name] = true
+			return
+		}
+		for _, v := range flaggedVars(fun, site) {
+			if mutates(decl.Body, v, info) || outlives(decl.Body, v, info) {
+				f.broken[name] = true
+			}
+		}
+		if flagsResult(site) {
+			returns(decl.Body, func(ret *ast.ReturnStmt) {
+				if len(ret.Results) != 1 || !returnable(ret.Results[0], decl.Body, info) {
+					f.broken[name] = true
+				}
+			})
+		}
+	})
+}
+
+// checkUses marks the targets used in pkg other than in calls that can be
+// fixed as broken.
+func (f *fixer) checkUses(pkg *packages.Package) {
+	info := pkg.TypesInfo
+	for id, obj := range info.Uses {
+		site, ok := f.target(obj)
+		if !ok {
+			continue
+		}
+		name := site.fun.FullName()
+		call := f.callOf(id, info)
+		if call == nil {
+			f.broken[name] = true
+			continue
+		}
+		for _, v := range site.values {
+			switch v.role {
+			case "receiver":
+				x := ast.Unparen(call.Fun).(*ast.SelectorExpr).X
+				if _, ok := info.TypeOf(x).Underlying().(*types.Pointer); !ok && !addressable(x, info) {
+					f.broken[name] = true
+				}
+			case "parameter":
+				if v.index >= len(call.Args) || !addressable(call.Args[v.index], info) {
+					f.broken[name] = true
+				}
+			}
+		}
+	}
+}
+
+// callOf returns the call whose func the use id is, or nil if id is used
+// some other way, like as a func value or a method expression.
+func (f *fixer) callOf(id *ast.Ident, info *types.Info) *ast.CallExpr {
+	var fun ast.Node = id
+	if sel, ok := f.parents[id].(*ast.SelectorExpr); ok && sel.Sel == id {
+		if s := info.Selections[sel]; s != nil && s.Kind() != types.MethodVal {
+			return nil
+		}
+		fun = sel
+	}
+	call, ok := f.parents[fun].(*ast.CallExpr)
+	if !ok || call.Fun != fun {
+		return nil
+	}
+	return call
+}
+
+// collectVars records the receivers and parameters of the fixed funcs of pkg
+// in vars.
+func (f *fixer) collectVars(pkg *packages.Package) {
+	f.targetDecls(pkg, func(decl *ast.FuncDecl, fun *types.Func, site copySite) {
+		if f.broken[fun.FullName()] {
+			return
+		}
+		for _, v := range flaggedVars(fun, site) {
+			f.vars[v] = true
+		}
+	})
+}
+
+// editDecls turns the flagged types of the fixed funcs of pkg into pointers,
+// and has their bodies dereference the receivers and parameters and return
+// the addresses of their results.
+func (f *fixer) editDecls(pkg *packages.Package) {
+	info := pkg.TypesInfo
+	f.targetDecls(pkg, func(decl *ast.FuncDecl, fun *types.Func, site copySite) {
+		if f.broken[fun.FullName()] {
+			return
+		}
+		for _, v := range site.values {
+			switch v.role {
+			case "receiver":
+				f.insert(decl.Recv.List[0].Type.Pos(), "*")
+			case "parameter":
+				f.insert(fieldOf(decl.Type.Params, v.index).Type.Pos(), "*")
+			case "result":
+				f.insert(decl.Type.Results.List[0].Type.Pos(), "*")
+				returns(decl.Body, func(ret *ast.ReturnStmt) {
+					f.insert(ret.Results[0].Pos(), "&")
+				})
+			}
+		}
+	})
+	for id, obj := range info.Uses {
+		if v, ok := obj.(*types.Var); ok && f.vars[v] && f.derefs(id, info) {
+			f.insert(id.Pos(), "*")
+		}
+	}
+}
+
+// derefs returns true if the use id of a receiver or parameter that becomes
+// a pointer has to dereference it. Fields, methods, and array elements can be
+// used through the pointer, and the pointer itself is passed on to the
+// parameters of fixed funcs.
+func (f *fixer) derefs(id *ast.Ident, info *types.Info) bool {
+	switch parent := f.parents[id].(type) {
+	case *ast.SelectorExpr:
+		return parent.X != id
+	case *ast.IndexExpr:
+		return parent.X != id
+	case *ast.SliceExpr:
+		return parent.X != id
+	case *ast.RangeStmt:
+		return parent.X != id
+	case *ast.CallExpr:
+		return !f.passedOn(parent, id, info)
+	}
+	return true
+}
+
+// passedOn returns true if arg is an argument of call whose parameter becomes
+// a pointer.
+func (f *fixer) passedOn(call *ast.CallExpr, arg ast.Expr, info *types.Info) bool {
+	var id *ast.Ident
+	switch fun := ast.Unparen(call.Fun).(type) {
+	case *ast.Ident:
+		id = fun
+	case *ast.SelectorExpr:
+		id = fun.Sel
+	default:
+		return false
+	}
+	site, ok := f.target(info.Uses[id])
+	if !ok || !f.fixes(site.fun) {
+		return false
+	}
+	for i, a := range call.Args {
+		if a == arg {
+			return flagsParam(site, i)
+		}
+	}
+	return false
+}
+
+// editCalls has the calls of the fixed funcs in pkg pass the addresses of
+// their arguments and dereference their results.
+func (f *fixer) editCalls(pkg *packages.Package) {
+	info := pkg.TypesInfo
+	for id, obj := range info.Uses {
+		site, ok := f.target(obj)
+		if !ok || !f.fixes(site.fun) {
+			continue
+		}
+		call := f.callOf(id, info)
+		for _, v := range site.values {
+			switch v.role {
+			case "parameter":
+				arg := call.Args[v.index]
+				if a, ok := arg.(*ast.Ident); ok {
+					if av, ok := info.Uses[a].(*types.Var); ok && f.vars[av] {
+						// Already a pointer.
+						continue
+					}
+				}
+				if star, ok := ast.Unparen(arg).(*ast.StarExpr); ok {
+					// Pass the pointer rather than &*p.
+					f.remove(star.Star, len("*"))
+					continue
+				}
+				f.insert(arg.Pos(), "&")
+			case "result":
+				switch f.parents[call].(type) {
+				case *ast.ExprStmt, *ast.GoStmt, *ast.DeferStmt:
+				case *ast.SelectorExpr, *ast.IndexExpr, *ast.SliceExpr:
+					// Fields, methods, and elements can be used
+					// through the pointer.
+				default:
+					f.insert(call.Pos(), "*")
+				}
+			}
+		}
+	}
+}
+
+func (f *fixer) insert(pos token.Pos, text string) {
+	f.edit(pos, insertion{text: text})
+}
+
+// remove cuts the n bytes at pos.
+func (f *fixer) remove(pos token.Pos, n int) {
+	f.edit(pos, insertion{cut: n})
+}
+
+func (f *fixer) edit(pos token.Pos, e insertion) {
+	tf := f.fset.File(pos)
+	edits := f.edits[tf.Name()]
+	if edits == nil {
+		edits = make(map[insertion]bool)
+		f.edits[tf.Name()] = edits
+	}
+	e.offset = tf.Offset(pos)
+	edits[e] = true
+}
+
+// write makes the edits to the files, or writes them to f.diff, in the order
+// of the files' names. A file is only written if it still parses afterwards.
+func (f *fixer) write() error {
+	names := make([]string, 0, len(f.edits))
+	for name := range f.edits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		edits := f.edits[name]
+		src, err := os.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("unable to fix %s: %s", name, err)
+		}
+		out := []byte{}
+		last := 0
+		for _, e := range sortedInsertions(edits) {
+			out = append(out, src[last:e.offset]...)
+			out = append(out, e.text...)
+			last = e.offset + e.cut
+		}
+		out = append(out, src[last:]...)
+		if _, err := parser.ParseFile(token.NewFileSet(), name, out, parser.ParseComments); err != nil {
+			return fmt.Errorf("unable to fix %s: %s", name, err)
+		}
+		if f.diff != nil {
+			if err := writeUnifiedDiff(f.diff, relPath(name), src, out); err != nil {
+				return err
+			}
+			continue
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			return fmt.Errorf("unable to fix %s: %s", name, err)
+		}
+		if err := os.WriteFile(name, out, info.Mode()); err != nil {
+			return fmt.Errorf("unable to fix %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// sortedInsertions returns the insertions of edits in the order of their
+// offsets, and of their texts at the same offset, where those that cut
+// nothing come first.
+func sortedInsertions(edits map[insertion]bool) []insertion {
+	sorted := make([]insertion, 0, len(edits))
+	for e := range edits {
+		sorted = append(sorted, e)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].offset != sorted[j].offset {
+			return sorted[i].offset < sorted[j].offset
+		}
+		if sorted[i].cut != sorted[j].cut {
+			return sorted[i].cut < sorted[j].cut
+		}
+		return sorted[i].text < sorted[j].text
+	})
+	return sorted
+}
+
+// fieldOf returns the field of list that declares the parameter at index i.
+func fieldOf(list *ast.FieldList, i int) *ast.Field {
+	for _, field := range list.List {
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		if i < n {
+			return field
+		}
+		i -= n
+	}
+	return nil
+}
+
+// returns calls fn for the return statements of body, leaving out those of
+// the func literals in it.
+func returns(body *ast.BlockStmt, fn func(*ast.ReturnStmt)) {
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.ReturnStmt:
+			fn(n)
+		}
+		return true
+	})
+}
+
+// returnable returns true if the address of the returned expr can be returned
+// instead without sharing a value with anything else: a composite literal, or
+// a variable declared in body.
+func returnable(expr ast.Expr, body *ast.BlockStmt, info *types.Info) bool {
+	switch e := ast.Unparen(expr).(type) {
+	case *ast.CompositeLit:
+		return true
+	case *ast.Ident:
+		v, ok := info.Uses[e].(*types.Var)
+		return ok && body.Pos() <= v.Pos() && v.Pos() < body.End()
+	}
+	return false
+}
+
+// mutates returns true if body changes v, any of its fields, or any of its
+// array elements, or takes the address of any of them.
+func mutates(body *ast.BlockStmt, v *types.Var, info *types.Info) bool {
+	is := func(e ast.Expr) bool {
+		return rootVar(e, info) == v
+	}
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			for _, lhs := range n.Lhs {
+				found = found || is(lhs)
+			}
+		case *ast.IncDecStmt:
+			found = found || is(n.X)
+		case *ast.RangeStmt:
+			if n.Tok == token.ASSIGN {
+				found = found || n.Key != nil && is(n.Key) || n.Value != nil && is(n.Value)
+			}
+		}
+		return !found
+	})
+	return found || takesAddress(body, v, info)
+}
+
+// outlives returns true if body uses v in a func literal or a go or defer
+// statement, which could run after a caller changes the value it then shares.
+func outlives(body *ast.BlockStmt, v *types.Var, info *types.Info) bool {
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n.(type) {
+		case *ast.FuncLit, *ast.GoStmt, *ast.DeferStmt:
+			ast.Inspect(n, func(n ast.Node) bool {
+				if id, ok := n.(*ast.Ident); ok && info.Uses[id] == v {
+					found = true
+				}
+				return !found
+			})
+			return false
+		}
+		return !found
+	})
+	return found
+}
+
+// takesAddress returns true if body takes the address of v, any of its
+// fields, or any of its array elements, including by calling a pointer
+// method.
+func takesAddress(body *ast.BlockStmt, v *types.Var, info *types.Info) bool {
+	is := func(e ast.Expr) bool {
+		return rootVar(e, info) == v
+	}
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.UnaryExpr:
+			found = found || n.Op == token.AND && is(n.X)
+		case *ast.SelectorExpr:
+			if s := info.Selections[n]; s != nil && s.Kind() == types.MethodVal {
+				_, ptrRecv := s.Obj().Type().(*types.Signature).Recv().Type().(*types.Pointer)
+				_, ptrX := info.TypeOf(n.X).Underlying().(*types.Pointer)
+				found = found || ptrRecv && !ptrX && is(n.X)
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// rootVar returns the variable whose own memory e is part of, through fields
+// and array elements, or nil if e isn't part of a variable in that way.
+func rootVar(e ast.Expr, info *types.Info) *types.Var {
+	switch e := ast.Unparen(e).(type) {
+	case *ast.Ident:
+		v, _ := info.ObjectOf(e).(*types.Var)
+		return v
+	case *ast.SelectorExpr:
+		if s := info.Selections[e]; s != nil && s.Kind() == types.FieldVal && !s.Indirect() {
+			return rootVar(e.X, info)
+		}
+	case *ast.IndexExpr:
+		if _, ok := info.TypeOf(e.X).Underlying().(*types.Array); ok {
+			return rootVar(e.X, info)
+		}
+	}
+	return nil
+}
+
+// addressable returns true if the address of e can be taken: e is a
+// variable, a field or array element of one, a slice element, a pointer
+// indirection, or a composite literal.
+func addressable(e ast.Expr, info *types.Info) bool {
+	switch e := ast.Unparen(e).(type) {
+	case *ast.Ident:
+		_, ok := info.Uses[e].(*types.Var)
+		return ok
+	case *ast.SelectorExpr:
+		s := info.Selections[e]
+		if s == nil {
+			_, ok := info.Uses[e.Sel].(*types.Var)
+			return ok
+		}
+		if s.Kind() != types.FieldVal {
+			return false
+		}
+		if _, ok := info.TypeOf(e.X).Underlying().(*types.Pointer); ok || s.Indirect() {
+			return true
+		}
+		return addressable(e.X, info)
+	case *ast.IndexExpr:
+		switch t := info.TypeOf(e.X).Underlying().(type) {
+		case *types.Slice:
+			return true
+		case *types.Array:
+			return addressable(e.X, info)
+		case *types.Pointer:
+			_, ok := t.Elem().Underlying().(*types.Array)
+			return ok
+		}
+	case *ast.StarExpr, *ast.CompositeLit:
+		return true
+	}
+	return false
+}
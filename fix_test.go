@@ -0,0 +1,226 @@
+package copyfighter
+
+import (
+	"bytes"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFixSignatures(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, src string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("go.mod", "module example.com/fix\n\ngo 1.22\n")
+	write("fix.go", `package fix
+
+type big struct{ a, b, c int64 }
+
+func (b big) sum() int64 { return b.a + b.b + b.c }
+
+func (b big) reset() { b.a = 0 }
+
+func scale(x big, n int64) big {
+	y := x
+	y.a *= n
+	return y
+}
+
+func keep(x big) {}
+
+var kept = keep
+
+func run() int64 {
+	var b big
+	m := map[int]big{}
+	keep(m[0])
+	s := scale(b, 2)
+	p := &b
+	s = scale(*p, 3)
+	return s.sum() + b.sum()
+}
+`)
+	write("fix_test.go", `package fix
+
+import "testing"
+
+func TestScale(t *testing.T) {
+	if got := scale(big{a: 1}, 2); got.a != 2 {
+		t.Fatal(got)
+	}
+}
+`)
+	t.Chdir(dir)
+	sites, err := check([]string{"./..."}, token.NewFileSet(), limits{max: 16}, &types.StdSizes{WordSize: 8, MaxAlign: 8}, shard{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff := &bytes.Buffer{}
+	if _, _, err := fixSignatures([]string{"./..."}, sites, diff); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(diff.String(), "--- a/fix.go\n+++ b/fix.go\n") || !strings.Contains(diff.String(), "\n+func scale(x *big, n int64) *big {\n") {
+		t.Errorf("diff doesn't rewrite scale:\n%s", diff)
+	}
+	if !strings.Contains(diff.String(), "\n+\ts = *scale(p, 3)\n") {
+		t.Errorf("diff doesn't pass p itself to scale:\n%s", diff)
+	}
+	if src, _ := os.ReadFile(filepath.Join(dir, "fix.go")); strings.Contains(string(src), "*big") {
+		t.Errorf("diff changed fix.go:\n%s", src)
+	}
+	unfixed, fixed, err := fixSignatures([]string{"./..."}, sites, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	left := 0
+	for _, site := range unfixed {
+		if site.check == checkSignature {
+			left++
+		}
+	}
+	if len(fixed) != 2 || left != 2 {
+		t.Errorf("fixed %d and left %d signatures, want 2 and 2", len(fixed), left)
+	}
+	for name, want := range map[string]string{"fix.go": `package fix
+
+type big struct{ a, b, c int64 }
+
+func (b *big) sum() int64 { return b.a + b.b + b.c }
+
+func (b big) reset() { b.a = 0 }
+
+func scale(x *big, n int64) *big {
+	y := *x
+	y.a *= n
+	return &y
+}
+
+func keep(x big) {}
+
+var kept = keep
+
+func run() int64 {
+	var b big
+	m := map[int]big{}
+	keep(m[0])
+	s := *scale(&b, 2)
+	p := &b
+	s = *scale(p, 3)
+	return s.sum() + b.sum()
+}
+`, "fix_test.go": `package fix
+
+import "testing"
+
+func TestScale(t *testing.T) {
+	if got := *scale(&big{a: 1}, 2); got.a != 2 {
+		t.Fatal(got)
+	}
+}
+`} {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("fixed %s:\n%s\nwant:\n%s", name, got, want)
+		}
+	}
+}
+
+func TestFixCaptured(t *testing.T) {
+	dir := t.TempDir()
+	src := `package fix
+
+type Big struct{ a, b, c int64 }
+
+func later(b Big) func() int64 { return func() int64 { return b.a } }
+
+func spawn(b Big, ch chan int64) { go func() { ch <- b.a }() }
+
+func deferred(b Big) { defer println(b.a) }
+
+func (b Big) closure() func() int64 { return func() int64 { return b.b } }
+
+func now(b Big) int64 { return b.a }
+`
+	for name, src := range map[string]string{"go.mod": "module example.com/fix\n\ngo 1.22\n", "fix.go": src} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+	sites, err := check([]string{"./..."}, token.NewFileSet(), limits{max: 16}, &types.StdSizes{WordSize: 8, MaxAlign: 8}, shard{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, fixed, err := fixSignatures([]string{"./..."}, sites, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixed) != 1 || fixed[0].fun.Name() != "now" {
+		t.Errorf("fixed %d signatures, want only that of now", len(fixed))
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "fix.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Replace(src, "now(b Big)", "now(b *Big)", 1); string(got) != want {
+		t.Errorf("fixed fix.go:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestFixExported(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/fix\n\ngo 1.22\n",
+		"a/a.go": `package a
+
+type Big struct{ a, b, c int64 }
+
+func Take(b Big) int64 { return b.a }
+
+func take(b Big) int64 { return b.a }
+
+func Run() int64 { return take(Big{}) }
+`,
+		"b/b.go": `package b
+
+import "example.com/fix/a"
+
+func Use() int64 { return a.Take(a.Big{}) }
+`,
+	}
+	for name, src := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+	// b calls Take from outside the patterns, so fixing Take would break it.
+	patterns := []string{"./a"}
+	sites, err := check(patterns, token.NewFileSet(), limits{max: 16}, &types.StdSizes{WordSize: 8, MaxAlign: 8}, shard{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, fixed, err := fixSignatures(patterns, sites, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixed) != 1 || fixed[0].fun.Name() != "take" {
+		t.Errorf("fixed %d signatures, want only that of take", len(fixed))
+	}
+	if _, err := check([]string{"./..."}, token.NewFileSet(), limits{max: 16}, &types.StdSizes{WordSize: 8, MaxAlign: 8}, shard{}, nil, nil); err != nil {
+		t.Errorf("the fixed module doesn't type check: %s", err)
+	}
+}
@@ -0,0 +1,207 @@
+package copyfighter
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// findInstantiationSites returns a copySite for every generic func in funcs
+// that some of its instantiations in the package turn into a func passing
+// wide values by value. The instantiations of a func are reported together,
+// on the generic declaration, since that is where they would be fixed. Only
+// the parameters and results in roles are reported.
+func findInstantiationSites(funcs []*types.Func, info *types.Info, wide wideTypes, roles signatureRoles) []copySite {
+	declared := make(map[*types.Func]bool)
+	for _, f := range funcs {
+		declared[f] = true
+	}
+	type instantiation struct {
+		name string
+		size int64
+	}
+	byFunc := make(map[*types.Func][]instantiation)
+	flaggedValues := make(map[*types.Func]map[int]bool)
+	seen := make(map[string]bool)
+	values := make(map[*types.Func][]copiedValue)
+	for id, inst := range info.Instances {
+		f, ok := info.Uses[id].(*types.Func)
+		if !ok || !declared[f] {
+			continue
+		}
+		generic := f.Type().(*types.Signature)
+		concrete, ok := inst.Type.(*types.Signature)
+		if !ok {
+			continue
+		}
+		name := instanceName(f, inst.TypeArgs, f.Pkg())
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		size := int64(0)
+		flagged, vs := instanceCopies(generic, concrete, wide, roles)
+		for i := range flagged {
+			if flaggedValues[f] == nil {
+				flaggedValues[f] = make(map[int]bool)
+			}
+			flaggedValues[f][i] = true
+		}
+		for _, v := range vs {
+			size = max(size, v.size)
+		}
+		values[f] = append(values[f], vs...)
+		if size > 0 {
+			byFunc[f] = append(byFunc[f], instantiation{name, size})
+		}
+	}
+
+	sites := []copySite{}
+	for f, insts := range byFunc {
+		sort.Slice(insts, func(i, j int) bool { return insts[i].name < insts[j].name })
+		names := make([]string, len(insts))
+		size := int64(0)
+		for i, inst := range insts {
+			names[i] = fmt.Sprintf("%s (%d bytes)", inst.name, inst.size)
+			if inst.size > size {
+				size = inst.size
+			}
+		}
+		what := describeFlagged(f.Type().(*types.Signature), flaggedValues[f])
+		verb, instantiations := "copies", "the instantiation"
+		if len(what) > 1 {
+			verb = "copy"
+		}
+		if len(names) > 1 {
+			instantiations = "the instantiations"
+		}
+		sites = append(sites, copySite{
+			check:    checkInstantiation,
+			pos:      f.Pos(),
+			fun:      f,
+			what:     fmt.Sprintf("%s %s wide type arguments in %s %s, instantiate with pointer types instead", sentence(what), verb, instantiations, strings.Join(names, ", ")),
+			breaking: isExportedAPI(f),
+			size:     size,
+			values:   values[f],
+		})
+	}
+	return sites
+}
+
+// findForeignInstantiations returns a copySite for every instantiation in a
+// func body of a generic func declared in another package that passes wide
+// values by value, like slices.Index[[]Config, Config]. The declaration
+// can't be fixed from here, so the site is the instantiation itself. Only
+// the parameters and results in roles are reported.
+func findForeignInstantiations(files []*ast.File, info *types.Info, wide wideTypes, roles signatureRoles) []copySite {
+	sites := []copySite{}
+	inspectFuncBodies(files, info, func(fun *types.Func, n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		inst, ok := info.Instances[id]
+		if !ok {
+			return true
+		}
+		f, ok := info.Uses[id].(*types.Func)
+		if !ok || f.Pkg() == fun.Pkg() {
+			return true
+		}
+		concrete, ok := inst.Type.(*types.Signature)
+		if !ok {
+			return true
+		}
+		generic := f.Type().(*types.Signature)
+		flagged, values := instanceCopies(generic, concrete, wide, roles)
+		if len(values) == 0 {
+			return true
+		}
+		size := int64(0)
+		for _, v := range values {
+			size = max(size, v.size)
+		}
+		sites = append(sites, copySite{
+			check:  checkInstantiation,
+			pos:    id.Pos(),
+			fun:    fun,
+			what:   fmt.Sprintf("the instantiation %s (%d bytes) makes its %s copy wide type arguments, instantiate with pointer types instead", instanceName(f, inst.TypeArgs, fun.Pkg()), size, sentence(describeFlagged(generic, flagged))),
+			size:   size,
+			values: values,
+		})
+		return true
+	})
+	return sites
+}
+
+// instanceCopies returns the indexes of the parameters and results, in that
+// order, of the generic signature whose types depend on its type parameters
+// and that the instantiated signature concrete turns into wide values, along
+// with those values. Only the parameters and results in roles are returned.
+func instanceCopies(generic, concrete *types.Signature, wide wideTypes, roles signatureRoles) (map[int]bool, []copiedValue) {
+	flagged := make(map[int]bool)
+	values := []copiedValue{}
+	vars := append(tupleVars(generic.Params()), tupleVars(generic.Results())...)
+	concreteVars := append(tupleVars(concrete.Params()), tupleVars(concrete.Results())...)
+	for i, v := range vars {
+		role := "parameter"
+		if i >= generic.Params().Len() {
+			role = "result"
+		}
+		t := concreteVars[i].Type()
+		if !roles.has(role) || !hasTypeParam(v.Type()) || !wide.isWide(t) {
+			continue
+		}
+		flagged[i] = true
+		values = append(values, copiedValue{typ: t, size: wide.sizes.Sizeof(t)})
+	}
+	return flagged, values
+}
+
+// describeFlagged describes the parameters and results of s at the indexes in
+// flagged, like "parameter 't' at index 0" and "return value at index 0".
+func describeFlagged(s *types.Signature, flagged map[int]bool) []string {
+	params := s.Params()
+	var what []string
+	for i := 0; i < params.Len()+s.Results().Len(); i++ {
+		if !flagged[i] {
+			continue
+		}
+		if i < params.Len() {
+			parameter := "parameter"
+			if name := params.At(i).Name(); name != "" {
+				parameter = fmt.Sprintf("parameter '%s'", name)
+			}
+			what = append(what, fmt.Sprintf("%s at index %d", parameter, i))
+		} else {
+			what = append(what, fmt.Sprintf("return value at index %d", i-params.Len()))
+		}
+	}
+	return what
+}
+
+// instanceName returns the name of f instantiated with args as seen from
+// pkg, like Process[pkg.Big], or slices.Index[[]Big, Big] for a func in
+// another package.
+func instanceName(f *types.Func, args *types.TypeList, pkg *types.Package) string {
+	parts := make([]string, args.Len())
+	for i := range parts {
+		parts[i] = types.TypeString(args.At(i), types.RelativeTo(pkg))
+	}
+	name := f.Name()
+	if f.Pkg() != nil && f.Pkg() != pkg {
+		name = f.Pkg().Name() + "." + name
+	}
+	return fmt.Sprintf("%s[%s]", name, strings.Join(parts, ", "))
+}
+
+// tupleVars returns the variables of t.
+func tupleVars(t *types.Tuple) []*types.Var {
+	vars := make([]*types.Var, t.Len())
+	for i := range vars {
+		vars[i] = t.At(i)
+	}
+	return vars
+}
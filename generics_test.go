@@ -0,0 +1,71 @@
+package copyfighter
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestForeignInstantiations(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.22\n",
+		"gen/gen.go": `package gen
+
+func Keep[T any](t T) T { return t }
+
+func Ptr[T any](t *T) *T { return t }
+`,
+		"app/app.go": `package app
+
+import (
+	"slices"
+
+	"example.com/m/gen"
+)
+
+type Big struct{ a, b, c int64 }
+
+func run(bs []*Big, b *Big) {
+	gen.Keep(*b)
+	gen.Keep(1)
+	gen.Ptr(b)
+	_ = slices.Index(bs, b)
+	_ = gen.Keep[Big]
+}
+`,
+	}
+	for name, src := range files {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+
+	fset := token.NewFileSet()
+	sites, err := check([]string{"./..."}, fset, limits{max: 16}, &types.StdSizes{WordSize: 8, MaxAlign: 8}, shard{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, site := range sites {
+		if site.check == checkInstantiation {
+			p := fset.Position(site.pos)
+			got = append(got, fmt.Sprintf("%s:%d:%d %s", filepath.Base(p.Filename), p.Line, p.Column, site.what))
+		}
+	}
+	want := []string{
+		"app.go:12:6 the instantiation gen.Keep[Big] (24 bytes) makes its parameter 't' at index 0, and return value at index 0 copy wide type arguments, instantiate with pointer types instead",
+		"app.go:16:10 the instantiation gen.Keep[Big] (24 bytes) makes its parameter 't' at index 0, and return value at index 0 copy wide type arguments, instantiate with pointer types instead",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got instantiations\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
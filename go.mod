@@ -0,0 +1,12 @@
+module github.com/lalaladema/copyfighter
+
+go 1.26.0
+
+require (
+	github.com/golangci/plugin-module-register v0.1.2
+	github.com/google/pprof v0.0.0-20260926063103-aaccee046517
+	golang.org/x/mod v0.41.0
+	golang.org/x/tools v0.50.0
+)
+
+require golang.org/x/sync v0.23.0 // indirect
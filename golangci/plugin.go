@@ -0,0 +1,45 @@
+// Package golangci registers copyfighter as a golangci-lint module plugin,
+// so that it runs alongside the other linters of a custom golangci-lint
+// binary with their caching, exclusions, and //nolint directives. Build one
+// with golangci-lint custom and a .custom-gcl.yml that lists this module and
+// imports this package.
+package golangci
+
+import (
+	"github.com/golangci/plugin-module-register/register"
+	"github.com/lalaladema/copyfighter/analyzer"
+	"golang.org/x/tools/go/analysis"
+)
+
+func init() {
+	register.Plugin("copyfighter", New)
+}
+
+// plugin is copyfighter's golangci-lint plugin.
+type plugin struct {
+	settings analyzer.Settings
+}
+
+// New returns the plugin configured by the settings of the linter in
+// .golangci.yml, whose keys are the JSON names of analyzer.Settings. A max of
+// zero, or none, is the analyzer's default.
+func New(conf any) (register.LinterPlugin, error) {
+	s, err := register.DecodeSettings[analyzer.Settings](conf)
+	if err != nil {
+		return nil, err
+	}
+	if s.Max <= 0 {
+		s.Max = analyzer.DefaultSettings().Max
+	}
+	return &plugin{settings: s}, nil
+}
+
+func (p *plugin) BuildAnalyzers() ([]*analysis.Analyzer, error) {
+	return []*analysis.Analyzer{analyzer.New(p.settings)}, nil
+}
+
+// GetLoadMode asks for type information, which every check needs to size
+// values.
+func (p *plugin) GetLoadMode() string {
+	return register.LoadModeTypesInfo
+}
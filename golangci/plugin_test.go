@@ -0,0 +1,40 @@
+package golangci
+
+import (
+	"testing"
+
+	"github.com/golangci/plugin-module-register/register"
+	"github.com/lalaladema/copyfighter/analyzer"
+)
+
+func TestNew(t *testing.T) {
+	newPlugin, err := register.GetPlugin("copyfighter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := newPlugin(map[string]any{"max": 32, "fields": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := p.(*plugin).settings, (analyzer.Settings{Max: 32, Fields: true}); got != want {
+		t.Errorf("settings = %+v, want %+v", got, want)
+	}
+	if got := p.GetLoadMode(); got != register.LoadModeTypesInfo {
+		t.Errorf("load mode = %q, want %q", got, register.LoadModeTypesInfo)
+	}
+	analyzers, err := p.BuildAnalyzers()
+	if err != nil || len(analyzers) != 1 || analyzers[0].Name != "copyfighter" {
+		t.Errorf("BuildAnalyzers() = %v, %v, want the copyfighter analyzer", analyzers, err)
+	}
+
+	p, err = newPlugin(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := p.(*plugin).settings, analyzer.DefaultSettings(); got != want {
+		t.Errorf("settings without configuration = %+v, want %+v", got, want)
+	}
+	if _, err := newPlugin(map[string]any{"maximum": 32}); err == nil {
+		t.Error("unknown setting was accepted")
+	}
+}
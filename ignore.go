@@ -0,0 +1,134 @@
+package copyfighter
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// ignoreFileName is the file, in the working directory, that lists the paths
+// whose sites are dropped.
+const ignoreFileName = ".copyfighterignore"
+
+// ignoreRule is one pattern line of an ignore file.
+type ignoreRule struct {
+	// segments are the slash-separated parts of the pattern.
+	segments []string
+	// negate re-includes the paths matched by a pattern starting with '!'.
+	negate bool
+	// dirOnly restricts a pattern ending with '/' to directories.
+	dirOnly bool
+	// anchored patterns contain a slash before their end and match from the
+	// working directory. The others match a file or directory name at any
+	// depth.
+	anchored bool
+}
+
+// ignoreRules are the rules of an ignore file, in the order they appear.
+type ignoreRules []ignoreRule
+
+// readIgnoreFile parses the gitignore-style file at p. A missing file has no
+// rules.
+func readIgnoreFile(p string) (ignoreRules, error) {
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to open ignore file: %s", err)
+	}
+	defer f.Close()
+	var rules ignoreRules
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreRule(scanner.Text()); ok {
+			rules = append(rules, rule)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read ignore file: %s", err)
+	}
+	return rules, nil
+}
+
+// parseIgnoreRule parses one line of an ignore file. ok is false for blank
+// lines and comments.
+func parseIgnoreRule(line string) (rule ignoreRule, ok bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule, false
+	}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		// \# and \! start patterns with a literal # or !.
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	rule.anchored = strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if line == "" {
+		return rule, false
+	}
+	rule.segments = strings.Split(line, "/")
+	return rule, true
+}
+
+// ignores reports whether the file at the slash-separated path p, relative to
+// the working directory, is ignored. A file is ignored if the last rule that
+// matches it or one of its parent directories isn't negated.
+func (rules ignoreRules) ignores(p string) bool {
+	parts := strings.Split(p, "/")
+	ignored := false
+	for _, rule := range rules {
+		for i := range parts {
+			isDir := i < len(parts)-1
+			if rule.dirOnly && !isDir {
+				continue
+			}
+			if rule.matches(parts[:i+1]) {
+				ignored = !rule.negate
+				break
+			}
+		}
+	}
+	return ignored
+}
+
+// matches reports whether the rule matches the path made of parts.
+func (rule ignoreRule) matches(parts []string) bool {
+	if !rule.anchored {
+		ok, _ := path.Match(rule.segments[0], parts[len(parts)-1])
+		return ok
+	}
+	return matchSegments(rule.segments, parts)
+}
+
+// matchSegments matches the path parts against the pattern segments, where a
+// "**" segment matches any number of parts.
+func matchSegments(segments, parts []string) bool {
+	for len(segments) > 0 {
+		if segments[0] == "**" {
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(segments[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(segments[0], parts[0]); !ok {
+			return false
+		}
+		segments, parts = segments[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
@@ -0,0 +1,42 @@
+package copyfighter
+
+import "testing"
+
+func TestIgnoreRules(t *testing.T) {
+	var rules ignoreRules
+	for _, line := range []string{
+		"# generated code",
+		"",
+		"*.pb.go",
+		"gen/",
+		"/third_party",
+		"internal/**/mock_*.go",
+		"!internal/keep/mock_kept.go",
+	} {
+		if rule, ok := parseIgnoreRule(line); ok {
+			rules = append(rules, rule)
+		}
+	}
+	tests := []struct {
+		path    string
+		ignored bool
+	}{
+		{"api.pb.go", true},
+		{"pkg/api/api.pb.go", true},
+		{"pkg/api/api.go", false},
+		{"gen/types.go", true},
+		{"pkg/gen/types.go", true},
+		{"pkg/gen.go", false},
+		{"third_party/lib/lib.go", true},
+		{"pkg/third_party/lib.go", false},
+		{"internal/mock_db.go", true},
+		{"internal/a/b/mock_db.go", true},
+		{"internal/keep/mock_kept.go", false},
+		{"pkg/mock_db.go", false},
+	}
+	for _, tt := range tests {
+		if got := rules.ignores(tt.path); got != tt.ignored {
+			t.Errorf("ignores(%q) = %v, want %v", tt.path, got, tt.ignored)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package copyfighter
+
+import (
+	"fmt"
+	"go/types"
+	"sort"
+)
+
+// addFixImpact sets the refs and satisfactions of the signature sites, which
+// together with their calls say how much code making the pointers suggested
+// by a site changes.
+func addFixImpact(sites []copySite, info *types.Info, calls map[*types.Func]int) {
+	uses := make(map[*types.Func]int)
+	for _, obj := range info.Uses {
+		if f, ok := obj.(*types.Func); ok {
+			uses[f]++
+		}
+	}
+	ifaces := usedInterfaces(info)
+	for i := range sites {
+		site := &sites[i]
+		if site.check != checkSignature {
+			continue
+		}
+		// Uses that aren't calls are method values, method expressions,
+		// and funcs stored in variables, whose types change with the
+		// signature.
+		if refs := uses[site.fun] - calls[site.fun]; refs > 0 {
+			site.refs = refs
+		}
+		if len(site.shouldBe) == 0 || site.shouldBe[0] != "receiver" {
+			continue
+		}
+		// A value receiver becoming a pointer receiver drops the method
+		// from the value type's method set, so values of the type no
+		// longer satisfy interfaces with the method.
+		rt := site.fun.Type().(*types.Signature).Recv().Type()
+		for _, iface := range ifaces {
+			it := iface.Underlying().(*types.Interface)
+			if hasMethod(it, site.fun.Name()) && types.Implements(rt, it) {
+				site.satisfactions = append(site.satisfactions, types.TypeString(iface, types.RelativeTo(site.fun.Pkg())))
+			}
+		}
+		sort.Strings(site.satisfactions)
+	}
+}
+
+// usedInterfaces returns the interface types with methods declared or
+// referred to in info, each method set once and declared types first.
+func usedInterfaces(info *types.Info) []types.Type {
+	seen := make(map[string]bool)
+	ifaces := []types.Type{}
+	add := func(t types.Type) {
+		if !isMethodInterface(t) {
+			return
+		}
+		// Key by method set, so an interface declaration's type literal
+		// isn't counted again after the declared type.
+		key := types.TypeString(t.Underlying(), nil)
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		ifaces = append(ifaces, t)
+	}
+	for _, obj := range info.Defs {
+		if tn, ok := obj.(*types.TypeName); ok && !isGeneric(tn.Type()) {
+			add(tn.Type())
+		}
+	}
+	for _, tv := range info.Types {
+		if tv.IsType() && !hasTypeParam(tv.Type) {
+			add(tv.Type)
+		}
+	}
+	return ifaces
+}
+
+// hasMethod returns true if it has a method with the given name.
+func hasMethod(it *types.Interface, name string) bool {
+	for i := 0; i < it.NumMethods(); i++ {
+		if it.Method(i).Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// impactLabel describes how much code fixing site changes.
+func (site copySite) impactLabel() string {
+	return fmt.Sprintf(" [fix changes %s, %s, and %s]",
+		plural(site.calls, "call site"),
+		plural(site.refs, "other reference"),
+		plural(len(site.satisfactions), "interface satisfaction"))
+}
+
+// plural returns n followed by noun, made plural unless n is 1.
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
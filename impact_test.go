@@ -0,0 +1,43 @@
+package copyfighter
+
+import "testing"
+
+func TestFixImpact(t *testing.T) {
+	const src = `package a
+
+type Big struct{ a, b, c int64 }
+
+type Summer interface{ Sum() int64 }
+
+func (b Big) Sum() int64 { return b.a + b.b + b.c }
+
+func Load(b Big) {}
+
+var load = Load
+
+func run() int64 {
+	Load(Big{})
+	Load(Big{})
+	var s Summer = Big{}
+	return s.Sum()
+}
+`
+	sites, _ := checkModule(t, map[string]string{"a.go": src})
+	want := map[string]string{
+		"Load": " [fix changes 2 call sites, 1 other reference, and 0 interface satisfactions]",
+		"Sum":  " [fix changes 0 call sites, 0 other references, and 1 interface satisfaction]",
+	}
+	for _, site := range sites {
+		if site.check != checkSignature {
+			continue
+		}
+		name := site.fun.Name()
+		if got := site.impactLabel(); got != want[name] {
+			t.Errorf("%s is labeled %q, want %q", name, got, want[name])
+		}
+		delete(want, name)
+	}
+	if len(want) > 0 {
+		t.Errorf("found no signature sites for %v", want)
+	}
+}
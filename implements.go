@@ -0,0 +1,81 @@
+package copyfighter
+
+import (
+	"go/types"
+	"sort"
+)
+
+// addImplements sets the implements of the signature sites of methods whose
+// signature an interface dictates: the interface has a method of the same
+// name that the receiver type satisfies, so changing a flagged parameter or
+// result breaks the implementation, as does changing a value receiver the
+// value type needs. The interfaces are those declared in or referred to by
+// info and those exported by the packages the sites' package imports, like
+// io.Writer.
+func addImplements(sites []copySite, info *types.Info) {
+	var pkg *types.Package
+	for _, site := range sites {
+		if site.check == checkSignature {
+			pkg = site.fun.Pkg()
+			break
+		}
+	}
+	if pkg == nil {
+		return
+	}
+	ifaces := usedInterfaces(info)
+	seen := make(map[types.Type]bool)
+	for _, t := range ifaces {
+		seen[t] = true
+	}
+	for _, imp := range pkg.Imports() {
+		scope := imp.Scope()
+		for _, name := range scope.Names() {
+			tn, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok || !tn.Exported() || isGeneric(tn.Type()) || seen[tn.Type()] {
+				continue
+			}
+			if isMethodInterface(tn.Type()) {
+				seen[tn.Type()] = true
+				ifaces = append(ifaces, tn.Type())
+			}
+		}
+	}
+	for i := range sites {
+		site := &sites[i]
+		if site.check != checkSignature {
+			continue
+		}
+		recv := site.fun.Type().(*types.Signature).Recv()
+		if recv == nil {
+			continue
+		}
+		rt := recv.Type()
+		if p, ok := rt.(*types.Pointer); ok {
+			rt = p.Elem()
+		}
+		if types.IsInterface(rt) {
+			// The interface's own methods set the contract.
+			continue
+		}
+		flagsRecv, flagsOthers := false, false
+		for _, v := range site.values {
+			if v.role == "receiver" {
+				flagsRecv = true
+			} else {
+				flagsOthers = true
+			}
+		}
+		for _, iface := range ifaces {
+			it := iface.Underlying().(*types.Interface)
+			if !hasMethod(it, site.fun.Name()) {
+				continue
+			}
+			byValue := types.Implements(rt, it)
+			if flagsRecv && byValue || flagsOthers && (byValue || types.Implements(types.NewPointer(rt), it)) {
+				site.implements = append(site.implements, types.TypeString(iface, types.RelativeTo(site.fun.Pkg())))
+			}
+		}
+		sort.Strings(site.implements)
+	}
+}
@@ -0,0 +1,63 @@
+package copyfighter
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// The parts of the JUnit XML report that writeJUnit uses.
+type (
+	junitTestSuites struct {
+		XMLName  xml.Name         `xml:"testsuites"`
+		Name     string           `xml:"name,attr"`
+		Tests    int              `xml:"tests,attr"`
+		Failures int              `xml:"failures,attr"`
+		Suites   []junitTestSuite `xml:"testsuite"`
+	}
+	junitTestSuite struct {
+		Name     string          `xml:"name,attr"`
+		Tests    int             `xml:"tests,attr"`
+		Failures int             `xml:"failures,attr"`
+		Cases    []junitTestCase `xml:"testcase"`
+	}
+	junitTestCase struct {
+		Name      string       `xml:"name,attr"`
+		ClassName string       `xml:"classname,attr"`
+		Failure   junitFailure `xml:"failure"`
+	}
+	junitFailure struct {
+		Message string `xml:"message,attr"`
+		// Type is the check ID.
+		Type string `xml:"type,attr"`
+		Text string `xml:",chardata"`
+	}
+)
+
+// writeJUnit writes the sites as a JUnit XML report, with a test suite per
+// file holding a failed test case per site, for CI systems that show test
+// results but not lint results. A case is named after its check ID and
+// position, and its failure's text is the site's line of the quickfix format,
+// with the widest type's size.
+func writeJUnit(w io.Writer, r *report) error {
+	out := junitTestSuites{Name: "copyfighter", Tests: len(r.sites), Failures: len(r.sites), Suites: []junitTestSuite{}}
+	names, sites := r.sitesByFile()
+	for _, name := range names {
+		suite := junitTestSuite{Name: name, Tests: len(sites[name]), Failures: len(sites[name])}
+		for _, site := range sites[name] {
+			position := r.fset.Position(site.pos)
+			at := fmt.Sprintf("%s:%d:%d", name, position.Line, position.Column)
+			suite.Cases = append(suite.Cases, junitTestCase{
+				Name:      fmt.Sprintf("%s %s", site.check, at),
+				ClassName: name,
+				Failure: junitFailure{
+					Message: site.message(r.labels),
+					Type:    site.check,
+					Text:    fmt.Sprintf("%s: %s: %s", at, r.tiers.of(site), site.labeledMessage(r.labels)),
+				},
+			})
+		}
+		out.Suites = append(out.Suites, suite)
+	}
+	return writeXML(w, out)
+}
@@ -0,0 +1,127 @@
+package copyfighter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// limits are the sizes in bytes values must exceed for each check to report
+// them, and the parts of signatures the signature checks look at.
+type limits struct {
+	// max applies to the checks that have no size of their own.
+	max int64
+	// byCheck are the sizes of single checks, by check ID.
+	byCheck map[string]int64
+	roles   signatureRoles
+	// off are the IDs of the checks that are turned off.
+	off map[string]bool
+}
+
+// signatureRoles are the roles of the values in signatures that are reported
+// when they are wide: "receiver", "parameter", and "result". A nil
+// signatureRoles has all of them.
+type signatureRoles map[string]bool
+
+// has returns true if r has role.
+func (r signatureRoles) has(role string) bool {
+	return r == nil || r[role]
+}
+
+// roleNames maps the names -check takes to the roles they stand for.
+var roleNames = map[string]string{
+	"receiver": "receiver",
+	"param":    "parameter",
+	"result":   "result",
+}
+
+// parseRoles parses a comma separated list of the names in roleNames, like
+// "receiver,param".
+func parseRoles(s string) (signatureRoles, error) {
+	r := make(signatureRoles)
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		role, ok := roleNames[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown signature part %#v, must be receiver, param, or result", name)
+		}
+		r[role] = true
+	}
+	return r, nil
+}
+
+// parseChecks parses the value of -check: a comma separated list of the
+// names in roleNames and of check IDs with a "-" prefix, which turn those
+// checks off, like "param,result,-chan". A list without any names in
+// roleNames leaves every part of signatures reported.
+func parseChecks(s string) (signatureRoles, map[string]bool, error) {
+	off := make(map[string]bool)
+	names := []string{}
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		id, ok := strings.CutPrefix(name, "-")
+		if !ok {
+			names = append(names, name)
+			continue
+		}
+		if _, ok := checks[id]; !ok {
+			return nil, nil, fmt.Errorf("unknown check %#v in -check, known checks are %s", id, strings.Join(checkIDs(), ", "))
+		}
+		off[id] = true
+	}
+	if len(off) > 0 && strings.Join(names, "") == "" {
+		return nil, off, nil
+	}
+	roles, err := parseRoles(strings.Join(names, ","))
+	return roles, off, err
+}
+
+// enabled returns the sites whose checks l doesn't turn off.
+func (l limits) enabled(sites []copySite) []copySite {
+	if len(l.off) == 0 {
+		return sites
+	}
+	kept := []copySite{}
+	for _, site := range sites {
+		if !l.off[site.check] {
+			kept = append(kept, site)
+		}
+	}
+	return kept
+}
+
+// of returns the size values must exceed for the given check to report them.
+func (l limits) of(check string) int64 {
+	if n, ok := l.byCheck[check]; ok {
+		return n
+	}
+	return l.max
+}
+
+// parseLimits parses a comma separated list of check ID and size pairs, like
+// "boxed-receiver=8,select=64", into limits whose other checks use max.
+func parseLimits(s string, max int64) (limits, error) {
+	l := limits{max: max, byCheck: make(map[string]int64)}
+	if s == "" {
+		return l, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		id, size, ok := strings.Cut(pair, "=")
+		if !ok {
+			return limits{}, fmt.Errorf("invalid check size %#v, want ID=N", pair)
+		}
+		id = strings.TrimSpace(id)
+		if _, ok := checks[id]; !ok {
+			return limits{}, fmt.Errorf("unknown check %#v in check sizes, known checks are %s", id, strings.Join(checkIDs(), ", "))
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(size), 10, 64)
+		if err != nil || n < 0 {
+			return limits{}, fmt.Errorf("invalid size %#v for check %#v", size, id)
+		}
+		l.byCheck[id] = n
+	}
+	return l, nil
+}
@@ -0,0 +1,151 @@
+package copyfighter
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestParseLimits(t *testing.T) {
+	lim, err := parseLimits("boxed-receiver=8, select=64", 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for check, want := range map[string]int64{checkBoxedReceiver: 8, checkSelect: 64, checkSignature: 16} {
+		if got := lim.of(check); got != want {
+			t.Errorf("lim.of(%q) = %d, want %d", check, got, want)
+		}
+	}
+	for _, s := range []string{"bogus=8", "select", "select=big", "select=-1"} {
+		if _, err := parseLimits(s, 16); err == nil {
+			t.Errorf("parseLimits(%q) succeeded", s)
+		}
+	}
+}
+
+func TestParseRoles(t *testing.T) {
+	roles, err := parseRoles("receiver, param")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for role, want := range map[string]bool{"receiver": true, "parameter": true, "result": false} {
+		if got := roles.has(role); got != want {
+			t.Errorf("roles.has(%q) = %v, want %v", role, got, want)
+		}
+	}
+	if _, err := parseRoles("returns"); err == nil {
+		t.Error(`parseRoles("returns") succeeded`)
+	}
+}
+
+func TestParseChecks(t *testing.T) {
+	roles, off, err := parseChecks("-chan, -boxing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if roles != nil || !off[checkChan] || !off[checkBoxing] || off[checkSignature] {
+		t.Errorf(`parseChecks("-chan, -boxing") = %v, %v`, roles, off)
+	}
+	roles, off, err = parseChecks("param,-chan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !roles.has("parameter") || roles.has("receiver") || !off[checkChan] {
+		t.Errorf(`parseChecks("param,-chan") = %v, %v`, roles, off)
+	}
+	if _, _, err := parseChecks("-channels"); err == nil {
+		t.Error(`parseChecks("-channels") succeeded`)
+	}
+	lim := limits{off: off}
+	sites := lim.enabled([]copySite{{check: checkChan}, {check: checkSignature}})
+	if len(sites) != 1 || sites[0].check != checkSignature {
+		t.Errorf("enabled kept %v, want the signature site", sites)
+	}
+}
+
+func TestFindCopySitesRoles(t *testing.T) {
+	pkg := types.NewPackage("example.com/p", "p")
+	big := types.NewNamed(types.NewTypeName(token.NoPos, pkg, "Big", nil), types.NewArray(types.Typ[types.Int64], 8), nil)
+	sig := types.NewSignatureType(types.NewVar(token.NoPos, pkg, "b", big), nil, nil,
+		types.NewTuple(types.NewVar(token.NoPos, pkg, "x", big)),
+		types.NewTuple(types.NewVar(token.NoPos, pkg, "", big)), false)
+	fn := types.NewFunc(token.NoPos, pkg, "M", sig)
+	wide := wideTypes{named: map[*types.TypeName]bool{big.Obj(): true}, sizes: &types.StdSizes{WordSize: 8, MaxAlign: 8}, max: 16}
+	for s, want := range map[string]int{"receiver,param,result": 3, "param": 1, "receiver,result": 2} {
+		roles, err := parseRoles(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := 0
+		for _, site := range findCopySites([]*types.Func{fn}, wide, abiRegisters{}, roles) {
+			got += len(site.values)
+		}
+		if got != want {
+			t.Errorf("-check %s: got %d values, want %d", s, got, want)
+		}
+	}
+}
+
+func TestMaxDirective(t *testing.T) {
+	const src = `package p
+
+// hot is copied in a tight loop.
+//
+//copyfighter:max=8
+type hot struct{ a, b int64 }
+
+//copyfighter:max=128 built once at startup
+type config struct{ a, b, c, d int64 }
+
+type plain struct{ a, b, c int64 }
+
+//copyfighter:max=lots
+type bad struct{ a, b, c int64 }
+
+func Hot(h hot) {}
+
+func Config(c config) {}
+
+func Plain(p plain) {}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &types.Info{
+		Types: make(map[ast.Expr]types.TypeAndValue),
+		Defs:  make(map[*ast.Ident]types.Object),
+		Uses:  make(map[*ast.Ident]types.Object),
+	}
+	sizes := &types.StdSizes{WordSize: 8, MaxAlign: 8}
+	files := []*ast.File{file}
+	if _, err := (&types.Config{Sizes: sizes}).Check("example.com/p", fset, files, info); err != nil {
+		t.Fatal(err)
+	}
+	skips := newSkipLog()
+	decls := collectDecls(files, info, fset, sizes, 16, skips)
+	wide := wideTypes{named: decls.named, maxes: decls.maxes, sizes: sizes}
+	sites := findSites(files, info, decls, wide, limits{max: 16}, nil)
+	got := []string{}
+	for _, site := range sites {
+		if site.check == checkSignature {
+			got = append(got, site.fun.Name()+site.sizeNote())
+		}
+	}
+	sort.Strings(got)
+	want := []string{
+		"Hot; 'hot' is 16 bytes (declared at p.go:6 with max 8), max 16",
+		"Plain; 'plain' is 24 bytes (declared at p.go:11), max 16",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("found %q, want %q", got, want)
+	}
+	if bad := skips.entities[skipBadDirective]; len(bad) != 1 || !strings.Contains(bad[0], "bad") {
+		t.Errorf("recorded %v as invalid directives, want the one on bad", bad)
+	}
+}
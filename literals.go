@@ -0,0 +1,62 @@
+package copyfighter
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+)
+
+// findLiteralCopies returns a copySite for every field of a struct literal
+// that is set to an existing wide value, as in Request{Config: globalCfg},
+// which copies globalCfg into the new struct. Fields set to composite
+// literals or call results are built in place and aren't reported.
+func findLiteralCopies(files []*ast.File, info *types.Info, wide wideTypes) []copySite {
+	sites := []copySite{}
+	inspectFuncBodies(files, info, func(fun *types.Func, n ast.Node) bool {
+		lit, ok := n.(*ast.CompositeLit)
+		if !ok {
+			return true
+		}
+		lt := info.TypeOf(lit)
+		if lt == nil {
+			return true
+		}
+		st, ok := lt.Underlying().(*types.Struct)
+		if !ok {
+			return true
+		}
+		for i, elt := range lit.Elts {
+			value := elt
+			field := st.Field(i)
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				value = kv.Value
+				id, ok := kv.Key.(*ast.Ident)
+				if !ok {
+					continue
+				}
+				field, ok = info.Uses[id].(*types.Var)
+				if !ok {
+					continue
+				}
+			}
+			switch ast.Unparen(value).(type) {
+			case *ast.CompositeLit, *ast.CallExpr:
+				continue
+			}
+			if !wide.isWide(field.Type()) {
+				continue
+			}
+			size := wide.sizes.Sizeof(field.Type())
+			sites = append(sites, copySite{
+				check:  checkLiteral,
+				pos:    value.Pos(),
+				fun:    fun,
+				what:   fmt.Sprintf("field '%s' of '%s' literal copies '%s' of type '%s' (%d bytes), consider making the field a pointer", field.Name(), typeString(lt, fun.Pkg()), types.ExprString(value), typeString(field.Type(), fun.Pkg()), size),
+				size:   size,
+				values: []copiedValue{{typ: field.Type(), size: size}},
+			})
+		}
+		return true
+	})
+	return sites
+}
@@ -0,0 +1,746 @@
+package copyfighter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"go/types"
+	"io"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// lspOverlay maps the absolute paths of the files an editor has open to
+// their unsaved contents, which packages are loaded with in place of the
+// files on disk. Only the lsp command sets it.
+var lspOverlay map[string][]byte
+
+// lspDelay is how long the lsp command waits after the last change to a
+// package's files before analyzing it again, so that typing doesn't start an
+// analysis on every keystroke.
+var lspDelay = 500 * time.Millisecond
+
+// serveLSP speaks the Language Server Protocol on in and out until the client
+// asks it to exit. The package of every file the client opens is analyzed,
+// and again after each save and, with unsaved contents, after each pause in
+// changes, and its findings are published as diagnostics. By-value
+// signatures that fixSignatures can rewrite have a quick fix code action
+// that makes the rewrite. Struct declarations have inlay hints with their
+// sizes, and code lenses that count and list the findings that copy them.
+// tiers set the severities of the diagnostics.
+func serveLSP(in io.Reader, out io.Writer, lim limits, sizes types.Sizes, filter siteFilter, tiers severityTiers) error {
+	s := &lspServer{
+		out:     out,
+		lim:     lim,
+		sizes:   sizes,
+		filter:  filter,
+		tiers:   tiers,
+		files:   make(map[string][]lspFinding),
+		structs: make(map[string][]lspStruct),
+	}
+	lspOverlay = make(map[string][]byte)
+	defer func() { lspOverlay = nil }()
+
+	msgs := make(chan []byte)
+	errs := make(chan error, 1)
+	go func() {
+		r := bufio.NewReader(in)
+		for {
+			b, err := readLSPMessage(r)
+			if err != nil {
+				errs <- err
+				return
+			}
+			msgs <- b
+		}
+	}()
+	pending := make(map[string]bool)
+	var timer <-chan time.Time
+	for {
+		select {
+		case b := <-msgs:
+			var msg lspMessage
+			if err := json.Unmarshal(b, &msg); err != nil {
+				return fmt.Errorf("unable to parse LSP message: %s", err)
+			}
+			dir, changed := s.handle(msg)
+			switch {
+			case s.exited:
+				if !s.shutdown {
+					return fmt.Errorf("client exited without shutting down")
+				}
+				return nil
+			case dir == "":
+			case changed:
+				pending[dir] = true
+				timer = time.After(lspDelay)
+			default:
+				delete(pending, dir)
+				s.analyze(dir)
+			}
+		case <-timer:
+			dirs := make([]string, 0, len(pending))
+			for dir := range pending {
+				dirs = append(dirs, dir)
+			}
+			sort.Strings(dirs)
+			for _, dir := range dirs {
+				s.analyze(dir)
+			}
+			clear(pending)
+			timer = nil
+		case err := <-errs:
+			if err == io.EOF {
+				return fmt.Errorf("client closed the connection without exiting")
+			}
+			return err
+		}
+	}
+}
+
+// readLSPMessage reads the content of the next message from r, whose header
+// gives its length.
+func readLSPMessage(r *bufio.Reader) ([]byte, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid LSP Content-Length %#v", header.Get("Content-Length"))
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// lspServer is the state of serveLSP.
+type lspServer struct {
+	out    io.Writer
+	lim    limits
+	sizes  types.Sizes
+	filter siteFilter
+	// tiers set the severities of the diagnostics.
+	tiers severityTiers
+	// resolve is true if the client resolves the edits of code actions
+	// lazily, with codeAction/resolve.
+	resolve bool
+	// refresh is true if the client asks for inlay hints and code lenses
+	// again when told to, after each analysis.
+	refresh bool
+	// files are the findings last published for each file that has any.
+	files map[string][]lspFinding
+	// structs are the struct types declared in each file that has any, as
+	// of the last analysis of its package.
+	structs map[string][]lspStruct
+	// requests is the number of requests sent to the client.
+	requests int
+	shutdown bool
+	exited   bool
+}
+
+// lspStruct is a struct type declared at package level, with the locations
+// of the findings that copy it by value.
+type lspStruct struct {
+	name lspRange
+	size int64
+	uses []lspLocation
+}
+
+// lspFinding is a site as published, with the file set of its analysis.
+type lspFinding struct {
+	site copySite
+	fset *token.FileSet
+	diag lspDiagnostic
+}
+
+type (
+	lspMessage struct {
+		ID     *json.RawMessage `json:"id,omitempty"`
+		Method string           `json:"method"`
+		Params json.RawMessage  `json:"params,omitempty"`
+	}
+	lspError struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	lspPosition struct {
+		Line      int `json:"line"`
+		Character int `json:"character"`
+	}
+	lspRange struct {
+		Start lspPosition `json:"start"`
+		End   lspPosition `json:"end"`
+	}
+	lspLocation struct {
+		URI   string   `json:"uri"`
+		Range lspRange `json:"range"`
+	}
+	lspDiagnostic struct {
+		Range              lspRange         `json:"range"`
+		Severity           int              `json:"severity"`
+		Code               string           `json:"code"`
+		CodeDescription    *lspHref         `json:"codeDescription,omitempty"`
+		Source             string           `json:"source"`
+		Message            string           `json:"message"`
+		RelatedInformation []lspRelatedInfo `json:"relatedInformation,omitempty"`
+	}
+	lspHref struct {
+		Href string `json:"href"`
+	}
+	lspRelatedInfo struct {
+		Location lspLocation `json:"location"`
+		Message  string      `json:"message"`
+	}
+	lspTextDocument struct {
+		URI  string `json:"uri"`
+		Text string `json:"text"`
+	}
+	lspTextEdit struct {
+		Range   lspRange `json:"range"`
+		NewText string   `json:"newText"`
+	}
+	lspWorkspaceEdit struct {
+		Changes map[string][]lspTextEdit `json:"changes"`
+	}
+	lspCodeAction struct {
+		Title       string            `json:"title"`
+		Kind        string            `json:"kind"`
+		Diagnostics []lspDiagnostic   `json:"diagnostics,omitempty"`
+		Edit        *lspWorkspaceEdit `json:"edit,omitempty"`
+		// Data is the file and func of the action's finding, to find
+		// it again when the action is resolved.
+		Data *lspActionData `json:"data,omitempty"`
+	}
+	lspActionData struct {
+		URI  string `json:"uri"`
+		Func string `json:"func"`
+	}
+	lspInlayHint struct {
+		Position     lspPosition `json:"position"`
+		Label        string      `json:"label"`
+		Kind         int         `json:"kind"`
+		PaddingLeft  bool        `json:"paddingLeft"`
+		PaddingRight bool        `json:"paddingRight"`
+	}
+	lspCodeLens struct {
+		Range   lspRange   `json:"range"`
+		Command lspCommand `json:"command"`
+	}
+	lspCommand struct {
+		Title     string `json:"title"`
+		Command   string `json:"command"`
+		Arguments []any  `json:"arguments,omitempty"`
+	}
+)
+
+// LSP error codes, diagnostic severities, and inlay hint kinds.
+const (
+	lspMethodNotFound = -32601
+	lspInvalidParams  = -32602
+	lspSeverityError  = 1
+	lspSeverityWarn   = 2
+	lspSeverityInfo   = 3
+	lspInlayHintType  = 1
+)
+
+// lspSeverities map the severities of sites to those of diagnostics.
+var lspSeverities = map[Severity]int{
+	SeverityNote:    lspSeverityInfo,
+	SeverityWarning: lspSeverityWarn,
+	SeverityError:   lspSeverityError,
+}
+
+// handle handles msg, replying to it if it's a request. It returns the
+// directory of the package to analyze because of it, if any, and whether
+// that's because of an unsaved change, which waits for a pause.
+func (s *lspServer) handle(msg lspMessage) (string, bool) {
+	var doc struct {
+		TextDocument   lspTextDocument `json:"textDocument"`
+		ContentChanges []struct {
+			Text string `json:"text"`
+		} `json:"contentChanges"`
+	}
+	switch msg.Method {
+	case "initialize":
+		var params struct {
+			Capabilities struct {
+				TextDocument struct {
+					CodeAction struct {
+						ResolveSupport *struct {
+							Properties []string `json:"properties"`
+						} `json:"resolveSupport"`
+					} `json:"codeAction"`
+				} `json:"textDocument"`
+				Workspace struct {
+					InlayHint struct {
+						RefreshSupport bool `json:"refreshSupport"`
+					} `json:"inlayHint"`
+					CodeLens struct {
+						RefreshSupport bool `json:"refreshSupport"`
+					} `json:"codeLens"`
+				} `json:"workspace"`
+			} `json:"capabilities"`
+		}
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			s.replyError(msg.ID, lspInvalidParams, err.Error())
+			return "", false
+		}
+		if rs := params.Capabilities.TextDocument.CodeAction.ResolveSupport; rs != nil {
+			for _, p := range rs.Properties {
+				s.resolve = s.resolve || p == "edit"
+			}
+		}
+		w := params.Capabilities.Workspace
+		s.refresh = w.InlayHint.RefreshSupport && w.CodeLens.RefreshSupport
+		s.reply(msg.ID, map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync": map[string]any{
+					"openClose": true,
+					// Every change sends the whole file.
+					"change": 1,
+					"save":   true,
+				},
+				"codeActionProvider": map[string]any{
+					"codeActionKinds": []string{"quickfix"},
+					"resolveProvider": s.resolve,
+				},
+				"inlayHintProvider": true,
+				"codeLensProvider":  map[string]any{"resolveProvider": false},
+			},
+			"serverInfo": map[string]string{"name": "copyfighter"},
+		})
+	case "shutdown":
+		s.shutdown = true
+		s.reply(msg.ID, nil)
+	case "exit":
+		s.exited = true
+	case "textDocument/didOpen", "textDocument/didChange", "textDocument/didSave", "textDocument/didClose":
+		if err := json.Unmarshal(msg.Params, &doc); err != nil {
+			return "", false
+		}
+		p := uriPath(doc.TextDocument.URI)
+		if p == "" || !strings.HasSuffix(p, ".go") {
+			return "", false
+		}
+		switch msg.Method {
+		case "textDocument/didOpen":
+			lspOverlay[p] = []byte(doc.TextDocument.Text)
+		case "textDocument/didChange":
+			if len(doc.ContentChanges) == 0 {
+				return "", false
+			}
+			lspOverlay[p] = []byte(doc.ContentChanges[len(doc.ContentChanges)-1].Text)
+			return filepath.Dir(p), true
+		case "textDocument/didClose":
+			// The file on disk is what the package is made of again.
+			delete(lspOverlay, p)
+		}
+		return filepath.Dir(p), false
+	case "textDocument/codeAction":
+		var params struct {
+			TextDocument lspTextDocument `json:"textDocument"`
+			Range        lspRange        `json:"range"`
+		}
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			s.replyError(msg.ID, lspInvalidParams, err.Error())
+			return "", false
+		}
+		s.reply(msg.ID, s.codeActions(params.TextDocument.URI, params.Range))
+	case "codeAction/resolve":
+		var action lspCodeAction
+		if err := json.Unmarshal(msg.Params, &action); err != nil || action.Data == nil {
+			s.replyError(msg.ID, lspInvalidParams, "code action has no data to resolve it with")
+			return "", false
+		}
+		if f, ok := s.finding(action.Data.URI, action.Data.Func); ok {
+			action.Edit = s.fixEdit(f)
+		}
+		s.reply(msg.ID, action)
+	case "textDocument/inlayHint":
+		var params struct {
+			TextDocument lspTextDocument `json:"textDocument"`
+			Range        lspRange        `json:"range"`
+		}
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			s.replyError(msg.ID, lspInvalidParams, err.Error())
+			return "", false
+		}
+		s.reply(msg.ID, s.inlayHints(params.TextDocument.URI, params.Range))
+	case "textDocument/codeLens":
+		var params struct {
+			TextDocument lspTextDocument `json:"textDocument"`
+		}
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			s.replyError(msg.ID, lspInvalidParams, err.Error())
+			return "", false
+		}
+		s.reply(msg.ID, s.codeLenses(params.TextDocument.URI))
+	default:
+		// Responses to the requests sent to the client have no method,
+		// and aren't replied to.
+		if msg.ID != nil && msg.Method != "" {
+			s.replyError(msg.ID, lspMethodNotFound, fmt.Sprintf("method %#v isn't supported", msg.Method))
+		}
+	}
+	return "", false
+}
+
+// analyze analyzes the package in dir and publishes the diagnostics of its
+// files, clearing those of its files that no longer have any. If the package
+// can't be analyzed, as while a change doesn't type check, the diagnostics
+// it has are left alone and the error is logged to the client.
+func (s *lspServer) analyze(dir string) {
+	fset := token.NewFileSet()
+	skips := newSkipLog()
+	sites, err := check([]string{dir}, fset, s.lim, s.sizes, shard{}, nil, skips)
+	if err != nil {
+		s.notify("window/logMessage", map[string]any{"type": 1, "message": err.Error()})
+		return
+	}
+	sites = s.filter.apply(sites, fset, skips)
+	byFile := make(map[string][]lspFinding)
+	for name := range s.files {
+		if filepath.Dir(name) == dir {
+			byFile[name] = nil
+		}
+	}
+	for _, site := range sites {
+		name := fset.Position(site.pos).Filename
+		byFile[name] = append(byFile[name], lspFinding{site: site, fset: fset, diag: s.diagnostic(site, fset)})
+	}
+	names := make([]string, 0, len(byFile))
+	for name := range byFile {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		findings := byFile[name]
+		diags := []lspDiagnostic{}
+		for _, f := range findings {
+			diags = append(diags, f.diag)
+		}
+		if len(findings) == 0 {
+			delete(s.files, name)
+		} else {
+			s.files[name] = findings
+		}
+		s.notify("textDocument/publishDiagnostics", map[string]any{"uri": pathURI(name), "diagnostics": diags})
+	}
+
+	structs, err := s.declaredStructs(dir, byFile)
+	if err != nil {
+		s.notify("window/logMessage", map[string]any{"type": 1, "message": err.Error()})
+		return
+	}
+	for name := range s.structs {
+		if filepath.Dir(name) == dir {
+			delete(s.structs, name)
+		}
+	}
+	for name, ss := range structs {
+		s.structs[name] = ss
+	}
+	if s.refresh {
+		s.request("workspace/inlayHint/refresh")
+		s.request("workspace/codeLens/refresh")
+	}
+}
+
+// declaredStructs returns the struct types declared at package level in each
+// file of the package in dir, with the findings of byFile that copy them.
+// The package is loaded again for them, since check doesn't keep the types
+// that no finding is about.
+func (s *lspServer) declaredStructs(dir string, byFile map[string][]lspFinding) (map[string][]lspStruct, error) {
+	fset := token.NewFileSet()
+	pkgs, err := loadPackages([]string{dir}, fset, shard{}, false, newSkipLog(), nil, *excludePatterns)
+	if err != nil {
+		return nil, err
+	}
+	uses := make(map[string][]lspLocation)
+	for name, findings := range byFile {
+		for _, f := range findings {
+			seen := make(map[string]bool)
+			for _, v := range f.site.values {
+				named, ok := types.Unalias(v.typ).(*types.Named)
+				if !ok || named.Obj().Pkg() == nil {
+					continue
+				}
+				key := types.TypeString(named.Origin(), nil)
+				if !seen[key] {
+					seen[key] = true
+					uses[key] = append(uses[key], lspLocation{URI: pathURI(name), Range: f.diag.Range})
+				}
+			}
+		}
+	}
+	structs := make(map[string][]lspStruct)
+	for _, pkg := range pkgs {
+		if pkg.Types == nil {
+			continue
+		}
+		scope := pkg.Types.Scope()
+		for _, name := range scope.Names() {
+			tn, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok || tn.IsAlias() || isGeneric(tn.Type()) {
+				continue
+			}
+			if _, ok := tn.Type().Underlying().(*types.Struct); !ok {
+				continue
+			}
+			pos := fset.Position(tn.Pos())
+			src := s.source(pos.Filename)
+			structs[pos.Filename] = append(structs[pos.Filename], lspStruct{
+				name: lspRange{lspPositionAt(src, pos.Offset), lspPositionAt(src, pos.Offset+len(name))},
+				size: s.sizes.Sizeof(tn.Type()),
+				uses: uses[types.TypeString(tn.Type(), nil)],
+			})
+		}
+	}
+	return structs, nil
+}
+
+// inlayHints returns the sizes of the struct types declared in the file at
+// uri whose names end in r, shown after their names.
+func (s *lspServer) inlayHints(uri string, r lspRange) []lspInlayHint {
+	hints := []lspInlayHint{}
+	for _, st := range s.structs[uriPath(uri)] {
+		if before(st.name.End, r.Start) || before(r.End, st.name.End) {
+			continue
+		}
+		hints = append(hints, lspInlayHint{
+			Position:     st.name.End,
+			Label:        plural(int(st.size), "byte"),
+			Kind:         lspInlayHintType,
+			PaddingLeft:  true,
+			PaddingRight: true,
+		})
+	}
+	return hints
+}
+
+// codeLenses returns a lens on each struct type declared in the file at uri
+// that findings copy by value, which counts them and shows where they are.
+func (s *lspServer) codeLenses(uri string) []lspCodeLens {
+	lenses := []lspCodeLens{}
+	for _, st := range s.structs[uriPath(uri)] {
+		if len(st.uses) == 0 {
+			continue
+		}
+		lenses = append(lenses, lspCodeLens{
+			Range: st.name,
+			Command: lspCommand{
+				Title:     plural(len(st.uses), "by-value use"),
+				Command:   "editor.action.showReferences",
+				Arguments: []any{uri, st.name.Start, st.uses},
+			},
+		})
+	}
+	return lenses
+}
+
+// diagnostic returns the diagnostic of site. A by-value signature spans the
+// declaration of its first flagged value, like "p Config", with the others
+// as related information, and other sites span the word they're at.
+func (s *lspServer) diagnostic(site copySite, fset *token.FileSet) lspDiagnostic {
+	pos := fset.Position(site.pos)
+	src := s.source(pos.Filename)
+	d := lspDiagnostic{
+		Range:           lspRange{lspPositionAt(src, pos.Offset), lspPositionAt(src, wordEnd(src, pos.Offset))},
+		Severity:        lspSeverities[s.tiers.of(site)],
+		Code:            site.check,
+		CodeDescription: &lspHref{docsURL},
+		Source:          "copyfighter",
+		Message:         site.message(siteLabels{}),
+	}
+	for i, v := range site.values {
+		if v.role == "" || !v.pos.IsValid() {
+			continue
+		}
+		start := fset.Position(v.pos)
+		end := lspPositionAt(src, wordEnd(src, start.Offset))
+		if v.end.IsValid() {
+			end = lspPositionAt(src, fset.Position(v.end).Offset)
+		}
+		r := lspRange{lspPositionAt(src, start.Offset), end}
+		if i == 0 {
+			d.Range = r
+			continue
+		}
+		what := v.role
+		if v.role != "receiver" {
+			what = fmt.Sprintf("%s at index %d", v.role, v.index)
+		}
+		d.RelatedInformation = append(d.RelatedInformation, lspRelatedInfo{
+			Location: lspLocation{URI: pathURI(start.Filename), Range: r},
+			Message:  fmt.Sprintf("%s is '%s' (%d bytes)", what, typeString(v.typ, site.fun.Pkg()), v.size),
+		})
+	}
+	return d
+}
+
+// codeActions returns the quick fixes of the by-value signatures of the file
+// at uri whose diagnostics overlap r. Unless the client resolves actions
+// lazily, their edits are worked out right away.
+func (s *lspServer) codeActions(uri string, r lspRange) []lspCodeAction {
+	actions := []lspCodeAction{}
+	for _, f := range s.files[uriPath(uri)] {
+		if f.site.check != checkSignature || !canFix(f.site) || before(f.diag.Range.End, r.Start) || before(r.End, f.diag.Range.Start) {
+			continue
+		}
+		action := lspCodeAction{
+			Title:       fmt.Sprintf("Pass the wide values of %s by pointer", f.site.fun.Name()),
+			Kind:        "quickfix",
+			Diagnostics: []lspDiagnostic{f.diag},
+			Data:        &lspActionData{URI: uri, Func: f.site.fun.FullName()},
+		}
+		if !s.resolve {
+			action.Edit = s.fixEdit(f)
+			if action.Edit == nil {
+				continue
+			}
+		}
+		actions = append(actions, action)
+	}
+	return actions
+}
+
+// finding returns the published by-value signature of the func named fun in
+// the file at uri.
+func (s *lspServer) finding(uri, fun string) (lspFinding, bool) {
+	for _, f := range s.files[uriPath(uri)] {
+		if f.site.check == checkSignature && f.site.fun.FullName() == fun {
+			return f, true
+		}
+	}
+	return lspFinding{}, false
+}
+
+// fixEdit returns the edit that fixes the by-value signature of f along with
+// its calls, or nil if fixSignatures can't fix it. Its calls are looked for
+// in its package, since funcs called from other packages are exported and not
+// fixed.
+func (s *lspServer) fixEdit(f lspFinding) *lspWorkspaceEdit {
+	patterns := []string{filepath.Dir(f.fset.Position(f.site.pos).Filename)}
+	fx, err := planFixes(patterns, []copySite{f.site})
+	if err != nil {
+		s.notify("window/logMessage", map[string]any{"type": 1, "message": err.Error()})
+		return nil
+	}
+	if !fx.fixes(f.site.fun) {
+		return nil
+	}
+	edit := &lspWorkspaceEdit{Changes: make(map[string][]lspTextEdit)}
+	for name, insertions := range fx.edits {
+		src := s.source(name)
+		edits := []lspTextEdit{}
+		for _, e := range sortedInsertions(insertions) {
+			start, end := lspPositionAt(src, e.offset), lspPositionAt(src, e.offset+e.cut)
+			edits = append(edits, lspTextEdit{Range: lspRange{start, end}, NewText: e.text})
+		}
+		edit.Changes[pathURI(name)] = edits
+	}
+	return edit
+}
+
+// source returns the contents of the file at p as the editor has them.
+func (s *lspServer) source(p string) []byte {
+	if src, ok := lspOverlay[p]; ok {
+		return src
+	}
+	src, _ := os.ReadFile(p)
+	return src
+}
+
+func (s *lspServer) reply(id *json.RawMessage, result any) {
+	s.write(map[string]any{"jsonrpc": "2.0", "id": id, "result": result})
+}
+
+func (s *lspServer) replyError(id *json.RawMessage, code int, message string) {
+	if id == nil {
+		return
+	}
+	s.write(map[string]any{"jsonrpc": "2.0", "id": id, "error": lspError{code, message}})
+}
+
+// request sends the client a request without params, whose response is
+// ignored.
+func (s *lspServer) request(method string) {
+	s.requests++
+	s.write(map[string]any{"jsonrpc": "2.0", "id": s.requests, "method": method})
+}
+
+func (s *lspServer) notify(method string, params any) {
+	s.write(map[string]any{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+// write writes msg with the header LSP messages start with. A client that
+// can't be written to will close the connection, which ends serveLSP.
+func (s *lspServer) write(msg any) {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(b), b)
+}
+
+// lspPositionAt returns the LSP position of the byte at offset in src, whose
+// character is counted in UTF-16 code units as LSP counts them by default.
+func lspPositionAt(src []byte, offset int) lspPosition {
+	offset = min(offset, len(src))
+	line, start := 0, 0
+	for i := 0; i < offset; i++ {
+		if src[i] == '\n' {
+			line, start = line+1, i+1
+		}
+	}
+	character := 0
+	for _, r := range string(src[start:offset]) {
+		character += utf16.RuneLen(r)
+	}
+	return lspPosition{line, character}
+}
+
+// wordEnd returns the offset of the end of the identifier or keyword that
+// starts at offset in src, or offset itself if none does.
+func wordEnd(src []byte, offset int) int {
+	end := offset
+	for end < len(src) {
+		r, n := utf8.DecodeRune(src[end:])
+		if r != '_' && !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || r >= utf8.RuneSelf) {
+			break
+		}
+		end += n
+	}
+	return end
+}
+
+// before returns true if a is before b.
+func before(a, b lspPosition) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Character < b.Character
+}
+
+// uriPath returns the path of a file URI, or "" for other URIs.
+func uriPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+// pathURI returns the file URI of the absolute path p.
+func pathURI(p string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(p)}).String()
+}
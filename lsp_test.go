@@ -0,0 +1,175 @@
+package copyfighter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"go/types"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServeLSP(t *testing.T) {
+	dir := t.TempDir()
+	src := `package p
+
+type big struct{ a, b, c int64 }
+
+func use(b big) int64 { return b.a }
+
+func run(b *big) int64 { return use(*b) }
+`
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/p\n\ngo 1.22\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "p.go")
+	if err := os.WriteFile(file, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+	defer func(d time.Duration) { lspDelay = d }(lspDelay)
+	lspDelay = 0
+
+	clientIn, serverOut := io.Pipe()
+	serverIn, clientOut := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- serveLSP(serverIn, serverOut, limits{max: 16}, &types.StdSizes{WordSize: 8, MaxAlign: 8}, siteFilter{optIn: map[string]bool{checkCall: false}, minConf: likelyOptimized}, severityTiers{})
+	}()
+	r := bufio.NewReader(clientIn)
+	send := func(msg map[string]any) {
+		t.Helper()
+		msg["jsonrpc"] = "2.0"
+		b, err := json.Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(clientOut, "Content-Length: %d\r\n\r\n%s", len(b), b)
+	}
+	// receive returns the next message with the method, or the response
+	// if method is empty, skipping the others.
+	receive := func(method string, v any) {
+		t.Helper()
+		for {
+			b, err := readLSPMessage(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var msg struct {
+				Method string          `json:"method"`
+				Params json.RawMessage `json:"params"`
+				Result json.RawMessage `json:"result"`
+			}
+			if err := json.Unmarshal(b, &msg); err != nil {
+				t.Fatal(err)
+			}
+			if msg.Method != method {
+				continue
+			}
+			raw := msg.Params
+			if method == "" {
+				raw = msg.Result
+			}
+			if err := json.Unmarshal(raw, v); err != nil {
+				t.Fatal(err)
+			}
+			return
+		}
+	}
+	type published struct {
+		URI         string          `json:"uri"`
+		Diagnostics []lspDiagnostic `json:"diagnostics"`
+	}
+
+	send(map[string]any{"id": 1, "method": "initialize", "params": map[string]any{"rootUri": pathURI(dir), "capabilities": map[string]any{}}})
+	var init struct {
+		Capabilities map[string]any `json:"capabilities"`
+	}
+	receive("", &init)
+	for _, c := range []string{"codeActionProvider", "inlayHintProvider", "codeLensProvider"} {
+		if _, ok := init.Capabilities[c]; !ok {
+			t.Errorf("initialize didn't offer %s: %v", c, init.Capabilities)
+		}
+	}
+
+	uri := pathURI(file)
+	send(map[string]any{"method": "textDocument/didOpen", "params": map[string]any{"textDocument": map[string]any{"uri": uri, "languageId": "go", "version": 1, "text": src}}})
+	var diags published
+	receive("textDocument/publishDiagnostics", &diags)
+	if diags.URI != uri || len(diags.Diagnostics) != 1 {
+		t.Fatalf("published %v for %s, want one diagnostic for %s", diags.Diagnostics, diags.URI, uri)
+	}
+	d := diags.Diagnostics[0]
+	if want := (lspRange{lspPosition{4, 9}, lspPosition{4, 14}}); d.Code != checkSignature || d.Range != want {
+		t.Errorf("published %s diagnostic at %v, want signature at %v, the span of 'b big'", d.Code, d.Range, want)
+	}
+
+	send(map[string]any{"id": 2, "method": "textDocument/codeAction", "params": map[string]any{"textDocument": map[string]any{"uri": uri}, "range": d.Range, "context": map[string]any{"diagnostics": []any{d}}}})
+	var actions []lspCodeAction
+	receive("", &actions)
+	if len(actions) != 1 || actions[0].Edit == nil {
+		t.Fatalf("got code actions %+v, want one with an edit", actions)
+	}
+	got := []string{}
+	for _, e := range actions[0].Edit.Changes[uri] {
+		got = append(got, fmt.Sprintf("%d:%d-%d:%d %q", e.Range.Start.Line, e.Range.Start.Character, e.Range.End.Line, e.Range.End.Character, e.NewText))
+	}
+	// The call passes b itself rather than &*b, so its star is cut.
+	if want := []string{`4:11-4:11 "*"`, `6:36-6:37 ""`}; strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("got edits %v, want %v", got, want)
+	}
+
+	// big is 24 bytes, and the signature of use copies it.
+	name := lspRange{lspPosition{2, 5}, lspPosition{2, 8}}
+	send(map[string]any{"id": 3, "method": "textDocument/inlayHint", "params": map[string]any{"textDocument": map[string]any{"uri": uri}, "range": lspRange{lspPosition{0, 0}, lspPosition{7, 0}}}})
+	var hints []lspInlayHint
+	receive("", &hints)
+	if len(hints) != 1 || hints[0].Position != name.End || hints[0].Label != "24 bytes" {
+		t.Errorf("got inlay hints %+v, want \"24 bytes\" at %v", hints, name.End)
+	}
+	send(map[string]any{"id": 4, "method": "textDocument/codeLens", "params": map[string]any{"textDocument": map[string]any{"uri": uri}}})
+	var lenses []struct {
+		Range   lspRange `json:"range"`
+		Command struct {
+			Title     string            `json:"title"`
+			Arguments []json.RawMessage `json:"arguments"`
+		} `json:"command"`
+	}
+	receive("", &lenses)
+	if len(lenses) != 1 || lenses[0].Range != name || lenses[0].Command.Title != "1 by-value use" || len(lenses[0].Command.Arguments) != 3 {
+		t.Fatalf("got code lenses %+v, want one on big with a by-value use", lenses)
+	}
+	var uses []lspLocation
+	if err := json.Unmarshal(lenses[0].Command.Arguments[2], &uses); err != nil {
+		t.Fatal(err)
+	}
+	if len(uses) != 1 || uses[0].URI != uri || uses[0].Range != d.Range {
+		t.Errorf("code lens lists %v, want the signature of use", uses)
+	}
+
+	// An unsaved change that fixes the signature clears the diagnostic.
+	fixed := strings.Replace(src, "use(b big)", "use(b *big)", 1)
+	fixed = strings.Replace(fixed, "use(*b)", "use(b)", 1)
+	send(map[string]any{"method": "textDocument/didChange", "params": map[string]any{"textDocument": map[string]any{"uri": uri, "version": 2}, "contentChanges": []any{map[string]any{"text": fixed}}}})
+	receive("textDocument/publishDiagnostics", &diags)
+	if len(diags.Diagnostics) != 0 {
+		t.Errorf("published %v after the fix, want none", diags.Diagnostics)
+	}
+	send(map[string]any{"id": 5, "method": "textDocument/codeLens", "params": map[string]any{"textDocument": map[string]any{"uri": uri}}})
+	receive("", &lenses)
+	if len(lenses) != 0 {
+		t.Errorf("got code lenses %+v after the fix, want none", lenses)
+	}
+
+	send(map[string]any{"id": 6, "method": "shutdown"})
+	var null any
+	receive("", &null)
+	send(map[string]any{"method": "exit"})
+	if err := <-done; err != nil {
+		t.Errorf("serveLSP: %s", err)
+	}
+}
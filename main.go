@@ -1,232 +1,1237 @@
-package main
+package copyfighter
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"go/ast"
 	"go/build"
-	"go/importer"
-	"go/parser"
 	"go/token"
 	"go/types"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
-	"regexp"
+	"runtime"
 	"sort"
 	"strings"
+	"time"
+
+	"golang.org/x/tools/go/packages"
 )
 
+// commandLine holds the flags of Main, apart from the flag package's own
+// CommandLine so that importers don't inherit them.
+var commandLine = flag.NewFlagSet("copyfighter", flag.ContinueOnError)
+
 var (
-	maxStructWidth = flag.Int64("max", 16, "maximum size in bytes a struct can be before by-value uses are flagged")
-	wordSize       = flag.Int64("wordSize", 8, "word size to assume when calculation struct size")
-	maxAlign       = flag.Int64("maxAlign", 8, "maximum word alignment to assume when calculating struct size")
+	maxStructWidth    = commandLine.Int64("max", 16, "maximum size in bytes a struct can be before by-value uses are flagged")
+	escape            = commandLine.Bool("escape", false, "build the packages with the compiler's escape analysis and leave out the results of funcs it can't inline, which would move to the heap if returned by pointer")
+	checkRoles        = commandLine.String("check", "receiver,param,result", "comma-separated parts of signatures whose wide values are reported: receiver, param, and result; named results and generic instantiations follow result. A check ID with a \"-\" prefix, like -chan, turns that check off")
+	checkMax          = commandLine.String("check-max", "", "maximum sizes in bytes for single checks, given as ID=N,...; the other checks use -max")
+	wordSize          = commandLine.Int64("wordSize", 8, "word size to assume when calculation struct size (default: GOARCH's)")
+	maxAlign          = commandLine.Int64("maxAlign", 8, "maximum word alignment to assume when calculating struct size (default: GOARCH's)")
+	goarch            = commandLine.String("goarch", "", "architecture to size values and select files for (default: the go command's GOARCH)")
+	archFlag          = commandLine.String("arch", "", "comma-separated GOARCH values whose sizes are all computed, so that values too wide on any of them are reported with their size on each")
+	goos              = commandLine.String("goos", "", "operating system to select files for (default: the go command's GOOS)")
+	buildTags         = commandLine.String("tags", "", "comma-separated build tags to select files with, in place of any -tags in GOFLAGS")
+	breaking          = commandLine.Bool("breaking", false, "label each finding with whether fixing it is a breaking change for importers")
+	concurrency       = commandLine.Int("concurrency", 0, "number of packages to analyze at once (default: GOMAXPROCS)")
+	noCache           = commandLine.Bool("no-cache", false, "analyze every matched package, rather than skipping those that found nothing in an earlier run with the same sources and flags")
+	cacheDir          = commandLine.String("cache-dir", "", "directory of the cache of packages without findings (default: copyfighter in the user cache directory)")
+	shardFlag         = commandLine.String("shard", "", "only analyze the K-th of N disjoint subsets of the matched packages, given as K/N")
+	warnAt            = commandLine.Int64("warn-at", 0, "size in bytes the largest value a finding flags must exceed for the finding to be a warning rather than a note (default: every finding is at least a warning)")
+	errorAt           = commandLine.Int64("error-at", 0, "size in bytes the largest value a finding flags must exceed for the finding to be an error; with it, only errors make the run exit with status 2 (default: no finding is an error)")
+	exitZero          = commandLine.Bool("exit-zero", false, "exit with status 0 whatever the findings, so that only a failed analysis, with status 1, fails the run")
+	maxFindings       = commandLine.Int("max-findings", 0, "number of findings a run can have and still exit with status 0; with -error-at, only errors count")
+	format            = commandLine.String("format", "text", "output format: "+strings.Join(formatNames(), ", "))
+	changedFiles      = commandLine.String("changed-files", "", "path to a file listing one changed source file per line; findings in other files are dropped")
+	runID             = commandLine.String("run-id", "", "identifier for this run in formats that need one (default: the current time)")
+	regABI            = commandLine.Bool("regabi", false, "label findings whose values the register-based calling convention of GOARCH likely passes in registers")
+	pprofPath         = commandLine.String("pprof", "", "path to a CPU profile, like go test -cpuprofile writes, whose share of samples in each finding's func is appended to the finding")
+	hotMin            = commandLine.Float64("hot-min", 0, "with -pprof, report only the findings in funcs on the stacks of at least this percentage of the profile's samples")
+	sortBy            = commandLine.String("sort", "position", "order of the findings: position, impact to list the by-value signatures with the most call sites in the analyzed packages first, or cost to list the findings that copy the most bytes per run of a -whole-program program first")
+	cacheLines        = commandLine.Bool("cachelines", false, "label findings with the number of cache lines the largest flagged value spans, and list those spanning the most first")
+	cacheLineSize     = commandLine.Int64("cacheline-size", 64, "cache line size in bytes used by -cachelines")
+	hideSingleCaller  = commandLine.Bool("hide-single-caller", false, "hide findings for unexported funcs that are called from exactly one place")
+	includeGenerated  = commandLine.Bool("include-generated", false, "report findings in generated files, which start with a // Code generated ... DO NOT EDIT. comment")
+	tests             = commandLine.Bool("tests", false, "also analyze the _test.go files of the matched packages and their external test packages")
+	fields            = commandLine.Bool("fields", false, "report struct fields that hold a wide struct by value")
+	containers        = commandLine.Bool("containers", false, "report slice and map types of wide elements in type and variable declarations and composite literals")
+	dynamicTypes      = commandLine.Bool("dynamic-types", false, "report interface variables that may hold a boxed wide value where they are stored in containers or handed to goroutines")
+	callSites         = commandLine.Bool("calls", false, "report every call that copies a wide receiver or argument because its callee takes it by value, dependencies and the standard library included")
+	depCalls          = commandLine.Bool("run-checks-on-deps", false, "report calls that copy wide values because a dependency's signature takes them by value, and log what each dependency's calls copy")
+	assignments       = commandLine.Bool("assignments", false, "report assignments and variable declarations in func bodies that copy an existing wide value")
+	duplicates        = commandLine.Bool("duplicates", false, "report wide struct types that are structurally identical to one in another package")
+	exportData        = commandLine.Bool("export-data", false, "analyze the exported signatures of the package with the given import path from its compiled export data, without source")
+	archive           = commandLine.String("archive", "", "analyze the source in this .zip, .tar, .tar.gz, or .tgz file; the package argument is relative to the archive's root")
+	excludePatterns   = stringsVar("exclude", "package pattern, in which ... matches any string as in the go command's patterns, whose packages aren't loaded or reported; can be given several times")
+	noAllowlist       = commandLine.Bool("no-default-allowlist", false, "report findings about the standard library types that are passed by value by convention, like time.Time and reflect.Value")
+	excludeTypeRes    = regexpsVar("exclude-types", "regular expression matching the types, named by import path like example.com/m.Config, whose findings aren't reported; can be given several times")
+	lenient           = commandLine.Bool("lenient", false, "analyze packages with type errors instead of stopping, reporting the findings in the parts that type check, and mark the results as partial")
+	failFast          = commandLine.Bool("fail-fast", false, "stop at the first package with a finding and report only that finding")
+	goroot            = commandLine.String("goroot", "", "Go root whose standard library and packages are analyzed (default: the installed toolchain's)")
+	impact            = commandLine.Bool("impact", false, "label by-value signatures with how many call sites, other references, and interface satisfactions fixing them changes")
+	wholeProgram      = commandLine.Bool("whole-program", false, "analyze the main package in the given directory along with every package it imports from outside the standard library, and report the sites in its module")
+	skipped           = commandLine.Bool("skipped", false, "write to stderr how many files, types, packages, and findings were skipped, and why")
+	printConfig       = commandLine.Bool("print-config", false, "print the GOOS, GOARCH, GOPATH, GOROOT, GOFLAGS, build tags, and sizes an analysis would use, and exit")
+	fix               = commandLine.Bool("fix", false, "rewrite the by-value signatures that can be safely changed to use pointers, along with their funcs' bodies and calls, and report the rest")
+	diffFlag          = commandLine.Bool("d", false, "print the rewrites -fix or annotate would make as unified diffs instead of making them")
+	confidenceLabel   = commandLine.Bool("confidence", false, "label findings with whether the compiler likely optimizes the copy away, definitely makes it, or it's unknown")
+	minConfidence     = commandLine.String("min-confidence", "likely-optimized", "only report findings whose copy is at least this sure to be made: likely-optimized, unknown, or definitely-copied")
+	implementations   = commandLine.Bool("implementations", false, "report by-value signatures of methods that implement an interface, which can't change without breaking the implementation")
+	moduleReports     = commandLine.String("module-reports", "", "with the modules command, also write the report of each module to a file named after its path in this directory")
+	listSkipped       = commandLine.Bool("list-skipped", false, "like -skipped, but also list what was skipped")
+	baselinePath      = commandLine.String("baseline", "", "path to a baseline file written by -write-baseline; the findings it records aren't reported")
+	writeBaselinePath = commandLine.String("write-baseline", "", "record the findings in a baseline file at this path instead of reporting them")
+	baselineUntil     = commandLine.String("baseline-until", "", "with -write-baseline, the day, like 2025-09-01, after which the recorded findings are reported again")
 )
 
-func main() {
+// Main runs the copyfighter command with the arguments in os.Args and exits.
+func Main() {
 	log.SetPrefix("")
 	log.SetFlags(0)
-	flag.Parse()
+	defer exitOnPanic()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "upload-sarif":
+			err := uploadSARIF(os.Args[2:])
+			if err != nil && !errors.Is(err, flag.ErrHelp) {
+				log.Fatal(err)
+			}
+			return
+		case "merge":
+			err := mergeReports(os.Args[2:])
+			if err != nil && !errors.Is(err, flag.ErrHelp) {
+				log.Fatal(err)
+			}
+			return
+		case "org-report":
+			err := orgReport(os.Args[2:])
+			if err != nil && !errors.Is(err, flag.ErrHelp) {
+				log.Fatal(err)
+			}
+			return
+		case "explain":
+			if len(os.Args) > 3 {
+				log.Fatalf("usage: %s explain [CHECK_ID]", os.Args[0])
+			}
+			var id string
+			if len(os.Args) == 3 {
+				id = os.Args[2]
+			}
+			if err := explain(os.Stdout, id); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "savings":
+			cfg := parseFlags(os.Args[2:])
+			sites, fset, skips := analyze(cfg)
+			writeSkipped(skips)
+			_, sizes := mustTarget()
+			if err := writeSavings(os.Stdout, sites, fset, sizes.Sizeof(types.Typ[types.UnsafePointer])); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "export-types":
+			parseFlags(os.Args[2:])
+			if commandLine.NArg() == 0 {
+				log.Fatalf("usage: %s export-types [flags] GO_PKG_DIR...", os.Args[0])
+			}
+			_, sizes := mustTarget()
+			sh, err := parseShard(*shardFlag)
+			if err != nil {
+				log.Fatal(err)
+			}
+			skips := newSkipLog()
+			layouts, err := exportTypes(packagePatterns(commandLine.Args()), sizes, sh, skips)
+			if err != nil {
+				log.Fatal(err)
+			}
+			writeSkipped(skips)
+			if err := writeExportedTypes(os.Stdout, layouts, *format); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "modules":
+			parseCommandLine(os.Args[2:])
+			runModules()
+			return
+		case "lsp":
+			parseCommandLine(os.Args[2:])
+			cfg, err := readConfig(configDir("."))
+			if err != nil {
+				log.Fatal(err)
+			}
+			if err := cfg.apply(); err != nil {
+				log.Fatal(err)
+			}
+			_, sizes := mustTarget()
+			lim, err := cfg.limits()
+			if err != nil {
+				log.Fatal(err)
+			}
+			filter := mustFilter(cfg)
+			filter.ignored, err = readIgnoreFile(ignoreFileName)
+			if err != nil {
+				log.Fatal(err)
+			}
+			tiers, err := flagTiers()
+			if err != nil {
+				log.Fatal(err)
+			}
+			if err := serveLSP(os.Stdin, os.Stdout, lim, sizes, filter, tiers); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "annotate":
+			cfg := parseFlags(os.Args[2:])
+			if *archive != "" || *exportData {
+				log.Fatalf("annotate can't be used with -archive or -export-data")
+			}
+			sites, fset, skips := analyze(cfg)
+			writeSkipped(skips)
+			var diff io.Writer
+			if *diffFlag {
+				diff = os.Stdout
+			}
+			annotated, left, err := annotateSites(sites, fset, diff)
+			if err != nil {
+				log.Fatal(err)
+			}
+			log.Printf("annotated %s and left %s", plural(len(annotated), "finding"), plural(len(left), "finding"))
+			return
+		case "api-audit":
+			cfg := parseFlags(os.Args[2:])
+			sites, fset, skips := analyze(cfg)
+			sites = apiSites(sites, fset, skips)
+			writeSkipped(skips)
+			if err := writeAPIAudit(os.Stdout, sites, fset); err != nil {
+				log.Fatal(err)
+			}
+			exitIfFailing(len(sites))
+			return
+		}
+	}
+	cfg := parseFlags(os.Args[1:])
+	if *printConfig {
+		env, sizes := mustTarget()
+		if err := writeConfig(os.Stdout, env, sizes); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	if flag.NArg() != 1 {
-		log.Fatalf("usage: %s GO_PKG_DIR", os.Args[0])
+	if *cacheLineSize < 1 {
+		log.Fatalf("-cacheline-size must be positive")
 	}
-	p := flag.Arg(0)
-	sites, fset, err := check(p, *maxStructWidth, *wordSize, *maxAlign)
-	if err != nil {
+	write, ok := formats[*format]
+	if !ok {
+		log.Fatalf("unknown format %#v, must be one of: %s", *format, strings.Join(formatNames(), ", "))
+	}
+	if _, err := flagTiers(); err != nil {
 		log.Fatal(err)
 	}
-	printSites(sites, fset, os.Stdout)
-	if len(sites) > 0 {
-		os.Exit(2)
+	if (*fix || *diffFlag) && (*exportData || *wholeProgram || *archive != "") {
+		log.Fatalf("-fix and -d can't be used with -export-data, -whole-program, or -archive")
+	}
+	if *baselineUntil != "" {
+		if _, err := time.Parse(dateLayout, *baselineUntil); err != nil {
+			log.Fatalf("-baseline-until %#v isn't a day like 2025-09-01", *baselineUntil)
+		}
+	}
+	sites, fset, skips := analyze(cfg)
+	writeSkipped(skips)
+	if *writeBaselinePath != "" {
+		if err := writeBaselineFile(*writeBaselinePath, sites, fset, *baselineUntil); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("recorded %s in %s", plural(len(sites), "finding"), *writeBaselinePath)
+		return
+	}
+	if *depCalls {
+		logDependencyCalls(sites)
+	}
+	if *diffFlag {
+		// Like gofmt -d, print only the diffs, so they can be applied
+		// or pasted as they are.
+		unfixed, fixed, err := fixSignatures(packagePatterns(commandLine.Args()), sites, os.Stdout)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("-fix would fix %s and leave %s", plural(len(fixed), "signature"), plural(len(unfixed), "finding"))
+		return
 	}
+	if *fix {
+		var (
+			fixed []copySite
+			err   error
+		)
+		sites, fixed, err = fixSignatures(packagePatterns(commandLine.Args()), sites, nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("fixed %s", plural(len(fixed), "signature"))
+	}
+	rep := newReport(sites, fset)
+	rep.partial = skips.entities[skipPartialPkg]
+	if !*exportData && !*wholeProgram && *archive == "" {
+		rep.patterns = packagePatterns(commandLine.Args())
+	}
+	if err := write(os.Stdout, rep); err != nil {
+		log.Fatal(err)
+	}
+	exitIfFailing(rep.tiers.failing(sites))
 
 }
 
-func check(p string, maxStructWidth, wordSize, maxAlign int64) ([]copySite, *token.FileSet, error) {
-	fset := token.NewFileSet()
+// parseFlags parses the flags in args, then takes the settings they don't
+// give from the config file of the first package pattern they name, and
+// returns it. -archive runs don't read one, since the pattern is in the
+// archive. It exits on any error.
+func parseFlags(args []string) config {
+	parseCommandLine(args)
+	if *archive != "" || commandLine.NArg() == 0 {
+		return config{}
+	}
+	cfg, err := readConfig(configDir(commandLine.Arg(0)))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.apply(); err != nil {
+		log.Fatal(err)
+	}
+	return cfg
+}
 
-	_, err := os.Stat(p)
-	switch {
-	case os.IsNotExist(err):
-		// File doesn't exist, probably a Go import path
-		pkgs, err := parseGoPkg(p, fset)
+// newReport returns the report of sites with the labels the flags ask for.
+// With -cachelines, the sites spanning the most cache lines are listed first,
+// and with -sort impact, the signatures with the most call sites are, labeled
+// as -impact labels them. -sort cost lists the sites that copy the most bytes
+// per run first, labeled with those bytes. Calls and bytes count for as many
+// times as the weights of the sites' packages, and otherwise the sites in the
+// heaviest packages come first.
+func newReport(sites []copySite, fset *token.FileSet) *report {
+	if *cacheLines {
+		sort.SliceStable(sites, func(i, j int) bool {
+			return sites[i].cacheLines(*cacheLineSize) > sites[j].cacheLines(*cacheLineSize)
+		})
+	}
+	switch *sortBy {
+	case "impact":
+		sort.SliceStable(sites, func(i, j int) bool {
+			return sites[i].weighted(float64(sites[i].calls)) > sites[j].weighted(float64(sites[j].calls))
+		})
+	case "cost":
+		sort.SliceStable(sites, func(i, j int) bool {
+			return sites[i].weighted(float64(sites[i].cost)) > sites[j].weighted(float64(sites[j].cost))
+		})
+	default:
+		sort.SliceStable(sites, func(i, j int) bool {
+			return sites[i].weighted(1) > sites[j].weighted(1)
+		})
+	}
+	cacheLineLabel := int64(0)
+	if *cacheLines {
+		cacheLineLabel = *cacheLineSize
+	}
+	labels := siteLabels{breaking: *breaking, registers: *regABI, cacheLineSize: cacheLineLabel, impact: *impact || *sortBy == "impact", cost: *sortBy == "cost", hot: *pprofPath != "", confidence: *confidenceLabel}
+	if *archFlag != "" {
+		// mustTarget has already rejected bad -arch values.
+		labels.arches, _ = parseArches(*archFlag)
+	}
+	// main and runModules have already rejected bad tiers.
+	tiers, _ := flagTiers()
+	rep := &report{sites: sites, fset: fset, labels: labels, runID: *runID, tiers: tiers}
+	if rep.runID == "" {
+		rep.runID = time.Now().UTC().Format(time.RFC3339)
+	}
+	return rep
+}
+
+// analyze checks the packages matched by the patterns on the command line as
+// configured by the flags and cfg and returns the sites that pass its filters
+// and aren't in the -baseline, along with what it skipped. Runs that write a
+// baseline return the sites the current one records too. -export-data and
+// -whole-program take exactly one package. It exits on any error.
+func analyze(cfg config) ([]copySite, *token.FileSet, *skipLog) {
+	if *archive != "" {
+		dir, err := extractArchive(*archive)
 		if err != nil {
-			return nil, nil, err
+			log.Fatal(err)
 		}
-		sites := []copySite{}
-		for _, pkg := range pkgs {
-			s, err := checkPkg(pkg, fset, maxStructWidth, wordSize, maxAlign)
+		defer os.RemoveAll(dir)
+		if *changedFiles != "" {
+			*changedFiles, err = filepath.Abs(*changedFiles)
 			if err != nil {
-				return nil, nil, err
+				log.Fatal(err)
 			}
-			sites = append(sites, s...)
 		}
-		return sites, fset, nil
-	case err == nil:
-		// File exists, parses as such
-		pkg, err := parsePkgDir(p, fset)
+		// Analyze from the root of the archive so patterns and reported
+		// file names are relative to it.
+		if err := os.Chdir(dir); err != nil {
+			log.Fatal(err)
+		}
+		// The directory is gone by the time the sites are written.
+		reportDir = dir
+	}
+	_, sizes := mustTarget()
+	if commandLine.NArg() == 0 {
+		log.Fatalf("usage: %s GO_PKG_DIR...", os.Args[0])
+	}
+	if (*exportData || *wholeProgram) && commandLine.NArg() != 1 {
+		log.Fatalf("-export-data and -whole-program take exactly one package")
+	}
+	patterns := packagePatterns(commandLine.Args())
+	switch *sortBy {
+	case "position", "impact":
+	case "cost":
+		if !*wholeProgram {
+			log.Fatalf("-sort cost needs -whole-program, whose main package is where a run starts")
+		}
+	default:
+		log.Fatalf("unknown -sort %#v, must be position, impact, or cost", *sortBy)
+	}
+	sh, err := parseShard(*shardFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	lim, err := parseLimits(*checkMax, *maxStructWidth)
+	if err != nil {
+		log.Fatal(err)
+	}
+	lim.roles, lim.off, err = parseChecks(*checkRoles)
+	if err != nil {
+		log.Fatal(err)
+	}
+	filter := mustFilter(cfg)
+	filter.ignored, err = readIgnoreFile(ignoreFileName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	skips := newSkipLog()
+	var stop func(copySite, *token.FileSet) bool
+	if *failFast {
+		stop = filter.reports
+	}
+
+	var (
+		sites []copySite
+		fset  *token.FileSet
+	)
+	switch {
+	case *exportData:
+		sites, fset, err = checkExportData(patterns[0], lim, sizes, skips)
+	case *wholeProgram:
+		sites, fset, err = checkProgram(patterns[0], lim, sizes, skips)
+	default:
+		// The duplicates check compares the structs of every package, and
+		// test files import packages the cache doesn't key their package by.
+		if !*noCache && !*duplicates && !*tests {
+			if pkgCache, err = openCache(*cacheDir); err != nil {
+				log.Printf("warning: %s", err)
+			}
+		}
+		fset = token.NewFileSet()
+		sites, err = check(patterns, fset, lim, sizes, sh, stop, skips)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	sites = filter.apply(sites, fset, skips)
+	if *pprofPath != "" {
+		hot, err := readProfile(*pprofPath)
 		if err != nil {
-			return nil, nil, err
+			log.Fatal(err)
 		}
-		sites, err := checkPkg(pkg, fset, maxStructWidth, wordSize, maxAlign)
+		sites = hot.apply(sites, fset, *hotMin, skips)
+	} else if *hotMin > 0 {
+		log.Fatal("-hot-min needs a -pprof profile")
+	}
+	if *escape && lim.roles.has("result") {
+		in, err := readInlining(patterns)
 		if err != nil {
-			return nil, nil, err
+			log.Fatal(err)
 		}
-		return sites, fset, nil
-	default:
-		return nil, nil, err
+		sites = in.apply(sites, fset, skips)
 	}
+	if *baselinePath != "" && *writeBaselinePath == "" {
+		b, err := readBaselineFile(*baselinePath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sites = b.apply(sites, fset, skips)
+	}
+	if *failFast && len(sites) > 1 {
+		sites = sites[:1]
+	}
+	return sites, fset, skips
 }
 
-func parsePkgDir(p string, fset *token.FileSet) (*ast.Package, error) {
-	fi, err := os.Stat(p)
+// siteFilter decides which of the sites a run finds it reports.
+type siteFilter struct {
+	// optIn has the opt-in checks, and whether their flags enable them.
+	optIn   map[string]bool
+	minConf confidence
+	// changed has the absolute paths of the files -changed-files lists, or
+	// is nil without it.
+	changed map[string]bool
+	// ignored are the rules of the ignore file, whose paths are relative to
+	// ignoreRoot, or to the working directory if it's empty.
+	ignored    ignoreRules
+	ignoreRoot string
+	// excludePackages and excludeTypes are the patterns of the config
+	// file's exclusions.
+	excludePackages []string
+	excludeTypes    []string
+	// excludeTypeRes are the regular expressions of -exclude-types.
+	excludeTypeRes regexpsFlag
+	// weights are the config file's package weights.
+	weights map[string]float64
+	// allowlist are the patterns of the types on the default allowlist,
+	// unless -no-default-allowlist empties it.
+	allowlist []string
+	// generated caches whether each file is generated, unless nil.
+	generated map[string]bool
+}
+
+// mustFilter returns the filter the flags and cfg configure, without ignore
+// rules. It exits on any error.
+func mustFilter(cfg config) siteFilter {
+	f, err := newFilter(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("unable to stat file %#v: %s", p, err)
-	}
-	if !fi.IsDir() {
-		return nil, fmt.Errorf("%#v is not a directory", p)
+		log.Fatal(err)
 	}
+	return f
+}
 
-	mp, err := parser.ParseDir(fset, p, nil, 0)
+// newFilter returns the filter the flags and cfg configure, without ignore
+// rules, or an error if -min-confidence or -changed-files is bad.
+func newFilter(cfg config) (siteFilter, error) {
+	minConf, err := parseConfidence(*minConfidence)
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse package at %#v: %s", p, err)
+		return siteFilter{}, err
+	}
+	f := siteFilter{
+		optIn:           map[string]bool{checkDuplicate: *duplicates, checkField: *fields, checkContainer: *containers, checkAssign: *assignments, checkDynamicType: *dynamicTypes, checkDependencyCall: *depCalls, checkCall: *callSites},
+		minConf:         minConf,
+		excludePackages: append(append([]string{}, cfg.excludePackages...), *excludePatterns...),
+		excludeTypes:    cfg.excludeTypes,
+		excludeTypeRes:  *excludeTypeRes,
+		weights:         cfg.packageWeights,
+		generated:       make(map[string]bool),
+	}
+	if !*noAllowlist {
+		f.allowlist = defaultAllowlist
+	}
+	if *changedFiles != "" {
+		f.changed, err = readChangedFiles(*changedFiles)
+		if err != nil {
+			return siteFilter{}, err
+		}
+	}
+	return f, nil
+}
+
+// keep returns whether to report site, and if not, the reason it is skipped.
+// Sites of disabled opt-in checks aren't reported as skipped.
+func (f siteFilter) keep(site copySite, fset *token.FileSet) (bool, string) {
+	if enabled, ok := f.optIn[site.check]; ok && !enabled {
+		return false, ""
+	}
+	if site.check == checkCall && site.dependency != "" && f.optIn[checkDependencyCall] {
+		// The dependency-call check reports the call.
+		return false, ""
+	}
+	if site.ignored {
+		return false, skipDirective
+	}
+	if *hideSingleCaller && site.singleCaller {
+		return false, skipSingleCaller
+	}
+	filename := fset.Position(site.pos).Filename
+	if !*includeGenerated && f.isGenerated(filename) {
+		return false, skipGenerated
+	}
+	if len(site.implements) > 0 && !*implementations {
+		return false, skipImplements
+	}
+	if !site.confidence.atLeast(f.minConf) {
+		return false, skipLowConfidence
+	}
+	if inExcludedPackage(site, f.excludePackages) {
+		return false, skipExcludedPkg
+	}
+	if aboutExcludedTypes(site, f.excludesType) {
+		return false, skipExcludedType
+	}
+	if aboutExcludedTypes(site, f.allows) {
+		return false, skipAllowlisted
+	}
+	path := relPath(filename)
+	if f.ignoreRoot != "" {
+		path = relPathTo(f.ignoreRoot, filename)
+	}
+	if f.ignored.ignores(path) {
+		return false, skipIgnoredPath
 	}
-	if len(mp) != 1 {
-		var ps []string
-		for _, pkg := range mp {
-			ps = append(ps, pkg.Name)
+	if f.changed != nil && !f.changed[absPath(filename)] {
+		return false, skipUnchanged
+	}
+	return true, ""
+}
+
+// excludesType returns true if the type tn matches one of the patterns of
+// the config file or of -exclude-types.
+func (f siteFilter) excludesType(tn *types.TypeName) bool {
+	for _, pattern := range f.excludeTypes {
+		if matchTypePattern(pattern, tn) {
+			return true
 		}
-		return nil, fmt.Errorf("more than one package found in %#v: %s", p, strings.Join(ps, ","))
 	}
-	var pkg *ast.Package
-	for _, v := range mp {
-		pkg = v
+	return f.excludeTypeRes.matchTypeName(tn)
+}
+
+// allows returns true if the type tn is on the default allowlist.
+func (f siteFilter) allows(tn *types.TypeName) bool {
+	for _, pattern := range f.allowlist {
+		if matchTypePattern(pattern, tn) {
+			return true
+		}
 	}
-	return pkg, nil
+	return false
 }
 
-func pathToRegexp(p string) *regexp.Regexp {
-	re := regexp.QuoteMeta(p)
-	re = strings.Replace(re, `\.\.\.`, `.*`, -1)
-	// Special case: foo/... matches foo too.
-	if strings.HasSuffix(re, `/.*`) {
-		re = re[:len(re)-len(`/.*`)] + `(/.*)?`
+// isGenerated returns true if the Go file at path is generated.
+func (f siteFilter) isGenerated(path string) bool {
+	if f.generated == nil {
+		return isGeneratedFile(path)
+	}
+	generated, ok := f.generated[path]
+	if !ok {
+		generated = isGeneratedFile(path)
+		f.generated[path] = generated
 	}
-	return regexp.MustCompile(`^` + re + `$`)
+	return generated
 }
 
-func parseGoPkg(p string, fset *token.FileSet) ([]*ast.Package, error) {
-	p = filepath.Clean(p)
-	dirs := []string{}
-	re := pathToRegexp(p)
-	buildContext := build.Default
-	for _, src := range buildContext.SrcDirs() {
-		src = filepath.Clean(src) + string(filepath.Separator)
-		root := src
-		filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
-			if err != nil || !fi.IsDir() || path == src {
-				return nil
+// reports returns true if f keeps site.
+func (f siteFilter) reports(site copySite, fset *token.FileSet) bool {
+	ok, _ := f.keep(site, fset)
+	return ok
+}
+
+// apply returns the sites f keeps, and records why the others are skipped in
+// skips.
+func (f siteFilter) apply(sites []copySite, fset *token.FileSet, skips *skipLog) []copySite {
+	kept := []copySite{}
+	for _, site := range sites {
+		ok, reason := f.keep(site, fset)
+		if ok {
+			if pkg := sitePkg(site); pkg != nil && f.weights != nil {
+				site.weight = packageWeight(f.weights, pkg.Path())
 			}
+			kept = append(kept, site)
+		} else if reason != "" {
+			skips.add(reason, siteEntity(site, fset))
+		}
+	}
+	return kept
+}
 
-			// Avoid .foo, _foo, and testdata directory trees.
-			_, elem := filepath.Split(path)
-			if strings.HasPrefix(elem, ".") || strings.HasPrefix(elem, "_") || elem == "testdata" {
-				return filepath.SkipDir
+// writeSkipped writes what the run skipped to stderr if -skipped or
+// -list-skipped asks for it. Unreadable files and packages -lenient analyzes
+// in part are warned about either way, since the findings in them are missing
+// from a run that otherwise succeeds.
+func writeSkipped(skips *skipLog) {
+	for _, entity := range skips.entities[skipPartialPkg] {
+		log.Printf("warning: results are partial, type errors in %s", entity)
+	}
+	if !*skipped && !*listSkipped {
+		for _, entity := range skips.entities[skipUnreadable] {
+			log.Printf("warning: skipped unreadable %s", entity)
+		}
+		return
+	}
+	if err := skips.write(os.Stderr, *listSkipped); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// check analyzes the packages matched by any of patterns, adding their files
+// to fset, and returns their sites sorted by position. If stop is non-nil,
+// packages are analyzed until one has a site for which stop returns true, and
+// the sites found so far are returned. What isn't analyzed is recorded in
+// skips. With -tests, the packages' test files and external test packages
+// are analyzed too.
+func check(patterns []string, fset *token.FileSet, lim limits, sizes types.Sizes, sh shard, stop func(copySite, *token.FileSet) bool, skips *skipLog) ([]copySite, error) {
+	pkgs, err := loadPackages(patterns, fset, sh, *tests, skips, pkgCache, *excludePatterns)
+	if err != nil {
+		return nil, err
+	}
+	if *tests {
+		pkgs = testVariants(pkgs)
+	}
+
+	sites := []copySite{}
+	structs := []*types.TypeName{}
+	stopped := false
+	err = checkPkgs(pkgs, fset, lim, sizes, skips, func(pkg *packages.Package, s []copySite, ws []*types.TypeName, pkgSkips *skipLog) bool {
+		pkgCache.record(pkg, s, pkgSkips)
+		sites = append(sites, s...)
+		structs = append(structs, ws...)
+		stopped = stop != nil && anySite(s, fset, stop)
+		return !stopped
+	})
+	if err != nil {
+		return nil, err
+	}
+	if stopped {
+		sort.Sort(sortedCopySites{sites: sites, fset: fset})
+		return sites, nil
+	}
+	if err := pkgCache.save(); err != nil {
+		log.Printf("warning: %s", err)
+	}
+	sites = append(sites, findDuplicateStructs(structs, sizes, fset)...)
+	addCallCounts(sites, pkgs, pkgCache.cachedCalls())
+	sites = lim.enabled(sites)
+	sort.Sort(sortedCopySites{sites: sites, fset: fset})
+	return dedupeSites(sites, fset), nil
+}
+
+// loadContext is the context packages are loaded and analyzed in, which
+// Analyze sets to its caller's.
+var loadContext = context.Background()
+
+// checkPkgs runs checkPkg on pkgs, -concurrency of them at a time, and passes
+// each package with its sites, wide structs, and what it skipped to found in
+// the order of pkgs, so a run finds the same things in the same order however
+// the work is scheduled. What each package skips is recorded in skips in that
+// order too. It returns the first error in that order, or loadContext's once
+// it's done, and stops once found returns false, leaving the packages after it
+// unfinished.
+func checkPkgs(pkgs []*packages.Package, fset *token.FileSet, lim limits, sizes types.Sizes, skips *skipLog, found func(*packages.Package, []copySite, []*types.TypeName, *skipLog) bool) error {
+	type result struct {
+		sites   []copySite
+		structs []*types.TypeName
+		skips   *skipLog
+		err     error
+		done    chan struct{}
+	}
+	results := make([]result, len(pkgs))
+	for i := range results {
+		results[i].done = make(chan struct{})
+		results[i].skips = newSkipLog()
+	}
+	next := make(chan int)
+	quit := make(chan struct{})
+	defer close(quit)
+	go func() {
+		defer close(next)
+		for i := range pkgs {
+			select {
+			case next <- i:
+			case <-quit:
+				return
 			}
-			name := filepath.ToSlash(path[len(src):])
-			if re.MatchString(name) {
-				dirs = append(dirs, path)
+		}
+	}()
+	workers := *concurrency
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	for range min(workers, len(pkgs)) {
+		go func() {
+			for i := range next {
+				r := &results[i]
+				func() {
+					defer func() {
+						if p := recover(); p != nil {
+							r.err = recoveredError(pkgs[i].PkgPath, p)
+						}
+					}()
+					r.sites, r.structs, r.err = checkPkg(pkgs[i], fset, lim, sizes, r.skips)
+				}()
+				close(r.done)
 			}
+		}()
+	}
+	for i := range results {
+		r := &results[i]
+		select {
+		case <-r.done:
+		case <-loadContext.Done():
+			return loadContext.Err()
+		}
+		skips.merge(r.skips)
+		if r.err != nil {
+			return r.err
+		}
+		if !found(pkgs[i], r.sites, r.structs, r.skips) {
 			return nil
-		})
+		}
 	}
+	return nil
+}
 
-	pkgs := []*ast.Package{}
-	for _, d := range dirs {
-		_, err := buildContext.ImportDir(d, 0)
-		if err != nil {
-			if _, noGo := err.(*build.NoGoError); noGo {
-				continue
+// anySite returns true if f returns true for any of sites.
+func anySite(sites []copySite, fset *token.FileSet, f func(copySite, *token.FileSet) bool) bool {
+	for _, site := range sites {
+		if f(site, fset) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadMode is what the checks need to know about the packages they analyze.
+const loadMode = packages.NeedName | packages.NeedFiles | packages.NeedSyntax |
+	packages.NeedTypes | packages.NeedTypesInfo | packages.NeedModule
+
+// loadPackages loads the packages matched by any of patterns, which are
+// anything the go command accepts, like ./... or net/http, that belong to sh,
+// along with their tests if tests is true, in which case directories that
+// hold only tests match too. The pattern "std" matches the standard library
+// without its vendored packages.
+//
+// Packages matched by several patterns, or whose directories are matched
+// through several paths, such as symlinks, are loaded once. The packages of
+// other shards, the repeated matches, the files left out of the build, and
+// the packages with unreadable files, which can't be type checked, are
+// recorded in skips. So are the packages matching one of the exclude
+// patterns, as matchPackagePattern matches them, and the packages cache has
+// found nothing in before, which aren't loaded at all, unless cache is nil.
+func loadPackages(patterns []string, fset *token.FileSet, sh shard, tests bool, skips *skipLog, cache *resultCache, exclude []string) ([]*packages.Package, error) {
+	// List the matching packages before type checking them, so a shard
+	// only pays for its own.
+	mode := packages.NeedName | packages.NeedFiles
+	if cache != nil {
+		// The cache keys packages by their dependencies too.
+		mode |= packages.NeedImports | packages.NeedDeps
+	}
+	listed, err := packages.Load(loadConfig(patterns, mode), patterns...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find packages matching %s: %s", quotePatterns(patterns), err)
+	}
+	std := false
+	for _, p := range patterns {
+		std = std || p == "std"
+	}
+	paths := []string{}
+	dirs := make(map[string]bool)
+	keys := make(map[string]string)
+	// dropped is true if a package is excluded or cached rather than
+	// matching nothing.
+	dropped := false
+	var listErr error
+	for _, pkg := range listed {
+		if len(pkg.Errors) > 0 && pkg.Dir != "" && skips.addUnreadable(pkg.Dir) {
+			skips.add(skipUnreadablePkg, pkg.PkgPath)
+			continue
+		}
+		if len(pkg.GoFiles) == 0 && !(tests && hasTestFiles(pkg.Dir)) {
+			// Directories without Go files for this build, and
+			// patterns that match nothing.
+			if len(pkg.Errors) > 0 && listErr == nil {
+				listErr = pkg.Errors[0]
 			}
-			return nil, fmt.Errorf("unable to build code in %#v: %s", d, err)
+			continue
 		}
-		pkg, err := parsePkgDir(d, fset)
-		if err != nil {
-			return nil, err
+		if std && strings.HasPrefix(pkg.PkgPath, "vendor/") {
+			continue
+		}
+		dir := canonicalPath(pkgDir(pkg))
+		if dirs[dir] {
+			skips.add(skipRepeatedPkg, pkg.PkgPath)
+			continue
 		}
-		pkgs = append(pkgs, pkg)
+		dirs[dir] = true
+		if excludedPackage(pkg.PkgPath, exclude) {
+			skips.add(skipExcludedLoad, pkg.PkgPath)
+			dropped = true
+			continue
+		}
+		if !sh.owns(pkg.PkgPath) {
+			skips.add(skipOtherShard, pkg.PkgPath)
+			continue
+		}
+		skips.addFiles(pkg.IgnoredFiles)
+		if cache.skip(pkg, keys, skips) {
+			dropped = true
+			continue
+		}
+		paths = append(paths, loadPath(pkg))
 	}
-	if len(pkgs) == 0 {
-		return nil, fmt.Errorf("unable to find packages matching %#v", p)
+	if len(paths) == 0 {
+		if dropped {
+			return nil, nil
+		}
+		if listErr != nil {
+			return nil, fmt.Errorf("unable to find packages matching %s: %s", quotePatterns(patterns), listErr)
+		}
+		if len(skips.entities[skipOtherShard]) == 0 {
+			return nil, fmt.Errorf("unable to find packages matching %s", quotePatterns(patterns))
+		}
+		return nil, nil
 	}
 
+	cfg := loadConfig(patterns, loadMode)
+	cfg.Fset = fset
+	cfg.Tests = tests
+	pkgs, err := packages.Load(cfg, paths...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load packages matching %s: %s", quotePatterns(patterns), err)
+	}
 	return pkgs, nil
 }
 
-func checkPkg(pkg *ast.Package, fset *token.FileSet, maxWidth, wordSize, maxAlign int64) ([]copySite, error) {
-	sizes := &types.StdSizes{WordSize: wordSize, MaxAlign: maxAlign}
-	info := &types.Info{
-		// Types is required to prevent duplicates, it seems, in Defs.
-		Types: make(map[ast.Expr]types.TypeAndValue),
-		Defs:  make(map[*ast.Ident]types.Object),
+// testVariants returns pkgs, as loaded with their tests, with each package
+// that has a test variant replaced by it, since the variant's files include
+// the package's own, and without the generated main packages of the test
+// binaries. External test packages are kept.
+func testVariants(pkgs []*packages.Package) []*packages.Package {
+	tested := make(map[string]bool)
+	for _, pkg := range pkgs {
+		// Test variants have IDs like "p [p.test]".
+		if pkg.ID == pkg.PkgPath+" ["+pkg.PkgPath+".test]" {
+			tested[pkg.PkgPath] = true
+		}
+	}
+	out := []*packages.Package{}
+	for _, pkg := range pkgs {
+		if pkg.ID == pkg.PkgPath && (tested[pkg.PkgPath] || strings.HasSuffix(pkg.PkgPath, ".test")) {
+			continue
+		}
+		out = append(out, pkg)
+	}
+	return out
+}
+
+// pkgDir returns the directory of the listed pkg's files.
+func pkgDir(pkg *packages.Package) string {
+	if len(pkg.GoFiles) == 0 {
+		// A directory of tests only.
+		return pkg.Dir
+	}
+	return filepath.Dir(pkg.GoFiles[0])
+}
+
+// hasTestFiles returns true if dir holds _test.go files.
+func hasTestFiles(dir string) bool {
+	if dir == "" {
+		return false
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, "*_test.go"))
+	return len(matches) > 0
+}
+
+// loadPath returns the pattern that loads just pkg. In GOPATH mode, packages
+// outside of GOPATH have made-up import paths starting with "_" and have to be
+// loaded by directory.
+func loadPath(pkg *packages.Package) string {
+	if !strings.HasPrefix(pkg.PkgPath, "_/") {
+		return pkg.PkgPath
+	}
+	dir := pkgDir(pkg)
+	wd, err := os.Getwd()
+	if err != nil {
+		return dir
+	}
+	rel, err := filepath.Rel(wd, dir)
+	if err != nil {
+		return dir
+	}
+	if !strings.HasPrefix(rel, "..") {
+		rel = "./" + rel
+	}
+	return filepath.ToSlash(rel)
+}
+
+// loadConfig returns the configuration for loading the packages matched by
+// patterns with mode. Directories outside any module are loaded in GOPATH
+// mode, so that copies of source trees without a go.mod can still be
+// analyzed.
+func loadConfig(patterns []string, mode packages.LoadMode) *packages.Config {
+	// cgo files can't be type checked without running cgo, so select the
+	// files a build without cgo would use instead.
+	env := append(os.Environ(), "CGO_ENABLED=0")
+	if *goos != "" || *goarch != "" {
+		// Select the files of the target, not the go command's default.
+		env = append(env, "GOOS="+build.Default.GOOS, "GOARCH="+build.Default.GOARCH)
+	}
+	if *goroot != "" {
+		// Export data is only available for the go command's own
+		// GOROOT, so type check the dependencies from source too.
+		env = append(env, "GOROOT="+build.Default.GOROOT)
+		if mode&packages.NeedTypes != 0 {
+			mode |= packages.NeedDeps
+		}
 	}
-	conf := &types.Config{
-		Importer:                 importer.Default(),
-		DisableUnusedImportCheck: true,
-		Sizes: sizes,
+	for _, p := range patterns {
+		if dir, ok := patternDir(p); ok {
+			if _, ok := moduleRoot(dir); !ok {
+				env = append(env, "GO111MODULE=off")
+				break
+			}
+		}
+	}
+	cfg := &packages.Config{Context: loadContext, Mode: mode, Env: env, Overlay: lspOverlay}
+	if *buildTags != "" {
+		cfg.BuildFlags = []string{"-tags=" + strings.Join(parseTags(*buildTags), ",")}
+	}
+	return cfg
+}
+
+// packagePatterns returns the package patterns given on the command line with
+// the directories a shell expanded, like pkg/a from pkg/*, turned into
+// patterns the go command doesn't take for import paths. Other arguments a
+// shell expanded along with them, like pkg/README.md, are left out.
+func packagePatterns(args []string) []string {
+	patterns := []string{}
+	for _, arg := range args {
+		if strings.HasPrefix(arg, ".") || filepath.IsAbs(arg) || strings.Contains(arg, "...") {
+			patterns = append(patterns, arg)
+			continue
+		}
+		info, err := os.Stat(arg)
+		switch {
+		case err != nil:
+			// An import path pattern.
+			patterns = append(patterns, arg)
+		case info.IsDir():
+			patterns = append(patterns, "./"+filepath.ToSlash(arg))
+		case strings.HasSuffix(arg, ".go"):
+			patterns = append(patterns, arg)
+		}
 	}
-	files := []*ast.File{}
-	for _, f := range pkg.Files {
-		files = append(files, f)
+	return patterns
+}
+
+// quotePatterns returns patterns for error messages, like "./a", "./b".
+func quotePatterns(patterns []string) string {
+	quoted := make([]string, len(patterns))
+	for i, p := range patterns {
+		quoted[i] = fmt.Sprintf("%#v", p)
 	}
+	return strings.Join(quoted, ", ")
+}
 
-	_, err := conf.Check("", fset, files, info)
+// patternDir returns the directory a pattern like ./pkg, ./..., or
+// /abs/path/... starts at. Patterns that don't start with a directory are
+// import path patterns.
+func patternDir(p string) (string, bool) {
+	if !strings.HasPrefix(p, ".") && !filepath.IsAbs(p) {
+		return "", false
+	}
+	dir := strings.TrimSuffix(strings.TrimSuffix(p, "..."), "/")
+	if dir == "" {
+		dir = "."
+	}
+	dir, err := filepath.Abs(dir)
 	if err != nil {
-		return nil, fmt.Errorf("unable to type check package %#v: %s", pkg.Name, err)
+		return "", false
 	}
+	return dir, true
+}
 
-	wideStructs := make(map[string]bool)
+// checkPkg returns the sites of the type checked pkg along with its named
+// struct types that are too wide for the duplicate check. Types it can't size
+// are recorded in skips, as are packages whose files became unreadable after
+// they were listed.
+func checkPkg(pkg *packages.Package, fset *token.FileSet, lim limits, sizes types.Sizes, skips *skipLog) ([]copySite, []*types.TypeName, error) {
+	if len(pkg.Errors) > 0 && pkg.Dir != "" && skips.addUnreadable(pkg.Dir) {
+		skips.add(skipUnreadablePkg, pkg.PkgPath)
+		return nil, nil, nil
+	}
+	if err := typeErrors(pkg, skips); err != nil {
+		return nil, nil, err
+	}
+	decls := collectDecls(pkg.Syntax, pkg.TypesInfo, fset, sizes, lim.of(checkDuplicate), skips)
+	if tested := strings.TrimSuffix(pkg.PkgPath, "_test"); tested != pkg.PkgPath {
+		// An external test package copies the values of the package it
+		// tests, whose types are as much its own as those it declares.
+		for _, obj := range pkg.TypesInfo.Uses {
+			if tn, ok := obj.(*types.TypeName); ok && tn.Pkg() != nil && tn.Pkg().Path() == tested && !isGeneric(tn.Type()) {
+				decls.named[tn] = true
+				decls.declared[tn] = fset.Position(tn.Pos())
+			}
+		}
+	}
+	wide := wideTypes{named: decls.named, maxes: decls.maxes, sizes: sizes}
+	sites := findSites(pkg.Syntax, pkg.TypesInfo, decls, wide, lim, countCalls(pkg.Syntax, pkg.TypesInfo))
+	sites = append(sites, findDependencyCalls(pkg.Syntax, pkg.TypesInfo, pkg.Types, modulePath(pkg), wide.over(lim.of(checkDependencyCall)))...)
+	sites = append(sites, findCalls(pkg.Syntax, pkg.TypesInfo, pkg.Types, modulePath(pkg), wide.over(lim.of(checkCall)))...)
+	return sites, decls.structs, nil
+}
 
-	funcs := []*types.Func{}
-	for _, obj := range info.Defs {
-		if tn, ok := obj.(*types.TypeName); ok {
-			if sizes.Sizeof(tn.Type()) > maxWidth {
-				wideStructs[tn.Id()] = true
+// typeErrors returns the first of pkg's errors, or nil if it has none or
+// -lenient analyzes it anyway. go/packages keeps type checking past errors,
+// so with -lenient the checks see every declaration and expression that does
+// type check, and pkg is recorded in skips as analyzed in part.
+func typeErrors(pkg *packages.Package, skips *skipLog) error {
+	if len(pkg.Errors) == 0 {
+		return nil
+	}
+	if !*lenient || pkg.Types == nil || pkg.TypesInfo == nil {
+		return fmt.Errorf("unable to type check package %#v: %s", pkg.PkgPath, pkg.Errors[0])
+	}
+	entity := fmt.Sprintf("%s: %s", pkg.PkgPath, pkg.Errors[0])
+	if len(pkg.Errors) > 1 {
+		entity += fmt.Sprintf(" (and %s)", plural(len(pkg.Errors)-1, "more error"))
+	}
+	skips.add(skipPartialPkg, entity)
+	return nil
+}
+
+// pkgDecls are the declarations of a type checked package the checks look at.
+type pkgDecls struct {
+	// named are the named types that have a size.
+	named map[*types.TypeName]bool
+	// structs are the named struct types wider than the maximum width.
+	structs []*types.TypeName
+	// allStructs are all the named struct types.
+	allStructs []*types.TypeName
+	funcs      []*types.Func
+	// ignored are the funcs and types with an ignore directive, with its
+	// reason. They are left out of structs.
+	ignored map[types.Object]string
+	// declared are where the named types in named are declared.
+	declared map[*types.TypeName]token.Position
+	// maxes are the sizes that max directives set for types.
+	maxes map[*types.TypeName]int64
+}
+
+// collectDecls returns the declarations in info. Types it can't size are
+// recorded in skips, as are invalid max directives.
+func collectDecls(files []*ast.File, info *types.Info, fset *token.FileSet, sizes types.Sizes, maxWidth int64, skips *skipLog) pkgDecls {
+	decls := pkgDecls{
+		named:    make(map[*types.TypeName]bool),
+		ignored:  ignoredDecls(files, info, fset, skips),
+		declared: make(map[*types.TypeName]token.Position),
+		maxes:    typeMaxes(files, info, fset, skips),
+	}
+	for id, obj := range info.Defs {
+		if tn, ok := obj.(*types.TypeName); ok && isGeneric(tn.Type()) {
+			if _, ok := tn.Type().(*types.Named); ok {
+				skips.add(skipGenericType, positionOf(fset, id, tn.Name()))
+			}
+		}
+		if tn, ok := obj.(*types.TypeName); ok && !isGeneric(tn.Type()) {
+			if _, ok := tn.Type().Underlying().(*types.Struct); ok && !tn.IsAlias() {
+				decls.allStructs = append(decls.allStructs, tn)
+			}
+			decls.named[tn] = true
+			decls.declared[tn] = fset.Position(tn.Pos())
+			max, ok := decls.maxes[tn]
+			if !ok {
+				max = maxWidth
+			}
+			if sizes.Sizeof(tn.Type()) > max {
+				if _, ok := tn.Type().Underlying().(*types.Struct); ok && !tn.IsAlias() && !isIgnored(decls.ignored, tn) {
+					decls.structs = append(decls.structs, tn)
+				}
 			}
 		}
 		if f, ok := obj.(*types.Func); ok {
-			funcs = append(funcs, f)
+			decls.funcs = append(decls.funcs, f)
 		}
 	}
+	return decls
+}
 
-	sites := findCopySites(funcs, wideStructs)
+// findSites runs the checks on a type checked package, each with wide at the
+// size lim gives it. calls are the number of static calls of each func.
+func findSites(files []*ast.File, info *types.Info, decls pkgDecls, wide wideTypes, lim limits, calls map[*types.Func]int) []copySite {
+	at := func(check string) wideTypes {
+		return wide.over(lim.of(check))
+	}
+	sites := findCopySites(decls.funcs, at(checkSignature), abiRegs[build.Default.GOARCH], lim.roles)
+	addValueEnds(sites, files)
+	single := singleCallerFuncs(calls, info)
+	for i := range sites {
+		sites[i].singleCaller = single[sites[i].fun]
+		sites[i].calls = calls[sites[i].fun]
+	}
+	addTypeSizes(sites, decls.declared, wide.maxes, lim.of(checkSignature))
+	addFixImpact(sites, info, calls)
+	addConfidence(sites, files, info, calls)
+	addImplements(sites, info)
+	sites = append(sites, findInstantiationSites(decls.funcs, info, at(checkInstantiation), lim.roles)...)
+	sites = append(sites, findForeignInstantiations(files, info, at(checkInstantiation), lim.roles)...)
+	sites = append(sites, findSelectCopies(files, info, at(checkSelect))...)
+	sites = append(sites, findWideChans(files, info, at(checkChan))...)
+	sites = append(sites, findPoolCaptures(files, info, at(checkCapture))...)
+	sites = append(sites, findLiteralCopies(files, info, at(checkLiteral))...)
+	sites = append(sites, findWideFields(decls.allStructs, at(checkField))...)
+	sites = append(sites, findWideContainers(files, info, at(checkContainer))...)
+	sites = append(sites, findWastedPointers(files, info, at(checkDeref))...)
+	sites = append(sites, findBoxedReceivers(files, info, at(checkBoxedReceiver))...)
+	sites = append(sites, withoutSitesAt(findBoxings(files, info, at(checkBoxing)), sites)...)
+	sites = append(sites, findMapWrites(files, info, at(checkMapWrite))...)
+	if lim.roles.has("result") {
+		sites = append(sites, findNamedResults(files, info, at(checkNamedResult))...)
+	}
+	sites = append(sites, findRangeCopies(files, info, at(checkRange))...)
+	sites = append(sites, findDynamicCopies(files, info, at(checkDynamicType))...)
+	sites = append(sites, withoutSitesAt(findAssignCopies(files, info, at(checkAssign)), sites)...)
+	addIgnored(sites, decls.ignored)
+	return sites
+}
 
-	return sites, nil
+// isGeneric returns true if t is a type parameter or a generic type that hasn't
+// been instantiated. Neither has a size.
+func isGeneric(t types.Type) bool {
+	switch t := t.(type) {
+	case *types.TypeParam:
+		return true
+	case *types.Named:
+		return t.TypeParams().Len() > t.TypeArgs().Len()
+	}
+	return false
 }
 
 // findCopySites returns a slice of copySites that represent Go function calls
-// that use a large struct without a pointer to it. The wideStructs argument is
-// a map of the struct's TypeName id to its TypeName object.
-func findCopySites(funcs []*types.Func, wideStructs map[string]bool) []copySite {
+// that use a large struct without a pointer to it. The wide argument decides
+// which receiver, parameter, and result types are too wide. regs are the
+// argument registers of the target architecture, used to work out which wide
+// values are passed in registers anyway. Only the values in roles are
+// reported.
+func findCopySites(funcs []*types.Func, wide wideTypes, regs abiRegisters, roles signatureRoles) []copySite {
 	sites := []copySite{}
 	for _, f := range funcs {
 		s := f.Type().(*types.Signature)
 		shouldBe := []string{}
+		inRegs := true
+		size := int64(0)
+		values := []copiedValue{}
+		flagged := func(v *types.Var, passed bool, role string, index int) {
+			inRegs = inRegs && passed
+			n := wide.sizes.Sizeof(v.Type())
+			if n > size {
+				size = n
+			}
+			values = append(values, copiedValue{typ: v.Type(), size: n, role: role, index: index, pos: v.Pos()})
+		}
+		args := regAssigner{free: regs}
 
 		// If the func is a method, check the receiver
 		if s.Recv() != nil {
 			rt := s.Recv().Type()
-			if isWideStructTyped(rt, wideStructs) {
+			passed := args.assign(rt)
+			if roles.has("receiver") && wide.isWide(rt) {
 				shouldBe = append(shouldBe, "receiver")
+				flagged(s.Recv(), passed, "receiver", 0)
 			}
 		}
 
 		params := s.Params()
 		for i := 0; i < params.Len(); i++ {
 			v := params.At(i)
-			if isWideStructTyped(v.Type(), wideStructs) {
+			passed := args.assign(v.Type())
+			if roles.has("parameter") && wide.isWide(v.Type()) {
+				flagged(v, passed, "parameter", i)
 				name := v.Name()
 				parameter := "parameter"
 				if name != "" {
@@ -238,42 +1243,333 @@ func findCopySites(funcs []*types.Func, wideStructs map[string]bool) []copySite
 		}
 
 		results := s.Results()
+		res := regAssigner{free: regs}
 		for i := 0; i < results.Len(); i++ {
 			v := results.At(i)
-			if isWideStructTyped(v.Type(), wideStructs) {
+			passed := res.assign(v.Type())
+			if roles.has("result") && wide.isWide(v.Type()) {
+				flagged(v, passed, "result", i)
 				shouldBe = append(shouldBe,
-					fmt.Sprintf("return value '%s' at index %d", v.Type(), i))
+					fmt.Sprintf("return value '%s' at index %d", typeString(v.Type(), f.Pkg()), i))
 			}
 		}
 		if len(shouldBe) > 0 {
-			sites = append(sites, copySite{f, shouldBe})
+			sites = append(sites, copySite{pos: f.Pos(), check: checkSignature, fun: f, shouldBe: shouldBe, breaking: isExportedAPI(f), registerPassed: inRegs, size: size, values: values})
 		}
 	}
 	return sites
 }
 
-func printSites(sites []copySite, fset *token.FileSet, w io.Writer) {
-	sort.Sort(sortedCopySites{sites: sites, fset: fset})
+// addValueEnds sets the end of each value of the signature sites to the end
+// of its declaration in files, so that the whole of a declaration like
+// "p Config" can be pointed at.
+func addValueEnds(sites []copySite, files []*ast.File) {
+	ends := make(map[token.Pos]token.Pos)
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			fd, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			for _, list := range []*ast.FieldList{fd.Recv, fd.Type.Params, fd.Type.Results} {
+				if list == nil {
+					continue
+				}
+				for _, field := range list.List {
+					ends[field.Type.Pos()] = field.Type.End()
+					for _, name := range field.Names {
+						ends[name.Pos()] = field.Type.End()
+					}
+				}
+			}
+		}
+	}
+	for i := range sites {
+		for j := range sites[i].values {
+			v := &sites[i].values[j]
+			if v.role != "" {
+				v.end = ends[v.pos]
+			}
+		}
+	}
+}
+
+// isExportedAPI reports whether f is part of its package's exported API, in
+// which case changing its signature is a breaking change for importers. Funcs
+// in package main, unexported funcs, and methods on unexported types are
+// invisible to importers and can be changed freely.
+func isExportedAPI(f *types.Func) bool {
+	if f.Pkg() == nil || f.Pkg().Name() == "main" || !f.Exported() {
+		return false
+	}
+	s := f.Type().(*types.Signature)
+	if s.Recv() == nil {
+		return true
+	}
+	rt := s.Recv().Type()
+	if p, ok := rt.(*types.Pointer); ok {
+		rt = p.Elem()
+	}
+	if named, ok := rt.(*types.Named); ok {
+		return named.Obj().Exported()
+	}
+	return false
+}
+
+// siteLabels selects the optional labels appended to each site's message.
+type siteLabels struct {
+	breaking  bool
+	registers bool
+	// cacheLineSize, if positive, labels sites with the cache lines their
+	// largest flagged value spans.
+	cacheLineSize int64
+	// impact labels signature sites with how much code fixing them changes.
+	impact bool
+	// cost labels sites with the bytes they copy per run of the program.
+	cost bool
+	// hot labels sites with their funcs' share of a CPU profile.
+	hot bool
+	// confidence labels sites with how sure they are that the copy is made.
+	confidence bool
+	// arches, if set, labels sites with the size of their widest type on
+	// each of the architectures of an -arch run.
+	arches []archSizes
+}
+
+func printSites(sites []copySite, fset *token.FileSet, w io.Writer, labels siteLabels) {
 	for _, site := range sites {
-		f := site.fun
-		shouldBe := site.shouldBe
-		sb := sentence(shouldBe)
-		msg := "should be made into"
-		if len(shouldBe) > 1 {
-			msg += " pointers"
+		position := fset.Position(site.pos)
+		fmt.Fprintf(w, "%s:%d:%d: %s\n", relPath(position.Filename), position.Line, position.Column, site.message(labels))
+	}
+}
+
+// message returns the human-readable description of the site, e.g.
+// "receiver should be made into a pointer (func (T).M())".
+func (site copySite) message(labels siteLabels) string {
+	msg := "should be made into"
+	if len(site.shouldBe) > 1 {
+		msg += " pointers"
+	} else {
+		msg += " a pointer"
+	}
+	label := ""
+	if labels.breaking {
+		if site.breaking {
+			label += " [breaking]"
 		} else {
-			msg += " a pointer"
+			label += " [non-breaking]"
 		}
-		pos := site.fun.Pos()
-		file := fset.File(pos)
-		position := file.Position(pos)
-		fmt.Fprintf(w, "%s:%d:%d: %s %s (%s)\n", file.Name(), position.Line, position.Column, sb, msg, f)
 	}
+	if labels.registers && site.registerPassed {
+		label += " [likely register-passed]"
+	}
+	if labels.cacheLineSize > 0 {
+		n := site.cacheLines(labels.cacheLineSize)
+		if n == 1 {
+			label += " [spans 1 cache line]"
+		} else {
+			label += fmt.Sprintf(" [spans %d cache lines]", n)
+		}
+	}
+	if labels.impact && site.check == checkSignature {
+		label += site.impactLabel()
+	}
+	if labels.cost && site.fun != nil {
+		label += site.costLabel()
+	}
+	if labels.hot && site.hot > 0 {
+		label += site.hotLabel()
+	}
+	if labels.confidence {
+		label += site.confidence.label()
+	}
+	if t, _ := site.widestType(); t != nil && len(labels.arches) > 0 {
+		label += archLabel(t, labels.arches)
+	}
+	if len(site.implements) > 0 {
+		label += fmt.Sprintf(" [implements %s]", strings.Join(site.implements, ", "))
+	}
+	if site.fun == nil {
+		return site.what + label
+	}
+	if site.what != "" {
+		return fmt.Sprintf("%s (%s)%s", site.what, types.ObjectString(site.fun, types.RelativeTo(site.fun.Pkg())), label)
+	}
+	return fmt.Sprintf("%s %s (%s)%s%s", sentence(site.shouldBe), msg, types.ObjectString(site.fun, types.RelativeTo(site.fun.Pkg())), site.sizeNote(), label)
+}
+
+// typeString returns t as written in pkg, with the types of other packages
+// qualified by their import paths.
+func typeString(t types.Type, pkg *types.Package) string {
+	return types.TypeString(t, types.RelativeTo(pkg))
 }
 
 type copySite struct {
-	fun      *types.Func
+	// pos is where the copy happens: the func's name for by-value
+	// signatures, or the statement for copies found in func bodies.
+	pos token.Pos
+	// fun is the func with the by-value signature, or the func whose body
+	// contains the copy. It is nil for sites about type declarations.
+	fun *types.Func
+	// shouldBe lists the receiver, parameters, and results of fun that
+	// should be pointers. It is empty for copies found in func bodies.
 	shouldBe []string
+	// what describes a copy found in a func body, or the problem with a type
+	// declaration.
+	what string
+	// decl is the type declaration the site is about, if it isn't about a
+	// func.
+	decl *types.TypeName
+	// pkg is the package of a site that is about neither a func nor a type
+	// declaration, like a package-level variable's.
+	pkg *types.Package
+	// check is the check that found the site.
+	check string
+	// breaking is true if fixing the site changes the exported API.
+	breaking bool
+	// registerPassed is true if the register-based calling convention
+	// likely passes every flagged value in registers rather than copying
+	// it through memory.
+	registerPassed bool
+	// size is the size in bytes of the largest flagged value.
+	size int64
+	// weight is the weight of the site's package, which its size counts
+	// for times in its severity and order. Zero counts as 1.
+	weight float64
+	// values are the flagged values that are copied.
+	values []copiedValue
+	// calls is the number of static call sites of fun in the analyzed
+	// packages. It is zero for copies found in func bodies.
+	calls int
+	// cost is the number of bytes the site copies per run of the program,
+	// as estimated from its call graph by -sort cost.
+	cost int64
+	// hot is the percentage of a -pprof profile's samples whose stacks fun
+	// is on.
+	hot float64
+	// singleCaller is true if the func is unexported and called from exactly
+	// one place in its package.
+	singleCaller bool
+	// refs is the number of uses of fun in its package other than calls.
+	refs int
+	// satisfactions are the interfaces that the receiver type of fun would
+	// no longer satisfy with a pointer receiver.
+	satisfactions []string
+	// confidence is how sure the site is that the compiler makes its copies.
+	confidence confidence
+	// implements are the interfaces that dictate the signature of fun, so
+	// that it can't be changed without breaking their implementation.
+	implements []string
+	// ignored is true if an ignore directive suppresses the site.
+	ignored bool
+	// dependency is the import path of the package a dependency call site
+	// calls into.
+	dependency string
+	// typeSizes are the distinct types of a by-value signature's flagged
+	// values, and max the size they exceed.
+	typeSizes []typeSize
+	max       int64
+}
+
+// typeSize is the size of a type a site flags, and where it is declared if
+// it's a named type.
+type typeSize struct {
+	typ      types.Type
+	size     int64
+	declared token.Position
+	// max is the size a max directive sets for the type, if it has one.
+	max *int64
+}
+
+// addTypeSizes sets the typeSizes and max of the by-value signature sites,
+// with the named types' declarations taken from declared and the sizes their
+// max directives set from maxes.
+func addTypeSizes(sites []copySite, declared map[*types.TypeName]token.Position, maxes map[*types.TypeName]int64, max int64) {
+	for i := range sites {
+		site := &sites[i]
+		if site.check != checkSignature {
+			continue
+		}
+		site.max = max
+		seen := make(map[string]bool)
+		for _, v := range site.values {
+			key := types.TypeString(v.typ, nil)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			ts := typeSize{typ: v.typ, size: v.size}
+			switch t := v.typ.(type) {
+			case *types.Alias:
+				// The alias is what the signature names.
+				ts.declared = declared[t.Obj()]
+			case *types.Named:
+				ts.declared = declared[t.Origin().Obj()]
+			}
+			if named, ok := types.Unalias(v.typ).(*types.Named); ok {
+				if n, ok := maxes[named.Obj()]; ok {
+					ts.max = &n
+				}
+			}
+			site.typeSizes = append(site.typeSizes, ts)
+		}
+	}
+}
+
+// sizeNote returns what the message of a by-value signature says about the
+// sizes of its flagged types, like "; 'Config' is 48 bytes (declared at
+// config.go:12), max 16". It's empty for other sites.
+func (site copySite) sizeNote() string {
+	if len(site.typeSizes) == 0 {
+		return ""
+	}
+	var pkg *types.Package
+	if site.fun != nil {
+		pkg = site.fun.Pkg()
+	}
+	notes := []string{}
+	for _, ts := range site.typeSizes {
+		note := fmt.Sprintf("'%s' is %d bytes", typeString(ts.typ, pkg), ts.size)
+		switch {
+		case ts.declared.IsValid() && ts.max != nil:
+			note += fmt.Sprintf(" (declared at %s:%d with max %d)", relPath(ts.declared.Filename), ts.declared.Line, *ts.max)
+		case ts.declared.IsValid():
+			note += fmt.Sprintf(" (declared at %s:%d)", relPath(ts.declared.Filename), ts.declared.Line)
+		case ts.max != nil:
+			note += fmt.Sprintf(" (max %d)", *ts.max)
+		}
+		notes = append(notes, note)
+	}
+	return fmt.Sprintf("; %s, max %d", strings.Join(notes, ", "), site.max)
+}
+
+// copiedValue is a value a site copies.
+type copiedValue struct {
+	typ  types.Type
+	size int64
+	// role is "receiver", "parameter", or "result" for the values of a
+	// by-value signature, and empty otherwise.
+	role string
+	// index is the position of a parameter or result in its list.
+	index int
+	// pos is where the receiver, parameter, or result is declared, and end
+	// where its declaration, like "p Config", ends, if known.
+	pos token.Pos
+	end token.Pos
+}
+
+// weighted returns n times the weight of the site's package.
+func (site copySite) weighted(n float64) float64 {
+	if site.weight == 0 {
+		return n
+	}
+	return n * site.weight
+}
+
+// cacheLines returns the number of cache lines of lineSize bytes the site's
+// largest flagged value spans when it starts on a line boundary.
+func (site copySite) cacheLines(lineSize int64) int64 {
+	return (site.size + lineSize - 1) / lineSize
 }
 
 // sortedCopySites sorts copySites as ordered by the filename, line, and column
@@ -291,9 +1587,11 @@ func (s sortedCopySites) Swap(i, j int) {
 }
 
 func (s sortedCopySites) Less(i, j int) bool {
-	left := s.fset.Position(s.sites[i].fun.Pos())
-	right := s.fset.Position(s.sites[j].fun.Pos())
+	return positionLess(s.fset.Position(s.sites[i].pos), s.fset.Position(s.sites[j].pos))
+}
 
+// positionLess orders positions by filename, line, and column.
+func positionLess(left, right token.Position) bool {
 	if left.Filename != right.Filename {
 		return left.Filename < right.Filename
 	}
@@ -303,11 +1601,65 @@ func (s sortedCopySites) Less(i, j int) bool {
 	return left.Column < right.Column
 }
 
-// isWideStructTyped returns true if the given type is a struct (not a pointer to
-// a struct) that is in wideStructs.
-func isWideStructTyped(t types.Type, wideStructs map[string]bool) bool {
-	if named, ok := t.(*types.Named); ok {
-		return wideStructs[named.Obj().Id()]
+// wideTypes decides which types are too wide to copy.
+type wideTypes struct {
+	// named holds the package's named types that have a size.
+	named map[*types.TypeName]bool
+	// maxes are the sizes that max directives set for named types, which
+	// they must exceed in place of max.
+	maxes map[*types.TypeName]int64
+	sizes types.Sizes
+	max   int64
+}
+
+// over returns w with max as the size types must exceed to be too wide.
+func (w wideTypes) over(max int64) wideTypes {
+	w.max = max
+	return w
+}
+
+// isWide returns true if the given type is too wide to copy: one of the
+// package's named types in named, or an unnamed array or struct type, such as
+// [8]Config or struct{ items [4]Big }, whose total size is over max, or over
+// the size a max directive sets for a named type. Pointers are never wide,
+// and aliases are as wide as the types they stand for.
+func (w wideTypes) isWide(t types.Type) bool {
+	switch t := types.Unalias(t).(type) {
+	case *types.Named:
+		if max, ok := w.maxes[t.Obj()]; ok {
+			return w.named[t.Obj()] && w.sizes.Sizeof(t) > max
+		}
+		return w.named[t.Obj()] && w.sizes.Sizeof(t) > w.max
+	case *types.Array, *types.Struct:
+		return !hasTypeParam(t) && w.sizes.Sizeof(t) > w.max
+	}
+	return false
+}
+
+// hasTypeParam returns true if the size of t depends on a type parameter.
+func hasTypeParam(t types.Type) bool {
+	switch t := t.(type) {
+	case *types.TypeParam:
+		return true
+	case *types.Named:
+		if isGeneric(t) {
+			return true
+		}
+		args := t.TypeArgs()
+		for i := 0; i < args.Len(); i++ {
+			if hasTypeParam(args.At(i)) {
+				return true
+			}
+		}
+		return false
+	case *types.Array:
+		return hasTypeParam(t.Elem())
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			if hasTypeParam(t.Field(i).Type()) {
+				return true
+			}
+		}
 	}
 	return false
 }
@@ -0,0 +1,44 @@
+package copyfighter
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+)
+
+// findMapWrites returns a copySite for every assignment that stores a wide
+// value into a map element, like m[k] = big. The write copies the whole value
+// into the map, and since map elements can't be updated in place, every change
+// to one reads it out and writes it back, copying it twice more. The
+// assignments are often in other packages than the map's type, so they are
+// reported where they happen.
+func findMapWrites(files []*ast.File, info *types.Info, wide wideTypes) []copySite {
+	sites := []copySite{}
+	inspectFuncBodies(files, info, func(fun *types.Func, n ast.Node) bool {
+		as, ok := n.(*ast.AssignStmt)
+		if !ok {
+			return true
+		}
+		for _, lhs := range as.Lhs {
+			index, ok := ast.Unparen(lhs).(*ast.IndexExpr)
+			if !ok {
+				continue
+			}
+			mt, ok := underlyingTypeOf(info, index.X).(*types.Map)
+			if !ok || !wide.isWide(mt.Elem()) {
+				continue
+			}
+			size := wide.sizes.Sizeof(mt.Elem())
+			sites = append(sites, copySite{
+				check:  checkMapWrite,
+				pos:    as.Pos(),
+				fun:    fun,
+				what:   fmt.Sprintf("writing to '%s' copies '%s' (%d bytes) into the map, and updating it copies it out and back again, use a map of pointers instead", types.ExprString(ast.Unparen(index.X)), typeString(mt.Elem(), fun.Pkg()), size),
+				size:   size,
+				values: []copiedValue{{typ: mt.Elem(), size: size}},
+			})
+		}
+		return true
+	})
+	return sites
+}
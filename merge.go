@@ -0,0 +1,227 @@
+package copyfighter
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/token"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// mergeReports implements the merge subcommand, which combines the json or
+// sarif reports of the shards of a run into one report. A finding that more
+// than one report has, by its fingerprint, is kept once, in the place it's
+// first found. The counts of the merged findings are logged to stderr.
+func mergeReports(args []string) error {
+	fs := flag.NewFlagSet("merge", flag.ContinueOnError)
+	out := fs.String("o", "", "path to write the merged report to instead of stdout")
+	sortBy := fs.String("sort", "", "order of the merged findings: position, or impact or cost for json reports; by default they keep the order of the reports")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: %s merge [flags] REPORT...", os.Args[0])
+	}
+	switch *sortBy {
+	case "", "position", "impact", "cost":
+	default:
+		return fmt.Errorf("unknown -sort %#v, must be position, impact, or cost", *sortBy)
+	}
+
+	reports := make([][]byte, 0, fs.NArg())
+	for _, name := range fs.Args() {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("unable to read report: %s", err)
+		}
+		reports = append(reports, data)
+	}
+	var buf bytes.Buffer
+	var counts map[string]int
+	var dropped int
+	var err error
+	switch data := bytes.TrimSpace(reports[0]); {
+	case bytes.HasPrefix(data, []byte("[")):
+		counts, dropped, err = mergeJSON(&buf, fs.Args(), reports, *sortBy)
+	case bytes.HasPrefix(data, []byte("{")):
+		if *sortBy == "impact" || *sortBy == "cost" {
+			return fmt.Errorf("sarif reports can only be sorted by position")
+		}
+		counts, dropped, err = mergeSARIF(&buf, fs.Args(), reports, *sortBy)
+	default:
+		return fmt.Errorf("%s isn't a json or sarif report", fs.Arg(0))
+	}
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		_, err = os.Stdout.Write(buf.Bytes())
+	} else {
+		err = os.WriteFile(*out, buf.Bytes(), 0o644)
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("merged %s: %s, %s dropped", plural(len(reports), "report"), checkCounts(counts), plural(dropped, "duplicate"))
+	return nil
+}
+
+// checkCounts returns the number of findings in counts, which has that of
+// each check ID, like "3 findings (2 signature, 1 range)".
+func checkCounts(counts map[string]int) string {
+	ids := make([]string, 0, len(counts))
+	total := 0
+	for id, n := range counts {
+		ids = append(ids, id)
+		total += n
+	}
+	sort.Strings(ids)
+	for i, id := range ids {
+		ids[i] = fmt.Sprintf("%d %s", counts[id], id)
+	}
+	line := plural(total, "finding")
+	if len(ids) > 0 {
+		line += " (" + strings.Join(ids, ", ") + ")"
+	}
+	return line
+}
+
+// mergeJSON writes the findings of the json reports, named by names, to w,
+// and returns the number of each check's findings it wrote and of those it
+// dropped as duplicates.
+func mergeJSON(w io.Writer, names []string, reports [][]byte, sortBy string) (map[string]int, int, error) {
+	merged := []jsonFinding{}
+	seen := make(map[string]bool)
+	dropped := 0
+	for i, data := range reports {
+		var findings []jsonFinding
+		if err := json.Unmarshal(data, &findings); err != nil {
+			return nil, 0, fmt.Errorf("%s isn't a json report: %s", names[i], err)
+		}
+		for _, f := range findings {
+			if f.Fingerprint != "" {
+				if seen[f.Fingerprint] {
+					dropped++
+					continue
+				}
+				seen[f.Fingerprint] = true
+			}
+			merged = append(merged, f)
+		}
+	}
+	if sortBy != "" {
+		sort.SliceStable(merged, func(i, j int) bool {
+			return positionLess(merged[i].position(), merged[j].position())
+		})
+	}
+	switch sortBy {
+	case "impact":
+		sort.SliceStable(merged, func(i, j int) bool {
+			return merged[i].Calls > merged[j].Calls
+		})
+	case "cost":
+		sort.SliceStable(merged, func(i, j int) bool {
+			return merged[i].Cost > merged[j].Cost
+		})
+	}
+	counts := make(map[string]int)
+	for _, f := range merged {
+		counts[f.Check]++
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return counts, dropped, enc.Encode(merged)
+}
+
+// mergeSARIF writes a SARIF log with one run that has the results of the runs
+// of the sarif reports, named by names, to w, and returns the number of each
+// check's results it wrote and of those it dropped as duplicates. The
+// notifications of partial runs are kept.
+func mergeSARIF(w io.Writer, names []string, reports [][]byte, sortBy string) (map[string]int, int, error) {
+	var out sarifLog
+	var run sarifRun
+	var partial *sarifInvocation
+	ruleIndex := make(map[string]int)
+	seen := make(map[string]bool)
+	dropped := 0
+	for i, data := range reports {
+		var in sarifLog
+		if err := json.Unmarshal(data, &in); err != nil {
+			return nil, 0, fmt.Errorf("%s isn't a sarif report: %s", names[i], err)
+		}
+		if in.Version == "" {
+			return nil, 0, fmt.Errorf("%s isn't a sarif report", names[i])
+		}
+		if i == 0 {
+			out.Schema, out.Version = in.Schema, in.Version
+		}
+		for _, r := range in.Runs {
+			if run.Tool.Driver.Name == "" {
+				run.Tool.Driver = r.Tool.Driver
+				run.Tool.Driver.Rules = []sarifRule{}
+			}
+			for _, rule := range r.Tool.Driver.Rules {
+				if _, ok := ruleIndex[rule.ID]; !ok {
+					ruleIndex[rule.ID] = len(run.Tool.Driver.Rules)
+					run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, rule)
+				}
+			}
+			for _, result := range r.Results {
+				if fp := result.PartialFingerprints[sarifFingerprintKey]; fp != "" {
+					if seen[fp] {
+						dropped++
+						continue
+					}
+					seen[fp] = true
+				}
+				result.RuleIndex = ruleIndex[result.RuleID]
+				run.Results = append(run.Results, result)
+			}
+			for _, inv := range r.Invocations {
+				if partial == nil {
+					partial = &sarifInvocation{ExecutionSuccessful: true}
+				}
+				partial.ToolExecutionNotifications = append(partial.ToolExecutionNotifications, inv.ToolExecutionNotifications...)
+			}
+		}
+	}
+	if run.Results == nil {
+		run.Results = []sarifResult{}
+	}
+	if sortBy == "position" {
+		sort.SliceStable(run.Results, func(i, j int) bool {
+			return positionLess(run.Results[i].position(), run.Results[j].position())
+		})
+	}
+	if partial != nil {
+		run.Invocations = []sarifInvocation{*partial}
+	}
+	out.Runs = []sarifRun{run}
+	counts := make(map[string]int)
+	for _, result := range run.Results {
+		counts[result.RuleID]++
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return counts, dropped, enc.Encode(out)
+}
+
+// position returns where f is.
+func (f jsonFinding) position() token.Position {
+	return token.Position{Filename: f.File, Line: f.Line, Column: f.Column}
+}
+
+// position returns where the first location of result is.
+func (result sarifResult) position() token.Position {
+	if len(result.Locations) == 0 {
+		return token.Position{}
+	}
+	loc := result.Locations[0].PhysicalLocation
+	return token.Position{Filename: loc.ArtifactLocation.URI, Line: loc.Region.StartLine, Column: loc.Region.StartColumn}
+}
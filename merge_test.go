@@ -0,0 +1,101 @@
+package copyfighter
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestMergeJSON(t *testing.T) {
+	r := testdataReport(t)
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+	var findings []jsonFinding
+	if err := json.Unmarshal(buf.Bytes(), &findings); err != nil {
+		t.Fatal(err)
+	}
+	// A shard with the same findings in the opposite order.
+	reversed := slices.Clone(findings)
+	slices.Reverse(reversed)
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.json"), filepath.Join(dir, "b.json")
+	if err := os.WriteFile(a, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(reversed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(b, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		args []string
+		want []jsonFinding
+	}{
+		{[]string{b, a}, reversed},
+		{[]string{"-sort", "position", b, a}, findings},
+	} {
+		out := filepath.Join(dir, "merged.json")
+		if err := mergeReports(append([]string{"-o", out}, test.args...)); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []jsonFinding
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("merge %v = %+v, want %+v", test.args, got, test.want)
+		}
+	}
+}
+
+func TestMergeSARIF(t *testing.T) {
+	r := testdataReport(t)
+	r.partial = []string{"example.com/broken"}
+	var buf bytes.Buffer
+	if err := writeSARIF(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.sarif")
+	if err := os.WriteFile(a, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "merged.sarif")
+	if err := mergeReports([]string{"-o", out, a, a}); err != nil {
+		t.Fatal(err)
+	}
+	var want, got sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &want); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Runs) != 1 || !reflect.DeepEqual(got.Runs[0].Results, want.Runs[0].Results) {
+		t.Errorf("merging a report with itself gave %+v, want its results once", got.Runs)
+	}
+	if notes := got.Runs[0].Invocations[0].ToolExecutionNotifications; len(notes) != 2 {
+		t.Errorf("got notifications %+v, want those of both reports", notes)
+	}
+
+	if err := mergeReports([]string{"-sort", "impact", a}); err == nil {
+		t.Errorf("merge -sort impact of sarif reports succeeded")
+	}
+}
@@ -0,0 +1,224 @@
+package copyfighter
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/modfile"
+)
+
+// goModule is a module in the tree the modules command analyzes.
+type goModule struct {
+	// dir is the absolute path of the module's root directory.
+	dir  string
+	path string
+}
+
+// moduleSites are the sites reported in one module.
+type moduleSites struct {
+	goModule
+	sites []copySite
+}
+
+// findModules returns the modules whose go.mod files are in root or below it,
+// sorted by directory. Like the go command's ./... pattern, it doesn't look
+// in vendor or testdata directories, or in those whose names start with "."
+// or "_". Directories and go.mod files it can't read are recorded in skips
+// and left out.
+func findModules(root string, skips *skipLog) ([]goModule, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	mods := []goModule{}
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root {
+				return err
+			}
+			skips.add(skipUnreadable, fmt.Sprintf("%s: %s", relPath(p), unwrapPathError(err)))
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if p != root && (name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if name != "go.mod" {
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			skips.add(skipUnreadable, fmt.Sprintf("%s: %s", relPath(p), unwrapPathError(err)))
+			return nil
+		}
+		path := modfile.ModulePath(data)
+		if path == "" {
+			return fmt.Errorf("%s has no module directive", relPath(p))
+		}
+		mods = append(mods, goModule{dir: filepath.Dir(p), path: path})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to find modules in %#v: %s", root, err)
+	}
+	if len(mods) == 0 {
+		return nil, fmt.Errorf("no go.mod files in %#v", root)
+	}
+	return mods, nil
+}
+
+// checkModules analyzes every package of each of mods as if the run had been
+// started in the module's root: its go.mod decides its dependencies, its own
+// ignore file which paths are ignored, and its own config file the exclusions,
+// the package weights, and the sizes values must exceed, unless the command
+// line gives them. The files of all the modules are added to fset, so that
+// their sites can be reported together too.
+func checkModules(mods []goModule, fset *token.FileSet, sizes types.Sizes, sh shard, filter siteFilter, skips *skipLog) ([]moduleSites, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	defer os.Chdir(wd)
+	// Skipped sites are named relative to where the run was started.
+	reportDir = wd
+	defer func() { reportDir = "" }()
+	out := []moduleSites{}
+	for _, mod := range mods {
+		if err := os.Chdir(mod.dir); err != nil {
+			return nil, err
+		}
+		cfg, err := readConfig(mod.dir)
+		if err != nil {
+			return nil, fmt.Errorf("module %s: %s", mod.path, err)
+		}
+		lim, err := cfg.limits()
+		if err != nil {
+			return nil, fmt.Errorf("module %s: %s", mod.path, err)
+		}
+		f := filter
+		f.excludePackages = append(append([]string{}, cfg.excludePackages...), *excludePatterns...)
+		f.excludeTypes = cfg.excludeTypes
+		f.weights = cfg.packageWeights
+		f.ignoreRoot = mod.dir
+		f.ignored, err = readIgnoreFile(ignoreFileName)
+		if err != nil {
+			return nil, fmt.Errorf("module %s: %s", mod.path, err)
+		}
+		sites, err := check([]string{"./..."}, fset, lim, sizes, sh, nil, skips)
+		if err != nil {
+			return nil, fmt.Errorf("module %s: %s", mod.path, err)
+		}
+		out = append(out, moduleSites{goModule: mod, sites: f.apply(sites, fset, skips)})
+	}
+	return out, nil
+}
+
+// moduleReportName returns the name of the file -module-reports writes the
+// report of mod to.
+func moduleReportName(mod goModule) string {
+	return strings.NewReplacer("/", "_", "\\", "_", ":", "_").Replace(mod.path) + "." + *format
+}
+
+// runModules runs the modules command: it analyzes each module in the
+// directory given on the command line, logs how many findings each has, and
+// writes the combined report of all of them. With -module-reports, each
+// module's report is also written to a file of its own. -baseline and
+// -write-baseline work on the findings of all the modules together. It exits
+// on any error, and with status 2 if there are findings.
+func runModules() {
+	if commandLine.NArg() != 1 {
+		log.Fatalf("usage: %s modules [flags] DIR", os.Args[0])
+	}
+	if *exportData || *wholeProgram || *archive != "" || *fix || *failFast {
+		log.Fatalf("modules can't be used with -export-data, -whole-program, -archive, -fix, or -fail-fast")
+	}
+	write, ok := formats[*format]
+	if !ok {
+		log.Fatalf("unknown format %#v, must be one of: %s", *format, strings.Join(formatNames(), ", "))
+	}
+	tiers, err := flagTiers()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *baselineUntil != "" {
+		if _, err := time.Parse(dateLayout, *baselineUntil); err != nil {
+			log.Fatalf("-baseline-until %#v isn't a day like 2025-09-01", *baselineUntil)
+		}
+	}
+	_, sizes := mustTarget()
+	sh, err := parseShard(*shardFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	filter := mustFilter(config{})
+	skips := newSkipLog()
+	mods, err := findModules(commandLine.Arg(0), skips)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Load each module with its own go.mod even if a go.work includes it.
+	os.Setenv("GOWORK", "off")
+	fset := token.NewFileSet()
+	results, err := checkModules(mods, fset, sizes, sh, filter, skips)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *writeBaselinePath != "" {
+		all := []copySite{}
+		for _, res := range results {
+			all = append(all, res.sites...)
+		}
+		writeSkipped(skips)
+		if err := writeBaselineFile(*writeBaselinePath, all, fset, *baselineUntil); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("recorded %s in %s", plural(len(all), "finding"), *writeBaselinePath)
+		return
+	}
+	if *baselinePath != "" {
+		b, err := readBaselineFile(*baselinePath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for i := range results {
+			results[i].sites = b.apply(results[i].sites, fset, skips)
+		}
+	}
+	writeSkipped(skips)
+
+	all := []copySite{}
+	for _, res := range results {
+		log.Printf("%s (%s): %s", relPath(res.dir), res.path, plural(len(res.sites), "finding"))
+		all = append(all, res.sites...)
+		if *moduleReports == "" {
+			continue
+		}
+		f, err := os.Create(filepath.Join(*moduleReports, moduleReportName(res.goModule)))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := write(f, newReport(res.sites, fset)); err != nil {
+			log.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := write(os.Stdout, newReport(all, fset)); err != nil {
+		log.Fatal(err)
+	}
+	exitIfFailing(tiers.failing(all))
+}
@@ -0,0 +1,69 @@
+package copyfighter
+
+import (
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckModules(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, src string) {
+		t.Helper()
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	const src = `package p
+
+type big struct{ a, b, c int64 }
+
+func F(b big) {}
+`
+	write("go.mod", "module example.com/root\n\ngo 1.22\n")
+	write("root.go", src)
+	write("tools/go.mod", "module example.com/tools\n\ngo 1.22\n")
+	write("tools/lint/lint.go", src)
+	write("tools/gen/gen.go", src)
+	write("tools/.copyfighterignore", "gen/\n")
+	write("tools/testdata/go.mod", "module example.com/fixture\n")
+	write(".git/go.mod", "module example.com/hidden\n")
+	t.Chdir(dir)
+
+	mods, err := findModules(".", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{}
+	for _, mod := range mods {
+		paths = append(paths, mod.path)
+	}
+	if len(paths) != 2 || paths[0] != "example.com/root" || paths[1] != "example.com/tools" {
+		t.Fatalf("found modules %v, want example.com/root and example.com/tools", paths)
+	}
+
+	fset := token.NewFileSet()
+	skips := newSkipLog()
+	results, err := checkModules(mods, fset, &types.StdSizes{WordSize: 8, MaxAlign: 8}, shard{}, siteFilter{optIn: map[string]bool{checkDuplicate: false}, minConf: likelyOptimized}, skips)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"root.go", "tools/lint/lint.go"} {
+		if n := len(results[i].sites); n != 1 {
+			t.Errorf("module %s has %d sites, want 1", results[i].path, n)
+			continue
+		}
+		if got := relPath(fset.Position(results[i].sites[0].pos).Filename); got != want {
+			t.Errorf("module %s has a site in %s, want %s", results[i].path, got, want)
+		}
+	}
+	if got := skips.entities[skipIgnoredPath]; len(got) != 1 {
+		t.Errorf("skipped %v as ignored, want the site in tools/gen/gen.go", got)
+	}
+}
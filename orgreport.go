@@ -0,0 +1,205 @@
+package copyfighter
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// noTeam is the team of services the teams file doesn't name.
+const noTeam = "(no team)"
+
+// orgTally counts the findings of a team, service, or wide type in an org
+// report.
+type orgTally struct {
+	findings int
+	// bytes is the sum of the sizes of the findings' largest flagged
+	// values.
+	bytes    int64
+	services map[string]bool
+}
+
+func (t *orgTally) add(f jsonFinding, service string) {
+	if t.services == nil {
+		t.services = make(map[string]bool)
+	}
+	t.findings++
+	t.bytes += f.Size
+	t.services[service] = true
+}
+
+// orgReport implements the org-report subcommand, which ranks the findings of
+// the json reports of many services, each named after its report's file, by
+// team, by service, and by wide type, and lists the wide types that cause
+// findings in more than one service.
+func orgReport(args []string) error {
+	fs := flag.NewFlagSet("org-report", flag.ContinueOnError)
+	teamsPath := fs.String("teams", "", "path to a file that gives the team of each service, one \"SERVICE TEAM\" per line")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: %s org-report [flags] REPORT.json...", os.Args[0])
+	}
+	teams := map[string]string{}
+	if *teamsPath != "" {
+		var err error
+		if teams, err = readTeamsFile(*teamsPath); err != nil {
+			return err
+		}
+	}
+	services := make(map[string][]jsonFinding)
+	for _, name := range fs.Args() {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("unable to read report: %s", err)
+		}
+		var findings []jsonFinding
+		if err := json.Unmarshal(data, &findings); err != nil {
+			return fmt.Errorf("%s isn't a json report: %s", name, err)
+		}
+		service := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+		services[service] = append(services[service], findings...)
+	}
+	return writeOrgReport(os.Stdout, services, teams)
+}
+
+// readTeamsFile reads the file at p, whose lines name a service and its team,
+// separated by spaces. Empty lines and those that start with "#" are left out.
+func readTeamsFile(p string) (map[string]string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open teams file: %s", err)
+	}
+	defer f.Close()
+	teams := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("teams file line %d: %#v isn't a service and a team", n, line)
+		}
+		teams[fields[0]] = fields[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read teams file: %s", err)
+	}
+	return teams, nil
+}
+
+// writeOrgReport writes the org report of the findings of services, whose
+// teams are in teams.
+func writeOrgReport(w io.Writer, services map[string][]jsonFinding, teams map[string]string) error {
+	byTeam := make(map[string]*orgTally)
+	byService := make(map[string]*orgTally)
+	byType := make(map[string]*orgTally)
+	tally := func(groups map[string]*orgTally, key string, f jsonFinding, service string) {
+		if groups[key] == nil {
+			groups[key] = &orgTally{}
+		}
+		groups[key].add(f, service)
+	}
+	total := 0
+	for service, findings := range services {
+		team, ok := teams[service]
+		if !ok {
+			team = noTeam
+		}
+		for _, f := range findings {
+			total++
+			tally(byTeam, team, f, service)
+			tally(byService, service, f, service)
+			if t := f.widestType(); t != "" {
+				tally(byType, t, f, service)
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "%s in %s of %s\n", plural(total, "finding"), plural(len(byService), "service"), plural(len(byTeam), "team"))
+	if err := writeOrgTable(w, "team", byTeam); err != nil {
+		return err
+	}
+	if err := writeOrgTable(w, "service", byService); err != nil {
+		return err
+	}
+	if err := writeOrgTable(w, "wide type", byType); err != nil {
+		return err
+	}
+	shared := make(map[string]*orgTally)
+	for t, tally := range byType {
+		if len(tally.services) > 1 {
+			shared[t] = tally
+		}
+	}
+	fmt.Fprintf(w, "\nwide types with findings in more than one service:\n")
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, t := range rankedOrgKeys(shared, true) {
+		names := []string{}
+		for s := range shared[t].services {
+			names = append(names, s)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(tw, "%s\t%s\n", t, strings.Join(names, ", "))
+	}
+	return tw.Flush()
+}
+
+// writeOrgTable writes the tallies of groups, those with the most findings
+// first, under the given heading.
+func writeOrgTable(w io.Writer, heading string, groups map[string]*orgTally) error {
+	fmt.Fprintf(w, "\nby %s:\n", heading)
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "findings\tbytes\tservices\t  %s\n", heading)
+	for _, k := range rankedOrgKeys(groups, false) {
+		g := groups[k]
+		fmt.Fprintf(tw, "%d\t%d\t%d\t  %s\n", g.findings, g.bytes, len(g.services), k)
+	}
+	return tw.Flush()
+}
+
+// rankedOrgKeys returns the keys of groups, those with the most services
+// first if byServices is true, then those with the most findings, then those
+// with the most bytes, then in the order of the keys.
+func rankedOrgKeys(groups map[string]*orgTally, byServices bool) []string {
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := groups[keys[i]], groups[keys[j]]
+		if byServices && len(a.services) != len(b.services) {
+			return len(a.services) > len(b.services)
+		}
+		if a.findings != b.findings {
+			return a.findings > b.findings
+		}
+		if a.bytes != b.bytes {
+			return a.bytes > b.bytes
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// widestType returns the type of the largest value f flags, or of the type
+// declaration it's about if it flags none.
+func (f jsonFinding) widestType() string {
+	t, size := f.Decl, int64(-1)
+	for _, v := range f.Values {
+		if v.Size > size {
+			t, size = v.Type, v.Size
+		}
+	}
+	return t
+}
@@ -0,0 +1,82 @@
+package copyfighter
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteOrgReport(t *testing.T) {
+	config := []jsonValue{{Role: "parameter", Type: "example.com/shared.Config", Size: 96}}
+	services := map[string][]jsonFinding{
+		"payments": {
+			{Check: checkSignature, Size: 96, Values: config},
+			{Check: checkRange, Size: 40, Values: []jsonValue{{Type: "example.com/payments.Row", Size: 40}}},
+		},
+		"search": {
+			{Check: checkSignature, Size: 96, Values: config},
+			{Check: checkField, Size: 24, Decl: "example.com/search.Hit", Values: []jsonValue{{Type: "example.com/search.Score", Size: 24}}},
+		},
+		"ledger": {
+			{Check: checkDuplicate, Size: 64, Decl: "example.com/ledger.Entry"},
+		},
+	}
+	dir := t.TempDir()
+	for name, findings := range services {
+		data, err := json.Marshal(findings)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name+".json"), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	teams := filepath.Join(dir, "teams")
+	if err := os.WriteFile(teams, []byte("# service team\npayments money\nledger money\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	err = orgReport([]string{"-teams", teams, filepath.Join(dir, "payments.json"), filepath.Join(dir, "search.json"), filepath.Join(dir, "ledger.json")})
+	os.Stdout = stdout
+	w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(r); err != nil {
+		t.Fatal(err)
+	}
+	want := `5 findings in 3 services of 2 teams
+
+by team:
+  findings  bytes  services  team
+         3    200         2  money
+         2    120         1  (no team)
+
+by service:
+  findings  bytes  services  service
+         2    136         1  payments
+         2    120         1  search
+         1     64         1  ledger
+
+by wide type:
+  findings  bytes  services  wide type
+         2    192         2  example.com/shared.Config
+         1     64         1  example.com/ledger.Entry
+         1     40         1  example.com/payments.Row
+         1     24         1  example.com/search.Score
+
+wide types with findings in more than one service:
+example.com/shared.Config  payments, search
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
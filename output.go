@@ -0,0 +1,576 @@
+package copyfighter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// report is everything an output format needs to describe a run. Its sites
+// are already sorted by position.
+type report struct {
+	sites  []copySite
+	fset   *token.FileSet
+	labels siteLabels
+	runID  string
+	// partial are the packages with type errors that -lenient analyzed in
+	// part, with their first error.
+	partial []string
+	// tiers classify the sites as notes, warnings, and errors.
+	tiers severityTiers
+	// patterns are the package patterns of a run whose sites can be fixed
+	// in its working directory, whose fixes rdjson suggests.
+	patterns []string
+}
+
+// formats maps each -format name to the func that writes a report in it.
+var formats = map[string]func(w io.Writer, r *report) error{
+	"text":        writeText,
+	"gerrit":      writeGerrit,
+	"bitbucket":   writeBitbucket,
+	"azure":       writeAzure,
+	"github":      writeGitHub,
+	"warnings-ng": writeWarningsNG,
+	"arcanist":    writeArcanist,
+	"quickfix":    writeQuickfix,
+	"json":        writeJSON,
+	"sarif":       writeSARIF,
+	"rdjson":      writeRDJSON,
+	"checkstyle":  writeCheckstyle,
+	"junit":       writeJUnit,
+	"codeclimate": writeCodeClimate,
+}
+
+func formatNames() []string {
+	names := []string{}
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeText writes one line per site, which says the site's severity after
+// its position if -warn-at or -error-at sets tiers.
+func writeText(w io.Writer, r *report) error {
+	if !r.tiers.set() {
+		printSites(r.sites, r.fset, w, r.labels)
+		return nil
+	}
+	for _, site := range r.sites {
+		position := r.fset.Position(site.pos)
+		if _, err := fmt.Fprintf(w, "%s:%d:%d: %s: %s\n", relPath(position.Filename), position.Line, position.Column, r.tiers.of(site), site.message(r.labels)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reportDir, if set, is the directory reported file names are relative to
+// instead of the working directory.
+var reportDir string
+
+// relPath returns filename relative to the working directory, with forward
+// slashes, which is how code review systems name files in a change. If that
+// isn't possible, filename is returned unchanged.
+func relPath(filename string) string {
+	wd := reportDir
+	if wd == "" {
+		var err error
+		wd, err = os.Getwd()
+		if err != nil {
+			return filepath.ToSlash(filename)
+		}
+	}
+	return relPathTo(wd, filename)
+}
+
+// relPathTo is like relPath, but returns filename relative to dir.
+func relPathTo(dir, filename string) string {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return filepath.ToSlash(filename)
+	}
+	rel, err := filepath.Rel(dir, abs)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(filename)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// absPath returns filename as an absolute path, or unchanged if that isn't
+// possible.
+func absPath(filename string) string {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return filename
+	}
+	return abs
+}
+
+// readChangedFiles returns the absolute paths of the files listed, one per
+// line, in listPath. Blank lines are ignored. Listed paths are relative to the
+// working directory.
+func readChangedFiles(listPath string) (map[string]bool, error) {
+	f, err := os.Open(listPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open changed files list: %s", err)
+	}
+	defer f.Close()
+	changed := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		changed[absPath(line)] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read changed files list: %s", err)
+	}
+	return changed, nil
+}
+
+// gerritRobotComment is a RobotCommentInput entity from the Gerrit REST API.
+type gerritRobotComment struct {
+	RobotID    string `json:"robot_id"`
+	RobotRunID string `json:"robot_run_id"`
+	Line       int    `json:"line"`
+	Message    string `json:"message"`
+	URL        string `json:"url"`
+}
+
+// writeGerrit writes the sites as the robot_comments of a Gerrit ReviewInput,
+// ready to be posted to the set-review endpoint of a revision.
+func writeGerrit(w io.Writer, r *report) error {
+	comments := make(map[string][]gerritRobotComment)
+	for _, site := range r.sites {
+		position := r.fset.Position(site.pos)
+		path := relPath(position.Filename)
+		comments[path] = append(comments[path], gerritRobotComment{
+			RobotID:    "copyfighter",
+			RobotRunID: r.runID,
+			Line:       position.Line,
+			Message:    site.message(r.labels),
+			URL:        docsURL,
+		})
+	}
+	review := struct {
+		RobotComments map[string][]gerritRobotComment `json:"robot_comments"`
+	}{comments}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(review)
+}
+
+// bitbucketReport is a Bitbucket Cloud Code Insights report.
+type bitbucketReport struct {
+	Title      string `json:"title"`
+	Details    string `json:"details"`
+	ReportType string `json:"report_type"`
+	Reporter   string `json:"reporter"`
+	Result     string `json:"result"`
+}
+
+// bitbucketAnnotation is a Bitbucket Cloud Code Insights annotation.
+type bitbucketAnnotation struct {
+	ExternalID     string `json:"external_id"`
+	AnnotationType string `json:"annotation_type"`
+	Summary        string `json:"summary"`
+	Severity       string `json:"severity"`
+	Path           string `json:"path"`
+	Line           int    `json:"line"`
+	Details        string `json:"details"`
+	Link           string `json:"link"`
+}
+
+// externalID identifies the site within its file for systems that need an ID
+// per finding. Signature sites are named by their func so the ID survives
+// unrelated edits; sites in func bodies also need their position, and so do
+// those in package-level declarations, which have neither a func nor a type.
+func (site copySite) externalID(path string, position token.Position) string {
+	if site.fun == nil && site.decl != nil {
+		return fmt.Sprintf("%s:%s", path, site.decl.Name())
+	}
+	if site.fun == nil {
+		pkg := ""
+		if site.pkg != nil {
+			pkg = site.pkg.Path()
+		}
+		return fmt.Sprintf("%s:%s:%d:%d", path, pkg, position.Line, position.Column)
+	}
+	if site.what == "" {
+		return fmt.Sprintf("%s:%s", path, site.fun.FullName())
+	}
+	return fmt.Sprintf("%s:%s:%d:%d", path, site.fun.FullName(), position.Line, position.Column)
+}
+
+// bitbucketSeverities map the severities of sites to those of annotations.
+var bitbucketSeverities = map[Severity]string{
+	SeverityNote:    "LOW",
+	SeverityWarning: "MEDIUM",
+	SeverityError:   "HIGH",
+}
+
+// writeBitbucket writes a Code Insights report and its annotations as a single
+// JSON object. The "report" member is the body to PUT to the commit's report
+// endpoint and "annotations" the body to POST to its annotations endpoint.
+func writeBitbucket(w io.Writer, r *report) error {
+	result := "PASSED"
+	if len(r.sites) > 0 {
+		result = "FAILED"
+	}
+	annotations := []bitbucketAnnotation{}
+	for _, site := range r.sites {
+		position := r.fset.Position(site.pos)
+		path := relPath(position.Filename)
+		annotations = append(annotations, bitbucketAnnotation{
+			ExternalID:     site.externalID(path, position),
+			AnnotationType: "CODE_SMELL",
+			Summary:        site.message(r.labels),
+			Severity:       bitbucketSeverities[r.tiers.of(site)],
+			Path:           path,
+			Line:           position.Line,
+			Details:        checks[site.check].rationale,
+			Link:           docsURL,
+		})
+	}
+	out := struct {
+		Report      bitbucketReport       `json:"report"`
+		Annotations []bitbucketAnnotation `json:"annotations"`
+	}{
+		Report: bitbucketReport{
+			Title:      "copyfighter",
+			Details:    fmt.Sprintf("%d functions pass large structs by value.", len(r.sites)),
+			ReportType: "BUG",
+			Reporter:   "copyfighter",
+			Result:     result,
+		},
+		Annotations: annotations,
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+var (
+	azureMessageEscaper  = strings.NewReplacer("%", "%AZP25", "\r", "%0D", "\n", "%0A")
+	azurePropertyEscaper = strings.NewReplacer("%", "%AZP25", "\r", "%0D", "\n", "%0A", "]", "%5D", ";", "%3B")
+)
+
+// writeAzure writes each site as an Azure Pipelines task.logissue logging
+// command, which the agent turns into a build warning, or a build error for
+// the sites that are errors.
+func writeAzure(w io.Writer, r *report) error {
+	for _, site := range r.sites {
+		position := r.fset.Position(site.pos)
+		issueType := "warning"
+		if r.tiers.of(site) == SeverityError {
+			issueType = "error"
+		}
+		_, err := fmt.Fprintf(w, "##vso[task.logissue type=%s;sourcepath=%s;linenumber=%d;columnnumber=%d;code=copyfighter]%s\n",
+			issueType,
+			azurePropertyEscaper.Replace(relPath(position.Filename)),
+			position.Line,
+			position.Column,
+			azureMessageEscaper.Replace(site.message(r.labels)))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	githubMessageEscaper  = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	githubPropertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+)
+
+// githubCommands map the severities of sites to the GitHub Actions workflow
+// commands that annotate them.
+var githubCommands = map[Severity]string{
+	SeverityNote:    "notice",
+	SeverityWarning: "warning",
+	SeverityError:   "error",
+}
+
+// writeGitHub writes each site as a GitHub Actions workflow command, like
+// "::warning file=a.go,line=3,col=6,title=signature::...", which the runner
+// turns into an annotation shown inline on the pull request's diff.
+func writeGitHub(w io.Writer, r *report) error {
+	for _, site := range r.sites {
+		position := r.fset.Position(site.pos)
+		_, err := fmt.Fprintf(w, "::%s file=%s,line=%d,col=%d,title=%s::%s\n",
+			githubCommands[r.tiers.of(site)],
+			githubPropertyEscaper.Replace(relPath(position.Filename)),
+			position.Line,
+			position.Column,
+			githubPropertyEscaper.Replace("copyfighter "+site.check),
+			githubMessageEscaper.Replace(site.message(r.labels)))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// warningsNGIssue is an issue in the Jenkins Warnings Next Generation plugin's
+// native JSON format.
+type warningsNGIssue struct {
+	FileName    string `json:"fileName"`
+	LineStart   int    `json:"lineStart"`
+	ColumnStart int    `json:"columnStart"`
+	Severity    string `json:"severity"`
+	Message     string `json:"message"`
+	Category    string `json:"category"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	Origin      string `json:"origin"`
+}
+
+// warningsNGSeverities map the severities of sites to those of issues.
+var warningsNGSeverities = map[Severity]string{
+	SeverityNote:    "LOW",
+	SeverityWarning: "NORMAL",
+	SeverityError:   "HIGH",
+}
+
+// writeWarningsNG writes the sites in the Warnings NG native JSON format, which
+// the plugin reads with its "Native Analysis Model Format" parser.
+func writeWarningsNG(w io.Writer, r *report) error {
+	issues := []warningsNGIssue{}
+	for _, site := range r.sites {
+		position := r.fset.Position(site.pos)
+		issues = append(issues, warningsNGIssue{
+			FileName:    relPath(position.Filename),
+			LineStart:   position.Line,
+			ColumnStart: position.Column,
+			Severity:    warningsNGSeverities[r.tiers.of(site)],
+			Message:     site.message(r.labels),
+			Category:    "by-value",
+			Type:        site.check,
+			Description: checks[site.check].rationale,
+			Origin:      "copyfighter",
+		})
+	}
+	out := struct {
+		Issues []warningsNGIssue `json:"issues"`
+		Size   int               `json:"size"`
+	}{issues, len(issues)}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// arcanistMessage is the dictionary form of an ArcanistLintMessage, as read by
+// ArcanistLintMessage::newFromDictionary.
+type arcanistMessage struct {
+	Path        string `json:"path"`
+	Line        int    `json:"line"`
+	Char        int    `json:"char"`
+	Code        string `json:"code"`
+	Severity    string `json:"severity"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// arcanistSeverities map the severities of sites to those of lint messages.
+var arcanistSeverities = map[Severity]string{
+	SeverityNote:    "advice",
+	SeverityWarning: "warning",
+	SeverityError:   "error",
+}
+
+// writeArcanist writes the sites as a JSON array of Arcanist lint messages for
+// an external linter wired into arc lint.
+func writeArcanist(w io.Writer, r *report) error {
+	msgs := []arcanistMessage{}
+	for _, site := range r.sites {
+		position := r.fset.Position(site.pos)
+		msgs = append(msgs, arcanistMessage{
+			Path:        relPath(position.Filename),
+			Line:        position.Line,
+			Char:        position.Column,
+			Code:        "COPYFIGHTER",
+			Severity:    arcanistSeverities[r.tiers.of(site)],
+			Name:        checks[site.check].name,
+			Description: site.message(r.labels),
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(msgs)
+}
+
+// writeQuickfix writes one file:line:column: severity: line per site, like
+// "main.go:3:6: warning:", which vim's default errorformat and emacs's
+// compilation-mode both parse, so that
+// :cfile and M-x compile can step through the findings. After the check ID,
+// each line names the site's widest type and its size.
+func writeQuickfix(w io.Writer, r *report) error {
+	for _, site := range r.sites {
+		position := r.fset.Position(site.pos)
+		_, err := fmt.Fprintf(w, "%s:%d:%d: %s: %s\n",
+			relPath(position.Filename), position.Line, position.Column, r.tiers.of(site), site.labeledMessage(r.labels))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// labeledMessage returns the message of site after its check ID and its
+// widest type and size, like "[signature] 'Config' (48 bytes): ...", for
+// formats that have no fields of their own for them.
+func (site copySite) labeledMessage(labels siteLabels) string {
+	wide := ""
+	if t, pkg := site.widestType(); t != nil {
+		wide = fmt.Sprintf(" '%s' (%d bytes):", typeString(t, pkg), site.size)
+	}
+	return fmt.Sprintf("[%s]%s %s", site.check, wide, site.message(labels))
+}
+
+// sitesByFile returns the names of the files of the report's sites, relative
+// to the working directory, in the order of their first sites, and the sites
+// in each.
+func (r *report) sitesByFile() ([]string, map[string][]copySite) {
+	names := []string{}
+	sites := make(map[string][]copySite)
+	for _, site := range r.sites {
+		name := relPath(r.fset.Position(site.pos).Filename)
+		if _, ok := sites[name]; !ok {
+			names = append(names, name)
+		}
+		sites[name] = append(sites[name], site)
+	}
+	return names, sites
+}
+
+// widestType returns the type of the site's largest flagged value, or the
+// type it's about if it has no values, along with the package to write it as
+// seen from. It returns nil if the site has neither.
+func (site copySite) widestType() (types.Type, *types.Package) {
+	pkg := sitePkg(site)
+	var widest *copiedValue
+	for i, v := range site.values {
+		if widest == nil || v.size > widest.size {
+			widest = &site.values[i]
+		}
+	}
+	switch {
+	case widest != nil:
+		return widest.typ, pkg
+	case site.decl != nil:
+		return site.decl.Type(), pkg
+	}
+	return nil, nil
+}
+
+// jsonFinding is a site as written by the json format. Types and funcs are
+// qualified by their full import paths.
+type jsonFinding struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Check  string `json:"check"`
+	// Function is the func with the by-value signature or whose body holds
+	// the copy, like "(*example.com/pkg.T).M".
+	Function string `json:"function,omitempty"`
+	// Decl is the type declaration the site is about, if it isn't about a
+	// func.
+	Decl string `json:"decl,omitempty"`
+	// Calls is the number of static call sites of a by-value signature's
+	// func in the analyzed packages.
+	Calls int `json:"calls,omitempty"`
+	// Cost is the number of bytes the site copies per run of the program,
+	// with -sort cost.
+	Cost int64 `json:"cost,omitempty"`
+	// Size is the size in bytes of the largest flagged value.
+	Size   int64       `json:"size"`
+	Values []jsonValue `json:"values"`
+	// Confidence is how sure the finding is that the copy is made, as
+	// -min-confidence takes it.
+	Confidence string `json:"confidence"`
+	// Severity is "note", "warning", or "error", as -warn-at and -error-at
+	// classify the finding by Size.
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	// Fingerprint tells the finding apart from the others like the
+	// codeclimate format's, so merge can drop those found twice.
+	Fingerprint string `json:"fingerprint"`
+}
+
+// jsonValue is a flagged value of a jsonFinding.
+type jsonValue struct {
+	// Role is "receiver", "parameter", or "result" for by-value signatures.
+	Role string `json:"role,omitempty"`
+	// Index is the position of a parameter or result in its list.
+	Index *int   `json:"index,omitempty"`
+	Type  string `json:"type"`
+	Size  int64  `json:"size"`
+	// Line and Column are where a by-value signature's value is declared,
+	// and EndLine and EndColumn where its declaration, like "p Config",
+	// ends.
+	Line      int `json:"line,omitempty"`
+	Column    int `json:"column,omitempty"`
+	EndLine   int `json:"endLine,omitempty"`
+	EndColumn int `json:"endColumn,omitempty"`
+}
+
+// writeJSON writes the sites as a JSON array of records whose fields, unlike
+// the text format's sentences, can be read by other programs.
+func writeJSON(w io.Writer, r *report) error {
+	findings := []jsonFinding{}
+	seen := make(map[string]int)
+	for _, site := range r.sites {
+		position := r.fset.Position(site.pos)
+		f := jsonFinding{
+			File:        relPath(position.Filename),
+			Line:        position.Line,
+			Column:      position.Column,
+			Check:       site.check,
+			Calls:       site.calls,
+			Cost:        site.cost,
+			Size:        site.size,
+			Values:      []jsonValue{},
+			Confidence:  confidenceNames[site.confidence],
+			Severity:    string(r.tiers.of(site)),
+			Message:     site.message(r.labels),
+			Fingerprint: site.fingerprint(seen),
+		}
+		if site.fun != nil {
+			f.Function = site.fun.FullName()
+		}
+		if site.decl != nil {
+			f.Decl = types.TypeString(site.decl.Type(), nil)
+		}
+		for _, v := range site.values {
+			jv := jsonValue{Role: v.role, Type: types.TypeString(v.typ, nil), Size: v.size}
+			if v.role == "parameter" || v.role == "result" {
+				index := v.index
+				jv.Index = &index
+			}
+			if v.pos.IsValid() {
+				start := r.fset.Position(v.pos)
+				jv.Line, jv.Column = start.Line, start.Column
+			}
+			if v.end.IsValid() {
+				end := r.fset.Position(v.end)
+				jv.EndLine, jv.EndColumn = end.Line, end.Column
+			}
+			f.Values = append(f.Values, jv)
+		}
+		findings = append(findings, f)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(findings)
+}
@@ -0,0 +1,406 @@
+package copyfighter
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testdataReport returns the report of a run on testdata, which has a site for
+// CallsFoo's parameter on line 24 of inner.go.
+func testdataReport(t *testing.T) *report {
+	t.Helper()
+	fset := token.NewFileSet()
+	sites, err := check([]string{"./testdata"}, fset, limits{max: 16}, &types.StdSizes{WordSize: 8, MaxAlign: 8}, shard{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &report{sites: sites, fset: fset, runID: "run-1"}
+}
+
+const callsFooMessage = "parameter 'f' at index 0 should be made into a pointer"
+
+func TestWriteGerrit(t *testing.T) {
+	r := testdataReport(t)
+	var buf bytes.Buffer
+	if err := writeGerrit(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		RobotComments map[string][]gerritRobotComment `json:"robot_comments"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	comments := out.RobotComments["testdata/inner.go"]
+	if len(out.RobotComments) != 1 || len(comments) != len(r.sites) {
+		t.Fatalf("got comments %+v, want one for each of the %d sites in testdata/inner.go", out.RobotComments, len(r.sites))
+	}
+	found := false
+	for _, c := range comments {
+		if c.RobotID != "copyfighter" || c.RobotRunID != "run-1" {
+			t.Errorf("comment %+v isn't copyfighter's of run-1", c)
+		}
+		found = found || c.Line == 24 && strings.HasPrefix(c.Message, callsFooMessage)
+	}
+	if !found {
+		t.Errorf("no comment on CallsFoo in %+v", comments)
+	}
+}
+
+func TestWriteBitbucket(t *testing.T) {
+	// read returns the report and the annotations written for r.
+	read := func(r *report) (bitbucketReport, []bitbucketAnnotation) {
+		t.Helper()
+		var buf bytes.Buffer
+		if err := writeBitbucket(&buf, r); err != nil {
+			t.Fatal(err)
+		}
+		var out struct {
+			Report      bitbucketReport       `json:"report"`
+			Annotations []bitbucketAnnotation `json:"annotations"`
+		}
+		if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+			t.Fatal(err)
+		}
+		return out.Report, out.Annotations
+	}
+	r := testdataReport(t)
+	report, annotations := read(r)
+	if report.Result != "FAILED" || report.Reporter != "copyfighter" || len(annotations) != len(r.sites) {
+		t.Fatalf("got %+v with %d annotations, want a failed report with %d", report, len(annotations), len(r.sites))
+	}
+	ids := make(map[string]bool)
+	found := false
+	for _, a := range annotations {
+		if ids[a.ExternalID] {
+			t.Errorf("two annotations have the external ID %s", a.ExternalID)
+		}
+		ids[a.ExternalID] = true
+		if a.Path != "testdata/inner.go" || a.Severity != "MEDIUM" {
+			t.Errorf("unexpected annotation %+v", a)
+		}
+		found = found || a.Line == 24 && strings.HasSuffix(a.ExternalID, "CallsFoo") && strings.HasPrefix(a.Summary, callsFooMessage)
+	}
+	if !found {
+		t.Errorf("no annotation of CallsFoo in %+v", annotations)
+	}
+	r.sites = nil
+	if report, annotations := read(r); report.Result != "PASSED" || len(annotations) != 0 {
+		t.Errorf("got %+v with %d annotations, want a passed report with none", report, len(annotations))
+	}
+}
+
+func TestBitbucketPackageLevelIDs(t *testing.T) {
+	sites, fset := checkModule(t, map[string]string{
+		"a.go": `package a
+
+type Big struct{ a, b, c int64 }
+
+var C chan Big
+
+var S []Big
+
+func F(b Big) {}
+`,
+	})
+	var buf bytes.Buffer
+	if err := writeBitbucket(&buf, &report{sites: sites, fset: fset}); err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		Annotations []bitbucketAnnotation `json:"annotations"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"a.go:example.com/m:5:7": checks[checkChan].rationale,
+		"a.go:example.com/m:7:7": checks[checkContainer].rationale,
+		"a.go:example.com/m.F":   checks[checkSignature].rationale,
+	}
+	if len(out.Annotations) != len(want) {
+		t.Fatalf("got %+v, want %d annotations", out.Annotations, len(want))
+	}
+	for _, a := range out.Annotations {
+		if details, ok := want[a.ExternalID]; !ok || a.Details != details || a.Path != "a.go" {
+			t.Errorf("unexpected annotation %+v", a)
+		}
+	}
+}
+
+func TestWriteAzure(t *testing.T) {
+	r := testdataReport(t)
+	var buf bytes.Buffer
+	if err := writeAzure(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != len(r.sites) {
+		t.Fatalf("got %d logging commands, want one for each of the %d sites", len(lines), len(r.sites))
+	}
+	want := "##vso[task.logissue type=warning;sourcepath=testdata/inner.go;linenumber=24;columnnumber=6;code=copyfighter]" + callsFooMessage
+	found := false
+	for _, line := range lines {
+		found = found || strings.HasPrefix(line, want)
+	}
+	if !found {
+		t.Errorf("no logging command starting %q in:\n%s", want, buf.String())
+	}
+	if got := azurePropertyEscaper.Replace("a;b]c%\n"); got != "a%3Bb%5Dc%AZP25%0A" {
+		t.Errorf("escaped property = %q", got)
+	}
+}
+
+func TestWriteWarningsNG(t *testing.T) {
+	r := testdataReport(t)
+	var buf bytes.Buffer
+	if err := writeWarningsNG(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		Issues []warningsNGIssue `json:"issues"`
+		Size   int               `json:"size"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Size != len(r.sites) || len(out.Issues) != len(r.sites) {
+		t.Fatalf("got %d issues of size %d, want one for each of the %d sites", len(out.Issues), out.Size, len(r.sites))
+	}
+	found := false
+	for _, issue := range out.Issues {
+		if issue.FileName != "testdata/inner.go" || issue.Severity != "NORMAL" || issue.Category != "by-value" || issue.Origin != "copyfighter" {
+			t.Errorf("unexpected issue %+v", issue)
+		}
+		found = found || issue.LineStart == 24 && issue.ColumnStart == 6 && strings.HasPrefix(issue.Message, callsFooMessage)
+	}
+	if !found {
+		t.Errorf("no issue of CallsFoo in %+v", out.Issues)
+	}
+}
+
+func TestWriteArcanist(t *testing.T) {
+	r := testdataReport(t)
+	var buf bytes.Buffer
+	if err := writeArcanist(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+	var msgs []arcanistMessage
+	if err := json.Unmarshal(buf.Bytes(), &msgs); err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != len(r.sites) {
+		t.Fatalf("got %d lint messages, want one for each of the %d sites", len(msgs), len(r.sites))
+	}
+	found := false
+	for _, m := range msgs {
+		if m.Path != "testdata/inner.go" || m.Code != "COPYFIGHTER" || m.Severity != "warning" || m.Name == "" {
+			t.Errorf("unexpected lint message %+v", m)
+		}
+		found = found || m.Line == 24 && m.Char == 6 && strings.HasPrefix(m.Description, callsFooMessage)
+	}
+	if !found {
+		t.Errorf("no lint message of CallsFoo in %+v", msgs)
+	}
+}
+
+func TestWriteQuickfix(t *testing.T) {
+	r := testdataReport(t)
+	var buf bytes.Buffer
+	if err := writeQuickfix(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != len(r.sites) {
+		t.Fatalf("got %d lines, want one for each of the %d sites", len(lines), len(r.sites))
+	}
+	want := "testdata/inner.go:24:6: warning: [signature] 'Foo' (48 bytes): " + callsFooMessage
+	found := false
+	for _, line := range lines {
+		found = found || strings.HasPrefix(line, want)
+	}
+	if !found {
+		t.Errorf("no line starting %q in:\n%s", want, buf.String())
+	}
+}
+
+// testReport returns a report of a warning and an error of the duplicate
+// check, on lines 1 and 2 of a.go.
+func testReport() *report {
+	fset := token.NewFileSet()
+	f := fset.AddFile("a.go", -1, 100)
+	f.SetLines([]int{0, 50})
+	return &report{
+		sites: []copySite{{pos: f.Pos(0), check: checkDuplicate, size: 24}, {pos: f.Pos(50), check: checkDuplicate, size: 72}},
+		fset:  fset,
+		tiers: severityTiers{errorAt: 64},
+	}
+}
+
+func TestWriteGitHub(t *testing.T) {
+	r := testReport()
+	var buf bytes.Buffer
+	if err := writeGitHub(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+	want := "::warning file=a.go,line=1,col=1,title=copyfighter duplicate::" + githubMessageEscaper.Replace(r.sites[0].message(siteLabels{})) + "\n" +
+		"::error file=a.go,line=2,col=1,title=copyfighter duplicate::" + githubMessageEscaper.Replace(r.sites[1].message(siteLabels{})) + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if got := githubPropertyEscaper.Replace("a,b:c%"); got != "a%2Cb%3Ac%25" {
+		t.Errorf("escaped property = %q", got)
+	}
+}
+
+func TestWriteRDJSON(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.22\n",
+		"a.go": `package a
+
+type wide struct{ a, b, c int64 }
+
+func use(w wide) int64 { return w.a }
+
+func caller() int64 { return use(wide{}) }
+
+func Exported(w wide) {}
+`,
+		"b.go": "package a\n\nfunc other() { Exported(wide{}) }\n",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+	fset := token.NewFileSet()
+	sites, err := check([]string{"."}, fset, limits{max: 16}, &types.StdSizes{WordSize: 8, MaxAlign: 8}, shard{}, nil, newSkipLog())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := writeRDJSON(&buf, &report{sites: sites, fset: fset, patterns: []string{"./..."}}); err != nil {
+		t.Fatal(err)
+	}
+	var out rdjsonResult
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Diagnostics) != 2 {
+		t.Fatalf("got %d diagnostics, want those of use and Exported", len(out.Diagnostics))
+	}
+	// use is fixed within a.go, while Exported is part of the package's API.
+	use, exported := out.Diagnostics[0], out.Diagnostics[1]
+	want := []rdjsonSuggestion{
+		{Range: rdjsonRange{Start: rdjsonPosition{5, 12}, End: &rdjsonPosition{5, 12}}, Text: "*"},
+		{Range: rdjsonRange{Start: rdjsonPosition{7, 34}, End: &rdjsonPosition{7, 34}}, Text: "&"},
+	}
+	if !reflect.DeepEqual(use.Suggestions, want) {
+		t.Errorf("suggestions of use = %+v, want %+v", use.Suggestions, want)
+	}
+	if use.Location.Path != "a.go" || use.Severity != "WARNING" || use.Code.Value != checkSignature {
+		t.Errorf("diagnostic of use = %+v", use)
+	}
+	if len(exported.Suggestions) != 0 {
+		t.Errorf("Exported has suggestions %+v, want none since it's exported", exported.Suggestions)
+	}
+}
+
+func TestWriteCheckstyle(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeCheckstyle(&buf, testReport()); err != nil {
+		t.Fatal(err)
+	}
+	var out checkstyleReport
+	if err := xml.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Files) != 1 || out.Files[0].Name != "a.go" || len(out.Files[0].Errors) != 2 {
+		t.Fatalf("got %+v, want a.go with both sites", out.Files)
+	}
+	errs := out.Files[0].Errors
+	if errs[0].Severity != "warning" || errs[1].Severity != "error" || errs[1].Line != 2 || errs[1].Source != "copyfighter."+checkDuplicate {
+		t.Errorf("got errors %+v", errs)
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeJUnit(&buf, testReport()); err != nil {
+		t.Fatal(err)
+	}
+	var out junitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Tests != 2 || out.Failures != 2 || len(out.Suites) != 1 || out.Suites[0].Name != "a.go" || len(out.Suites[0].Cases) != 2 {
+		t.Fatalf("got %+v, want a suite for a.go with both sites", out)
+	}
+	c := out.Suites[0].Cases[1]
+	if c.Name != "duplicate a.go:2:1" || c.Failure.Type != checkDuplicate {
+		t.Errorf("got case %+v", c)
+	}
+}
+
+func TestWriteCodeClimate(t *testing.T) {
+	dir := t.TempDir()
+	src := `package a
+
+type wide struct{ a, b, c int64 }
+
+func F(w wide) {}
+
+func G(w wide) {}
+`
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/m\n\ngo 1.22\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+	// run returns the issues of a.go with src.
+	run := func(src string) []codeClimateIssue {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, "a.go"), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		fset := token.NewFileSet()
+		sites, err := check([]string{"."}, fset, limits{max: 16}, &types.StdSizes{WordSize: 8, MaxAlign: 8}, shard{}, nil, newSkipLog())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := writeCodeClimate(&buf, &report{sites: sites, fset: fset}); err != nil {
+			t.Fatal(err)
+		}
+		var issues []codeClimateIssue
+		if err := json.Unmarshal(buf.Bytes(), &issues); err != nil {
+			t.Fatal(err)
+		}
+		if len(issues) != 2 {
+			t.Fatalf("got %d issues, want those of F and G", len(issues))
+		}
+		return issues
+	}
+	before := run(src)
+	if before[0].Fingerprint == before[1].Fingerprint {
+		t.Errorf("F and G have the same fingerprint %s", before[0].Fingerprint)
+	}
+	if got := before[0]; got.CheckName != checkSignature || got.Severity != "minor" || got.Location.Path != "a.go" || got.Location.Lines.Begin != 5 {
+		t.Errorf("issue of F = %+v", got)
+	}
+	after := run("// Package a copies.\n\n" + src)
+	for i := range before {
+		if after[i].Location.Lines.Begin != before[i].Location.Lines.Begin+2 || after[i].Fingerprint != before[i].Fingerprint {
+			t.Errorf("after moving two lines down, issue %d = %+v, want the fingerprint of %+v", i, after[i], before[i])
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package copyfighter
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"os"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+// hotFuncs maps the names of the funcs in a CPU profile, as the profile names
+// them, to the percentage of the profile's samples whose stacks they are on.
+type hotFuncs map[string]float64
+
+// readProfile reads the CPU profile, gzipped or not, at p.
+func readProfile(p string) (hotFuncs, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open profile: %s", err)
+	}
+	defer f.Close()
+	prof, err := profile.Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse profile %s: %s", p, err)
+	}
+	return profileShares(prof), nil
+}
+
+// profileShares returns the cumulative share of each func in prof, measured
+// by the cpu sample value if prof has one and by its last value otherwise. A
+// func that is on a sample's stack several times, as in recursion, counts
+// once for it.
+func profileShares(prof *profile.Profile) hotFuncs {
+	value := len(prof.SampleType) - 1
+	for i, st := range prof.SampleType {
+		if st.Type == "cpu" {
+			value = i
+		}
+	}
+	hot := make(hotFuncs)
+	if value < 0 {
+		return hot
+	}
+	total := int64(0)
+	cum := make(map[string]int64)
+	for _, sample := range prof.Sample {
+		v := sample.Value[value]
+		total += v
+		seen := make(map[string]bool)
+		for _, loc := range sample.Location {
+			for _, line := range loc.Line {
+				if line.Function == nil || seen[line.Function.Name] {
+					continue
+				}
+				seen[line.Function.Name] = true
+				cum[line.Function.Name] += v
+			}
+		}
+	}
+	if total == 0 {
+		return hot
+	}
+	for name, v := range cum {
+		hot[name] = 100 * float64(v) / float64(total)
+	}
+	return hot
+}
+
+// profileName returns the name a profile gives f, like "example.com/p.F",
+// "example.com/p.T.M", or "example.com/p.(*T).M". Generic funcs and the
+// methods of generic types have their type arguments written as "[...]".
+func profileName(f *types.Func) string {
+	if f.Pkg() == nil {
+		return f.Name()
+	}
+	name := f.Name()
+	if f.Type().(*types.Signature).TypeParams().Len() > 0 {
+		name += "[...]"
+	}
+	recv := f.Type().(*types.Signature).Recv()
+	if recv == nil {
+		return f.Pkg().Path() + "." + name
+	}
+	t := recv.Type()
+	ptr := false
+	if p, ok := t.(*types.Pointer); ok {
+		t, ptr = p.Elem(), true
+	}
+	typ := ""
+	if named, ok := t.(*types.Named); ok {
+		typ = named.Obj().Name()
+		if named.TypeParams().Len() > 0 || named.TypeArgs().Len() > 0 {
+			typ += "[...]"
+		}
+	}
+	if ptr {
+		typ = "(*" + typ + ")"
+	}
+	return f.Pkg().Path() + "." + typ + "." + name
+}
+
+// share returns the cumulative share of f in the profile, including the
+// closures it declares, which the profile names after it.
+func (hot hotFuncs) share(f *types.Func) float64 {
+	name := profileName(f)
+	share := hot[name]
+	for other, s := range hot {
+		if strings.HasPrefix(other, name+".func") {
+			share = max(share, s)
+		}
+	}
+	return share
+}
+
+// apply sets the hot share of every site with a func and returns the sites
+// whose funcs take at least minShare percent of the profile, recording the
+// others in skips.
+func (hot hotFuncs) apply(sites []copySite, fset *token.FileSet, minShare float64, skips *skipLog) []copySite {
+	kept := []copySite{}
+	for _, site := range sites {
+		if site.fun != nil {
+			site.hot = hot.share(site.fun)
+		}
+		if minShare > 0 && site.hot < minShare {
+			skips.add(skipCold, siteEntity(site, fset))
+			continue
+		}
+		kept = append(kept, site)
+	}
+	return kept
+}
+
+// hotLabel returns the label of a site's share of the profile.
+func (site copySite) hotLabel() string {
+	return fmt.Sprintf(" [hot: %.1f%% of CPU]", site.hot)
+}
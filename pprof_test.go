@@ -0,0 +1,98 @@
+package copyfighter
+
+import (
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+func TestProfileName(t *testing.T) {
+	pkg := types.NewPackage("example.com/p", "p")
+	tn := types.NewTypeName(token.NoPos, pkg, "T", nil)
+	named := types.NewNamed(tn, types.NewStruct(nil, nil), nil)
+	sig := func(recv types.Type) *types.Signature {
+		var v *types.Var
+		if recv != nil {
+			v = types.NewVar(token.NoPos, pkg, "t", recv)
+		}
+		return types.NewSignatureType(v, nil, nil, nil, nil, false)
+	}
+	for f, want := range map[*types.Func]string{
+		types.NewFunc(token.NoPos, pkg, "F", sig(nil)):                     "example.com/p.F",
+		types.NewFunc(token.NoPos, pkg, "M", sig(named)):                   "example.com/p.T.M",
+		types.NewFunc(token.NoPos, pkg, "P", sig(types.NewPointer(named))): "example.com/p.(*T).P",
+	} {
+		if got := profileName(f); got != want {
+			t.Errorf("profileName(%s) = %q, want %q", f, got, want)
+		}
+	}
+}
+
+func TestReadProfile(t *testing.T) {
+	fn := func(id uint64, name string) *profile.Function {
+		return &profile.Function{ID: id, Name: name}
+	}
+	hotFn, coldFn, closure := fn(1, "example.com/p.Hot"), fn(2, "example.com/p.Cold"), fn(3, "example.com/p.Hot.func1")
+	loc := func(id uint64, fns ...*profile.Function) *profile.Location {
+		l := &profile.Location{ID: id}
+		for _, f := range fns {
+			l.Line = append(l.Line, profile.Line{Function: f})
+		}
+		return l
+	}
+	hotLoc, coldLoc, closureLoc := loc(1, hotFn), loc(2, coldFn), loc(3, closure)
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+		Sample: []*profile.Sample{
+			{Location: []*profile.Location{closureLoc, hotLoc}, Value: []int64{1, 60}},
+			{Location: []*profile.Location{hotLoc, hotLoc}, Value: []int64{1, 30}},
+			{Location: []*profile.Location{coldLoc}, Value: []int64{1, 10}},
+		},
+		Location: []*profile.Location{hotLoc, coldLoc, closureLoc},
+		Function: []*profile.Function{hotFn, coldFn, closure},
+	}
+	p := filepath.Join(t.TempDir(), "cpu.pb.gz")
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := prof.Write(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	hot, err := readProfile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]float64{"example.com/p.Hot": 90, "example.com/p.Cold": 10, "example.com/p.Hot.func1": 60} {
+		if got := hot[name]; got != want {
+			t.Errorf("%s has %.1f%% of the profile, want %.1f%%", name, got, want)
+		}
+	}
+
+	pkg := types.NewPackage("example.com/p", "p")
+	sig := types.NewSignatureType(nil, nil, nil, nil, nil, false)
+	fset := token.NewFileSet()
+	file := fset.AddFile("p.go", -1, 10)
+	sites := []copySite{
+		{check: checkSignature, pos: file.Pos(1), fun: types.NewFunc(token.NoPos, pkg, "Hot", sig)},
+		{check: checkSignature, pos: file.Pos(2), fun: types.NewFunc(token.NoPos, pkg, "Cold", sig)},
+		{check: checkSignature, pos: file.Pos(3), fun: types.NewFunc(token.NoPos, pkg, "Absent", sig)},
+	}
+	skips := newSkipLog()
+	kept := hot.apply(sites, fset, 50, skips)
+	if len(kept) != 1 || kept[0].fun.Name() != "Hot" || kept[0].hot != 90 {
+		t.Errorf("kept %v with -hot-min 50, want Hot at 90%%", kept)
+	}
+	if n := len(skips.entities[skipCold]); n != 2 {
+		t.Errorf("skipped %d cold sites, want 2", n)
+	}
+	if kept := hot.apply(sites, fset, 0, nil); len(kept) != 3 {
+		t.Errorf("kept %d sites without -hot-min, want 3", len(kept))
+	}
+}
@@ -0,0 +1,153 @@
+package copyfighter
+
+import (
+	"fmt"
+	"go/build"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// checkProgram analyzes the program whose main package is in dir. Every
+// package the program imports from outside the standard library is loaded
+// from source and type checked along with it, so the wide types of any of
+// them are wide wherever they are used. Only the sites in the packages of the
+// main package's module are returned; others are recorded in skips.
+func checkProgram(dir string, lim limits, sizes types.Sizes, skips *skipLog) ([]copySite, *token.FileSet, error) {
+	fset := token.NewFileSet()
+	cfg := loadConfig([]string{dir}, loadMode|packages.NeedImports|packages.NeedDeps)
+	cfg.Fset = fset
+	roots, err := packages.Load(cfg, dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to load program in %#v: %s", dir, err)
+	}
+	if len(roots) != 1 {
+		return nil, nil, fmt.Errorf("%#v doesn't hold exactly one package", dir)
+	}
+	main := roots[0]
+	if len(main.Errors) == 0 && main.Name != "main" {
+		return nil, nil, fmt.Errorf("%#v is package %s, not a main package", dir, main.Name)
+	}
+
+	// Visit the packages dependencies first, skipping the standard library.
+	// With NeedDeps, go/packages type checks all of them from source, so
+	// the packages share the objects of the types they have in common.
+	var pkgs []*packages.Package
+	var loadErr error
+	packages.Visit(roots, func(pkg *packages.Package) bool {
+		return !inGoroot(pkg)
+	}, func(pkg *packages.Package) {
+		if inGoroot(pkg) {
+			return
+		}
+		if err := typeErrors(pkg, skips); err != nil && loadErr == nil {
+			loadErr = err
+		}
+		pkgs = append(pkgs, pkg)
+	})
+	if loadErr != nil {
+		return nil, nil, loadErr
+	}
+
+	ours := []*packages.Package{}
+	wide := wideTypes{named: make(map[*types.TypeName]bool), maxes: make(map[*types.TypeName]int64), sizes: sizes}
+	decls := make(map[*packages.Package]pkgDecls)
+	calls := make(map[*types.Func]int)
+	for _, pkg := range pkgs {
+		skips.addFiles(pkg.IgnoredFiles)
+		d := collectDecls(pkg.Syntax, pkg.TypesInfo, fset, sizes, lim.of(checkDuplicate), skips)
+		for tn := range d.named {
+			wide.named[tn] = true
+		}
+		for tn, max := range d.maxes {
+			wide.maxes[tn] = max
+		}
+		decls[pkg] = d
+		if !sameModule(pkg, main) {
+			skips.add(skipOutsideModule, pkg.PkgPath)
+			continue
+		}
+		ours = append(ours, pkg)
+		for f, n := range countCalls(pkg.Syntax, pkg.TypesInfo) {
+			calls[f] += n
+		}
+	}
+
+	// Wide types can be declared in any of the packages.
+	declared := make(map[*types.TypeName]token.Position)
+	for _, d := range decls {
+		for tn, position := range d.declared {
+			declared[tn] = position
+		}
+	}
+	sites := []copySite{}
+	structs := []*types.TypeName{}
+	for _, pkg := range ours {
+		d := decls[pkg]
+		d.declared = declared
+		sites = append(sites, findSites(pkg.Syntax, pkg.TypesInfo, d, wide, lim, calls)...)
+		sites = append(sites, findDependencyCalls(pkg.Syntax, pkg.TypesInfo, pkg.Types, modulePath(pkg), wide.over(lim.of(checkDependencyCall)))...)
+		sites = append(sites, findCalls(pkg.Syntax, pkg.TypesInfo, pkg.Types, modulePath(pkg), wide.over(lim.of(checkCall)))...)
+		structs = append(structs, decls[pkg].structs...)
+	}
+	sites = append(sites, findDuplicateStructs(structs, sizes, fset)...)
+	sites = lim.enabled(sites)
+	if *sortBy == "cost" {
+		if err := addCopyCosts(sites, main); err != nil {
+			return nil, nil, err
+		}
+	}
+	sort.Sort(sortedCopySites{sites: sites, fset: fset})
+	return sites, fset, nil
+}
+
+// sameModule returns true if pkg belongs to the module of main, or, outside
+// of modules, is in main's directory tree.
+func sameModule(pkg, main *packages.Package) bool {
+	if main.Module != nil {
+		return pkg.Module != nil && pkg.Module.Path == main.Module.Path
+	}
+	if len(pkg.GoFiles) == 0 || len(main.GoFiles) == 0 {
+		return false
+	}
+	return within(filepath.Dir(main.GoFiles[0]), filepath.Dir(pkg.GoFiles[0]))
+}
+
+// modulePath returns the path of pkg's module, or "" if it isn't in one.
+func modulePath(pkg *packages.Package) string {
+	if pkg.Module == nil {
+		return ""
+	}
+	return pkg.Module.Path
+}
+
+// inGoroot returns true if pkg is part of the standard library.
+func inGoroot(pkg *packages.Package) bool {
+	return len(pkg.GoFiles) > 0 && within(filepath.Join(build.Default.GOROOT, "src"), pkg.GoFiles[0])
+}
+
+// moduleRoot returns the directory of the go.mod file governing dir. ok is
+// false if dir isn't in a module.
+func moduleRoot(dir string) (root string, ok bool) {
+	for d := dir; ; {
+		if _, err := os.Stat(filepath.Join(d, "go.mod")); err == nil {
+			return d, true
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return "", false
+		}
+		d = parent
+	}
+}
+
+// within returns true if path is dir or is below it.
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
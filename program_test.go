@@ -0,0 +1,58 @@
+package copyfighter
+
+import (
+	"go/types"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckProgram(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"m/go.mod": "module example.com/m\n\ngo 1.22\n\nrequire example.com/dep v0.0.0\n\nreplace example.com/dep => ../dep\n",
+		"m/main.go": `package main
+
+import "example.com/dep"
+
+func use(b dep.Big) int64 { return b.A }
+
+func main() { use(dep.Big{}) }
+`,
+		"dep/go.mod": "module example.com/dep\n\ngo 1.22\n",
+		"dep/dep.go": `package dep
+
+type Big struct{ A, B, C int64 }
+
+func Take(b Big) {}
+`,
+	}
+	for name, src := range files {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(filepath.Join(dir, "m"))
+	// go/build resolves the replaced module with the go command.
+	t.Setenv("GO111MODULE", "on")
+
+	skips := newSkipLog()
+	sites, _, err := checkProgram(".", limits{max: 16}, &types.StdSizes{WordSize: 8, MaxAlign: 8}, skips)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Big is wide in the main module even though another module declares it,
+	// and Take, in that module, isn't reported.
+	if len(sites) != 1 || sites[0].fun.Name() != "use" {
+		t.Errorf("got %d sites, want only use's", len(sites))
+	}
+	if got := skips.entities[skipOutsideModule]; len(got) != 1 || got[0] != "example.com/dep" {
+		t.Errorf("skipped %v outside the module, want example.com/dep", got)
+	}
+	if _, _, err := checkProgram("../dep", limits{max: 16}, &types.StdSizes{WordSize: 8, MaxAlign: 8}, nil); err == nil {
+		t.Error("checked ./dep as a program, want an error since it isn't a main package")
+	}
+}
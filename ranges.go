@@ -0,0 +1,64 @@
+package copyfighter
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+)
+
+// findRangeCopies returns a copySite for every range loop whose iteration
+// variable holds a copy of a wide element, as in for _, v := range items,
+// which copies each element of items into v before running the body. Ranges
+// over funcs are left out, since their values are copied by the calls that
+// yield them.
+func findRangeCopies(files []*ast.File, info *types.Info, wide wideTypes) []copySite {
+	sites := []copySite{}
+	inspectFuncBodies(files, info, func(fun *types.Func, n ast.Node) bool {
+		rs, ok := n.(*ast.RangeStmt)
+		if !ok {
+			return true
+		}
+		xt := info.TypeOf(rs.X)
+		if xt == nil {
+			return true
+		}
+		var (
+			elem    ast.Expr
+			instead string
+		)
+		switch u := xt.Underlying().(type) {
+		case *types.Slice, *types.Array:
+			elem, instead = rs.Value, "range over the index and use the element in place, or over a slice of pointers"
+		case *types.Pointer:
+			if _, ok := u.Elem().Underlying().(*types.Array); !ok {
+				return true
+			}
+			elem, instead = rs.Value, "range over the index and use the element in place"
+		case *types.Map:
+			elem, instead = rs.Value, "range over the keys and use the element through the map, or use a map of pointers"
+		case *types.Chan:
+			elem, instead = rs.Key, "use a channel of pointers"
+		default:
+			return true
+		}
+		id, ok := elem.(*ast.Ident)
+		if !ok || id.Name == "_" {
+			return true
+		}
+		t := info.TypeOf(id)
+		if t == nil || !wide.isWide(t) {
+			return true
+		}
+		size := wide.sizes.Sizeof(t)
+		sites = append(sites, copySite{
+			check:  checkRange,
+			pos:    rs.Pos(),
+			fun:    fun,
+			what:   fmt.Sprintf("range value '%s' copies '%s' (%d bytes) each iteration, %s instead", id.Name, typeString(t, fun.Pkg()), size, instead),
+			size:   size,
+			values: []copiedValue{{typ: t, size: size}},
+		})
+		return true
+	})
+	return sites
+}
@@ -0,0 +1,131 @@
+package copyfighter
+
+import (
+	"encoding/json"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// The parts of the Reviewdog Diagnostic Format that writeRDJSON uses.
+type (
+	rdjsonResult struct {
+		Source      rdjsonSource       `json:"source"`
+		Diagnostics []rdjsonDiagnostic `json:"diagnostics"`
+	}
+	rdjsonSource struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+	}
+	rdjsonDiagnostic struct {
+		Message     string             `json:"message"`
+		Location    rdjsonLocation     `json:"location"`
+		Severity    string             `json:"severity"`
+		Code        rdjsonCode         `json:"code"`
+		Suggestions []rdjsonSuggestion `json:"suggestions,omitempty"`
+	}
+	rdjsonLocation struct {
+		Path  string      `json:"path"`
+		Range rdjsonRange `json:"range"`
+	}
+	// rdjsonRange is the position of its start if it has no end.
+	rdjsonRange struct {
+		Start rdjsonPosition  `json:"start"`
+		End   *rdjsonPosition `json:"end,omitempty"`
+	}
+	// rdjsonPosition has a 1-based line and a 1-based column counted in
+	// bytes.
+	rdjsonPosition struct {
+		Line   int `json:"line"`
+		Column int `json:"column"`
+	}
+	rdjsonCode struct {
+		Value string `json:"value"`
+		URL   string `json:"url"`
+	}
+	rdjsonSuggestion struct {
+		Range rdjsonRange `json:"range"`
+		Text  string      `json:"text"`
+	}
+)
+
+// rdjsonSeverities map the severities of sites to those of diagnostics.
+var rdjsonSeverities = map[Severity]string{
+	SeverityNote:    "INFO",
+	SeverityWarning: "WARNING",
+	SeverityError:   "ERROR",
+}
+
+// writeRDJSON writes the sites in the Reviewdog Diagnostic Format, for
+// reviewdog -f=rdjson to post as review comments. A by-value signature that
+// fixSignatures can fix within the file it's declared in, calls included, has
+// the insertions of the fix as suggestions, which reviewdog posts as
+// suggested changes. Finding them loads the report's packages again for each
+// signature, so a report without patterns has no suggestions.
+func writeRDJSON(w io.Writer, r *report) error {
+	out := rdjsonResult{
+		Source:      rdjsonSource{Name: "copyfighter", URL: docsURL},
+		Diagnostics: []rdjsonDiagnostic{},
+	}
+	for _, site := range r.sites {
+		position := r.fset.Position(site.pos)
+		out.Diagnostics = append(out.Diagnostics, rdjsonDiagnostic{
+			Message: site.message(r.labels),
+			Location: rdjsonLocation{
+				Path:  relPath(position.Filename),
+				Range: rdjsonRange{Start: rdjsonPosition{position.Line, position.Column}},
+			},
+			Severity:    rdjsonSeverities[r.tiers.of(site)],
+			Code:        rdjsonCode{Value: site.check, URL: docsURL},
+			Suggestions: rdjsonSuggestions(site, r.fset, r.patterns),
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// rdjsonSuggestions returns the insertions that fix the by-value signature of
+// site, or nil if fixSignatures can't fix it or the fix changes other files
+// than the site's, which suggestions can't. Its calls are looked for in its
+// package, since funcs called from other packages are exported and not fixed.
+func rdjsonSuggestions(site copySite, fset *token.FileSet, patterns []string) []rdjsonSuggestion {
+	if len(patterns) == 0 || site.check != checkSignature || !canFix(site) {
+		return nil
+	}
+	filename := fset.Position(site.pos).Filename
+	f, err := planFixes([]string{filepath.Dir(filename)}, []copySite{site})
+	if err != nil || !f.fixes(site.fun) || len(f.edits) != 1 {
+		return nil
+	}
+	edits, ok := f.edits[absPath(filename)]
+	if !ok {
+		return nil
+	}
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return nil
+	}
+	suggestions := []rdjsonSuggestion{}
+	for _, e := range sortedInsertions(edits) {
+		// An insertion replaces the range of the bytes it cuts, which is
+		// empty for most.
+		start, end := rdjsonPositionAt(src, e.offset), rdjsonPositionAt(src, e.offset+e.cut)
+		suggestions = append(suggestions, rdjsonSuggestion{Range: rdjsonRange{Start: start, End: &end}, Text: e.text})
+	}
+	return suggestions
+}
+
+// rdjsonPositionAt returns the position of the byte at offset in src.
+func rdjsonPositionAt(src []byte, offset int) rdjsonPosition {
+	p := rdjsonPosition{Line: 1, Column: 1}
+	for _, b := range src[:min(offset, len(src))] {
+		if b == '\n' {
+			p.Line, p.Column = p.Line+1, 1
+		} else {
+			p.Column++
+		}
+	}
+	return p
+}
@@ -0,0 +1,84 @@
+package copyfighter
+
+import "go/types"
+
+// abiRegisters is the number of integer and floating-point registers the Go
+// register-based calling convention (ABIInternal, Go 1.17 and later) uses for
+// arguments and, separately, for results.
+type abiRegisters struct {
+	ints   int
+	floats int
+}
+
+// abiRegs holds the argument registers of each GOARCH that uses the register
+// ABI. The other architectures pass everything on the stack.
+var abiRegs = map[string]abiRegisters{
+	"amd64":   {ints: 9, floats: 15},
+	"arm64":   {ints: 16, floats: 16},
+	"loong64": {ints: 16, floats: 16},
+	"ppc64":   {ints: 12, floats: 12},
+	"ppc64le": {ints: 12, floats: 12},
+	"riscv64": {ints: 16, floats: 16},
+}
+
+// regAssigner hands out registers to values in the order the calling
+// convention assigns them: the receiver, then each parameter, or each result.
+type regAssigner struct {
+	free abiRegisters
+}
+
+// assign returns true if a value of type t is passed in registers, taking
+// them from the assigner. Values that don't fit in the remaining registers go
+// on the stack and take nothing.
+func (a *regAssigner) assign(t types.Type) bool {
+	need, ok := regsFor(t)
+	if !ok || need.ints > a.free.ints || need.floats > a.free.floats {
+		return false
+	}
+	a.free.ints -= need.ints
+	a.free.floats -= need.floats
+	return true
+}
+
+// regsFor returns the registers a value of type t needs on a 64-bit
+// architecture. ok is false if the ABI never passes t in registers, which is
+// the case for arrays of more than one element.
+func regsFor(t types.Type) (need abiRegisters, ok bool) {
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case u.Info()&types.IsComplex != 0:
+			return abiRegisters{floats: 2}, true
+		case u.Info()&types.IsFloat != 0:
+			return abiRegisters{floats: 1}, true
+		case u.Kind() == types.String:
+			return abiRegisters{ints: 2}, true
+		}
+		return abiRegisters{ints: 1}, true
+	case *types.Pointer, *types.Chan, *types.Map, *types.Signature:
+		return abiRegisters{ints: 1}, true
+	case *types.Slice:
+		return abiRegisters{ints: 3}, true
+	case *types.Interface:
+		return abiRegisters{ints: 2}, true
+	case *types.Array:
+		switch u.Len() {
+		case 0:
+			return abiRegisters{}, true
+		case 1:
+			return regsFor(u.Elem())
+		}
+		return abiRegisters{}, false
+	case *types.Struct:
+		for i := 0; i < u.NumFields(); i++ {
+			f, ok := regsFor(u.Field(i).Type())
+			if !ok {
+				return abiRegisters{}, false
+			}
+			need.ints += f.ints
+			need.floats += f.floats
+		}
+		return need, true
+	}
+	return abiRegisters{}, false
+}
@@ -0,0 +1,36 @@
+package copyfighter
+
+import (
+	"go/types"
+	"testing"
+)
+
+func TestRegAssigner(t *testing.T) {
+	ints := types.NewStruct([]*types.Var{
+		types.NewField(0, nil, "a", types.Typ[types.Int], false),
+		types.NewField(0, nil, "b", types.Typ[types.String], false),
+	}, nil)
+	array := types.NewArray(types.Typ[types.Int], 2)
+
+	a := regAssigner{free: abiRegs["amd64"]}
+	if !a.assign(ints) || !a.assign(ints) || !a.assign(ints) {
+		t.Fatal("three 3-register structs should fit in amd64's 9 integer registers")
+	}
+	if a.assign(ints) {
+		t.Error("fourth struct should have been passed on the stack")
+	}
+	if !a.assign(types.Typ[types.Float64]) {
+		t.Error("float should still fit in a floating-point register")
+	}
+
+	b := regAssigner{free: abiRegs["amd64"]}
+	if b.assign(array) {
+		t.Error("arrays of more than one element are never passed in registers")
+	}
+	if !b.assign(types.NewArray(types.Typ[types.Int], 1)) {
+		t.Error("single element arrays are passed like their element")
+	}
+	if (&regAssigner{}).assign(types.Typ[types.Int]) {
+		t.Error("architectures without the register ABI pass everything on the stack")
+	}
+}
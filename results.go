@@ -0,0 +1,74 @@
+package copyfighter
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+// findNamedResults returns a copySite for every assignment to a named result
+// of a declared func that holds a wide value, as cfg = other in
+// func load() (cfg Config, err error). A named result is a variable of its
+// own that every return copies out to the caller, so the assignment copies the
+// value in first. The result itself is part of the func's signature, which
+// the signature check reports, so it isn't reported here. Assignments of
+// composite literals build the value in place and aren't reported.
+func findNamedResults(files []*ast.File, info *types.Info, wide wideTypes) []copySite {
+	sites := []copySite{}
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			fd, ok := decl.(*ast.FuncDecl)
+			if !ok || fd.Body == nil || fd.Type.Results == nil {
+				continue
+			}
+			fun, ok := info.Defs[fd.Name].(*types.Func)
+			if !ok {
+				continue
+			}
+			results := make(map[*types.Var]bool)
+			for _, field := range fd.Type.Results.List {
+				for _, name := range field.Names {
+					if v, ok := info.Defs[name].(*types.Var); ok && wide.isWide(v.Type()) {
+						results[v] = true
+					}
+				}
+			}
+			if len(results) == 0 {
+				continue
+			}
+			ast.Inspect(fd.Body, func(n ast.Node) bool {
+				as, ok := n.(*ast.AssignStmt)
+				if !ok || as.Tok != token.ASSIGN {
+					return true
+				}
+				for i, lhs := range as.Lhs {
+					id, ok := ast.Unparen(lhs).(*ast.Ident)
+					if !ok {
+						continue
+					}
+					v, ok := info.Uses[id].(*types.Var)
+					if !ok || !results[v] {
+						continue
+					}
+					if len(as.Rhs) == len(as.Lhs) {
+						if _, ok := ast.Unparen(as.Rhs[i]).(*ast.CompositeLit); ok {
+							continue
+						}
+					}
+					size := wide.sizes.Sizeof(v.Type())
+					sites = append(sites, copySite{
+						check:  checkNamedResult,
+						pos:    as.Pos(),
+						fun:    fun,
+						what:   fmt.Sprintf("assigning to named result '%s' copies '%s' (%d bytes) into it", id.Name, typeString(v.Type(), fun.Pkg()), size),
+						size:   size,
+						values: []copiedValue{{typ: v.Type(), size: size}},
+					})
+				}
+				return true
+			})
+		}
+	}
+	return sites
+}
@@ -0,0 +1,176 @@
+package copyfighter
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"io"
+)
+
+// The parts of the SARIF 2.1.0 object model that writeSARIF uses.
+type (
+	sarifLog struct {
+		Schema  string     `json:"$schema"`
+		Version string     `json:"version"`
+		Runs    []sarifRun `json:"runs"`
+	}
+	sarifRun struct {
+		Tool        sarifTool         `json:"tool"`
+		Results     []sarifResult     `json:"results"`
+		Invocations []sarifInvocation `json:"invocations,omitempty"`
+	}
+	// sarifInvocation marks a run of -lenient as partial, with a warning
+	// for each package that has type errors.
+	sarifInvocation struct {
+		ExecutionSuccessful        bool                `json:"executionSuccessful"`
+		ToolExecutionNotifications []sarifNotification `json:"toolExecutionNotifications"`
+	}
+	sarifNotification struct {
+		Level   string       `json:"level"`
+		Message sarifMessage `json:"message"`
+	}
+	sarifTool struct {
+		Driver sarifDriver `json:"driver"`
+	}
+	sarifDriver struct {
+		Name           string      `json:"name"`
+		InformationURI string      `json:"informationUri"`
+		Rules          []sarifRule `json:"rules"`
+	}
+	sarifRule struct {
+		ID               string       `json:"id"`
+		ShortDescription sarifMessage `json:"shortDescription"`
+		FullDescription  sarifMessage `json:"fullDescription"`
+		Help             sarifMessage `json:"help"`
+		HelpURI          string       `json:"helpUri"`
+	}
+	sarifResult struct {
+		RuleID           string          `json:"ruleId"`
+		RuleIndex        int             `json:"ruleIndex"`
+		Level            string          `json:"level"`
+		Message          sarifMessage    `json:"message"`
+		Locations        []sarifLocation `json:"locations"`
+		RelatedLocations []sarifLocation `json:"relatedLocations,omitempty"`
+		// PartialFingerprints has the result's fingerprint under
+		// sarifFingerprintKey.
+		PartialFingerprints map[string]string `json:"partialFingerprints,omitempty"`
+		Properties          sarifProperties   `json:"properties"`
+	}
+	sarifProperties struct {
+		// Size is the size in bytes of the largest flagged value.
+		Size int64 `json:"size"`
+	}
+	sarifLocation struct {
+		ID               int                   `json:"id,omitempty"`
+		PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+		Message          *sarifMessage         `json:"message,omitempty"`
+	}
+	sarifPhysicalLocation struct {
+		ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+		Region           sarifRegion           `json:"region"`
+	}
+	sarifArtifactLocation struct {
+		URI       string `json:"uri"`
+		URIBaseID string `json:"uriBaseId"`
+	}
+	sarifRegion struct {
+		StartLine   int `json:"startLine"`
+		StartColumn int `json:"startColumn"`
+		EndLine     int `json:"endLine,omitempty"`
+		EndColumn   int `json:"endColumn,omitempty"`
+	}
+	sarifMessage struct {
+		Text string `json:"text"`
+	}
+)
+
+// sarifFingerprintKey is the name of the partial fingerprint of results, the
+// fingerprint the codeclimate format gives the site.
+const sarifFingerprintKey = "copyfighter/v1"
+
+// writeSARIF writes the sites as a SARIF 2.1.0 log, as GitHub code scanning
+// reads it. Every check is a rule whose ID is the check ID. The receivers,
+// parameters, and results of by-value signatures are related locations of
+// their results, so the declaration of each flagged value can be found, and
+// results carry the sites' fingerprints, which merge tells them apart by.
+func writeSARIF(w io.Writer, r *report) error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "copyfighter",
+			InformationURI: docsURL,
+			Rules:          []sarifRule{},
+		}},
+		Results: []sarifResult{},
+	}
+	seen := make(map[string]int)
+	ruleIndex := make(map[string]int)
+	for i, id := range checkIDs() {
+		info := checks[id]
+		ruleIndex[id] = i
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+			ID:               id,
+			ShortDescription: sarifMessage{info.name},
+			FullDescription:  sarifMessage{info.description},
+			Help:             sarifMessage{info.rationale},
+			HelpURI:          docsURL,
+		})
+	}
+	for _, site := range r.sites {
+		result := sarifResult{
+			RuleID:              site.check,
+			RuleIndex:           ruleIndex[site.check],
+			Level:               string(r.tiers.of(site)),
+			Message:             sarifMessage{site.message(r.labels)},
+			Locations:           []sarifLocation{sarifLocationOf(r.fset, site.pos)},
+			Properties:          sarifProperties{Size: site.size},
+			PartialFingerprints: map[string]string{sarifFingerprintKey: site.fingerprint(seen)},
+		}
+		for _, v := range site.values {
+			if v.role == "" || !v.pos.IsValid() {
+				continue
+			}
+			loc := sarifLocationOf(r.fset, v.pos)
+			if v.end.IsValid() {
+				end := r.fset.Position(v.end)
+				loc.PhysicalLocation.Region.EndLine, loc.PhysicalLocation.Region.EndColumn = end.Line, end.Column
+			}
+			loc.ID = len(result.RelatedLocations) + 1
+			what := v.role
+			if v.role != "receiver" {
+				what = fmt.Sprintf("%s at index %d", v.role, v.index)
+			}
+			text := fmt.Sprintf("%s is '%s' (%d bytes)", what, typeString(v.typ, site.fun.Pkg()), v.size)
+			loc.Message = &sarifMessage{text}
+			result.RelatedLocations = append(result.RelatedLocations, loc)
+		}
+		run.Results = append(run.Results, result)
+	}
+	if len(r.partial) > 0 {
+		inv := sarifInvocation{ExecutionSuccessful: true}
+		for _, entity := range r.partial {
+			inv.ToolExecutionNotifications = append(inv.ToolExecutionNotifications, sarifNotification{
+				Level:   "warning",
+				Message: sarifMessage{"results are partial, type errors in " + entity},
+			})
+		}
+		run.Invocations = []sarifInvocation{inv}
+	}
+	log := sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(log)
+}
+
+// sarifLocationOf returns the location of pos, relative to the root of the
+// checkout GitHub code scanning resolves it against.
+func sarifLocationOf(fset *token.FileSet, pos token.Pos) sarifLocation {
+	position := fset.Position(pos)
+	return sarifLocation{PhysicalLocation: sarifPhysicalLocation{
+		ArtifactLocation: sarifArtifactLocation{URI: relPath(position.Filename), URIBaseID: "%SRCROOT%"},
+		Region:           sarifRegion{StartLine: position.Line, StartColumn: position.Column},
+	}}
+}
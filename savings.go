@@ -0,0 +1,72 @@
+package copyfighter
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"io"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+)
+
+// writeSavings writes an estimate of how many bytes of copying applying every
+// suggestion in sites would eliminate, in total, by package directory, and by
+// type. Each flagged value is replaced by a pointer of pointerSize bytes, and
+// is copied once per static call site of its func in the analyzed packages, or
+// once for copies found in func bodies. Calls from packages that aren't
+// analyzed and through interfaces aren't counted, so the estimate is a lower
+// bound.
+func writeSavings(w io.Writer, sites []copySite, fset *token.FileSet, pointerSize int64) error {
+	total := int64(0)
+	perCall := int64(0)
+	callSites := 0
+	byPkg := make(map[string]int64)
+	byType := make(map[string]int64)
+	for _, site := range sites {
+		if len(site.values) == 0 {
+			continue
+		}
+		n := 1
+		if len(site.shouldBe) > 0 {
+			n = site.calls
+		}
+		callSites += n
+		pkg := relPath(filepath.Dir(fset.Position(site.pos).Filename))
+		for _, v := range site.values {
+			saved := v.size - pointerSize
+			perCall += saved
+			total += saved * int64(n)
+			byPkg[pkg] += saved * int64(n)
+			byType[types.TypeString(v.typ, nil)] += saved * int64(n)
+		}
+	}
+
+	fmt.Fprintf(w, "%d findings, %d static call sites\n", len(sites), callSites)
+	fmt.Fprintf(w, "bytes saved per call of every flagged func: %d\n", perCall)
+	fmt.Fprintf(w, "bytes saved per execution of every call site: %d\n", total)
+	if err := writeSavingsTable(w, "package", byPkg); err != nil {
+		return err
+	}
+	return writeSavingsTable(w, "type", byType)
+}
+
+// writeSavingsTable writes savings, largest first, under the given heading.
+func writeSavingsTable(w io.Writer, heading string, savings map[string]int64) error {
+	keys := []string{}
+	for k := range savings {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if savings[keys[i]] != savings[keys[j]] {
+			return savings[keys[i]] > savings[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	fmt.Fprintf(w, "\nby %s:\n", heading)
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	for _, k := range keys {
+		fmt.Fprintf(tw, "%d\t  %s\n", savings[k], k)
+	}
+	return tw.Flush()
+}
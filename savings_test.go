@@ -0,0 +1,41 @@
+package copyfighter
+
+import (
+	"bytes"
+	"go/token"
+	"go/types"
+	"testing"
+)
+
+func TestWriteSavings(t *testing.T) {
+	fset := token.NewFileSet()
+	f := fset.AddFile("a.go", -1, 100)
+	f.SetLines([]int{0, 50})
+	array := func(n int64) types.Type { return types.NewArray(types.Typ[types.Int64], n) }
+	sites := []copySite{
+		// A signature called 3 times copies 32 bytes where a pointer copies 8.
+		{pos: f.Pos(0), shouldBe: []string{"parameter 'x'"}, calls: 3, values: []copiedValue{{typ: array(4), size: 32}}},
+		// A copy in a body is counted once.
+		{pos: f.Pos(50), what: "copies", values: []copiedValue{{typ: array(3), size: 24}}},
+		// A site without values saves nothing.
+		{pos: f.Pos(50), what: "declares"},
+	}
+	var buf bytes.Buffer
+	if err := writeSavings(&buf, sites, fset, 8); err != nil {
+		t.Fatal(err)
+	}
+	want := `3 findings, 4 static call sites
+bytes saved per call of every flagged func: 40
+bytes saved per execution of every call site: 88
+
+by package:
+  88  .
+
+by type:
+  72  [4]int64
+  16  [3]int64
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,54 @@
+package copyfighter
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+// findSelectCopies returns a copySite for every communication clause of a
+// select statement that sends or receives a wide struct by value. Selects
+// usually sit in the loop of a long-running goroutine, so each of these copies
+// happens over and over.
+func findSelectCopies(files []*ast.File, info *types.Info, wide wideTypes) []copySite {
+	sites := []copySite{}
+	inspectFuncBodies(files, info, func(fun *types.Func, n ast.Node) bool {
+		cc, ok := n.(*ast.CommClause)
+		if !ok || cc.Comm == nil {
+			return true
+		}
+		var (
+			ch   ast.Expr
+			verb string
+		)
+		switch comm := cc.Comm.(type) {
+		case *ast.SendStmt:
+			ch, verb = comm.Chan, "sends"
+		case *ast.AssignStmt:
+			// Receives whose value is discarded, like "case <-ch:",
+			// don't copy into the clause.
+			if recv, ok := ast.Unparen(comm.Rhs[0]).(*ast.UnaryExpr); ok && recv.Op == token.ARROW {
+				ch, verb = recv.X, "receives"
+			}
+		}
+		if ch == nil {
+			return true
+		}
+		ct, ok := underlyingTypeOf(info, ch).(*types.Chan)
+		if !ok || !wide.isWide(ct.Elem()) {
+			return true
+		}
+		size := wide.sizes.Sizeof(ct.Elem())
+		sites = append(sites, copySite{
+			check:  checkSelect,
+			pos:    cc.Pos(),
+			fun:    fun,
+			what:   fmt.Sprintf("select case %s a copy of '%s' (%d bytes), use a channel of pointers instead", verb, typeString(ct.Elem(), fun.Pkg()), size),
+			size:   size,
+			values: []copiedValue{{typ: ct.Elem(), size: size}},
+		})
+		return true
+	})
+	return sites
+}
@@ -0,0 +1,60 @@
+package copyfighter
+
+import "fmt"
+
+// severityTiers are the sizes in bytes that the largest value a finding flags
+// must exceed for the finding to be a warning, and to be an error. A zero size
+// turns its tier off: without -warn-at every finding is at least a warning,
+// and without -error-at none is an error.
+type severityTiers struct {
+	warnAt, errorAt int64
+}
+
+// flagTiers returns the tiers -warn-at and -error-at set, or an error if they
+// are out of order.
+func flagTiers() (severityTiers, error) {
+	t := severityTiers{warnAt: *warnAt, errorAt: *errorAt}
+	if t.warnAt < 0 || t.errorAt < 0 {
+		return severityTiers{}, fmt.Errorf("-warn-at and -error-at can't be negative")
+	}
+	if t.warnAt > 0 && t.errorAt > 0 && t.errorAt < t.warnAt {
+		return severityTiers{}, fmt.Errorf("-error-at %d is below -warn-at %d", t.errorAt, t.warnAt)
+	}
+	return t, nil
+}
+
+// set returns true if either tier is on, which labels the text format's
+// findings with their severity.
+func (t severityTiers) set() bool {
+	return t.warnAt > 0 || t.errorAt > 0
+}
+
+// of returns the severity of site, by the size of its largest flagged value
+// times the weight of its package.
+func (t severityTiers) of(site copySite) Severity {
+	size := site.weighted(float64(site.size))
+	switch {
+	case t.errorAt > 0 && size > float64(t.errorAt):
+		return SeverityError
+	case t.warnAt > 0 && size <= float64(t.warnAt):
+		return SeverityNote
+	}
+	return SeverityWarning
+}
+
+// failing returns the number of sites that make the run exit with status 2:
+// the errors with -error-at, and every warning and error without it.
+func (t severityTiers) failing(sites []copySite) int {
+	n := 0
+	for _, site := range sites {
+		switch t.of(site) {
+		case SeverityError:
+			n++
+		case SeverityWarning:
+			if t.errorAt == 0 {
+				n++
+			}
+		}
+	}
+	return n
+}
@@ -0,0 +1,69 @@
+package copyfighter
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestSeverityTiers(t *testing.T) {
+	sites := []copySite{{size: 16}, {size: 24}, {size: 64}, {size: 72}}
+	for _, tt := range []struct {
+		tiers   severityTiers
+		want    []Severity
+		failing int
+	}{
+		{severityTiers{}, []Severity{SeverityWarning, SeverityWarning, SeverityWarning, SeverityWarning}, 4},
+		{severityTiers{warnAt: 16}, []Severity{SeverityNote, SeverityWarning, SeverityWarning, SeverityWarning}, 3},
+		{severityTiers{errorAt: 64}, []Severity{SeverityWarning, SeverityWarning, SeverityWarning, SeverityError}, 1},
+		{severityTiers{warnAt: 16, errorAt: 64}, []Severity{SeverityNote, SeverityWarning, SeverityWarning, SeverityError}, 1},
+	} {
+		for i, site := range sites {
+			if got := tt.tiers.of(site); got != tt.want[i] {
+				t.Errorf("%+v: severity of a %d byte finding = %s, want %s", tt.tiers, site.size, got, tt.want[i])
+			}
+		}
+		if got := tt.tiers.failing(sites); got != tt.failing {
+			t.Errorf("%+v: %d findings fail the run, want %d", tt.tiers, got, tt.failing)
+		}
+	}
+
+	// A finding in a package weighing 10 counts as ten times its size.
+	if got := (severityTiers{errorAt: 64}).of(copySite{size: 16, weight: 10}); got != SeverityError {
+		t.Errorf("severity of a 16 byte finding weighing 10 = %s, want %s", got, SeverityError)
+	}
+
+	*warnAt, *errorAt = 64, 16
+	defer func() { *warnAt, *errorAt = 0, 0 }()
+	if _, err := flagTiers(); err == nil {
+		t.Error("flagTiers accepted -error-at below -warn-at")
+	}
+}
+
+func TestSeverityFormats(t *testing.T) {
+	r := testReport()
+
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+	var findings []jsonFinding
+	if err := json.Unmarshal(buf.Bytes(), &findings); err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 2 || findings[0].Severity != "warning" || findings[1].Severity != "error" {
+		t.Errorf("json findings = %+v, want a warning and an error", findings)
+	}
+
+	buf.Reset()
+	if err := writeSARIF(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	if results := log.Runs[0].Results; len(results) != 2 || results[0].Level != "warning" || results[1].Level != "error" {
+		t.Errorf("sarif results = %+v, want a warning and an error", results)
+	}
+}
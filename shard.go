@@ -0,0 +1,53 @@
+package copyfighter
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// shard identifies one of count disjoint subsets of the packages matched by
+// an import path pattern. Packages are assigned to shards by a hash of their
+// import path, so the assignment is the same on every machine and a package
+// keeps its shard as other packages are added or removed. The zero value owns
+// every package.
+type shard struct {
+	index int // 1-based
+	count int
+}
+
+// parseShard parses a -shard value of the form "K/N". The empty string
+// disables sharding.
+func parseShard(s string) (shard, error) {
+	if s == "" {
+		return shard{}, nil
+	}
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return shard{}, fmt.Errorf("invalid shard %#v: must be of the form K/N", s)
+	}
+	k, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return shard{}, fmt.Errorf("invalid shard %#v: %s", s, err)
+	}
+	n, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return shard{}, fmt.Errorf("invalid shard %#v: %s", s, err)
+	}
+	if n < 1 || k < 1 || k > n {
+		return shard{}, fmt.Errorf("invalid shard %#v: K must be between 1 and N", s)
+	}
+	return shard{index: k, count: n}, nil
+}
+
+// owns returns true if the package with the given import path belongs to the
+// shard.
+func (s shard) owns(importPath string) bool {
+	if s.count <= 1 {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(importPath))
+	return int(h.Sum32()%uint32(s.count)) == s.index-1
+}
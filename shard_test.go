@@ -0,0 +1,34 @@
+package copyfighter
+
+import "testing"
+
+func TestShardPartitionsPackages(t *testing.T) {
+	names := []string{"a", "a/b", "a/b/c", "net/http", "github.com/foo/bar", "x"}
+	const n = 3
+	for _, name := range names {
+		owners := 0
+		for k := 1; k <= n; k++ {
+			if (shard{index: k, count: n}).owns(name) {
+				owners++
+			}
+		}
+		if owners != 1 {
+			t.Errorf("%#v is owned by %d shards, want 1", name, owners)
+		}
+	}
+}
+
+func TestParseShard(t *testing.T) {
+	sh, err := parseShard("3/8")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if sh.index != 3 || sh.count != 8 {
+		t.Errorf("got %+v, want 3/8", sh)
+	}
+	for _, bad := range []string{"3", "0/8", "9/8", "a/b", "1/0"} {
+		if _, err := parseShard(bad); err == nil {
+			t.Errorf("parseShard(%#v) succeeded, want error", bad)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package copyfighter
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The reasons something is skipped, phrased as what was skipped.
+const (
+	skipCgoFile        = "cgo files"
+	skipConstrained    = "files excluded by build constraints"
+	skipGenericType    = "generic types, which have no size"
+	skipOtherShard     = "packages in other shards"
+	skipRepeatedPkg    = "packages matched again through another path"
+	skipOutsideModule  = "packages outside the main module"
+	skipUnexported     = "unexported funcs and methods"
+	skipSingleCaller   = "findings in single-caller funcs"
+	skipUnchanged      = "findings outside the changed files"
+	skipIgnoredPath    = "findings in paths listed in " + ignoreFileName
+	skipNonAPI         = "findings that don't change the exported API"
+	skipLowConfidence  = "findings below -min-confidence"
+	skipImplements     = "findings in methods that implement interfaces"
+	skipDirective      = "findings suppressed by " + ignoreDirective
+	skipExcludedPkg    = "findings in packages excluded by -exclude or " + configFileName
+	skipExcludedLoad   = "packages excluded by -exclude"
+	skipExcludedType   = "findings about types excluded by -exclude-types or " + configFileName
+	skipAllowlisted    = "findings about standard library types passed by value by convention, which -no-default-allowlist reports"
+	skipBadDirective   = "max directives whose size isn't a number of bytes and ignore directives whose until date isn't a day"
+	skipUnreadable     = "unreadable files and directories"
+	skipUnreadablePkg  = "packages with unreadable files"
+	skipPartialPkg     = "parts of packages with type errors, which -lenient analyzes in part"
+	skipBaseline       = "findings recorded in the baseline"
+	skipGenerated      = "findings in generated files"
+	skipEscapingResult = "results of funcs that can't be inlined, whose pointers would escape"
+	skipCold           = "findings in funcs below -hot-min in the profile"
+)
+
+// skipLog records what a run didn't analyze or report, so that no findings
+// can be told apart from findings in code that was never looked at. A nil
+// *skipLog records nothing.
+type skipLog struct {
+	entities map[string][]string
+}
+
+func newSkipLog() *skipLog {
+	return &skipLog{entities: make(map[string][]string)}
+}
+
+// add records that entity was skipped for reason.
+func (l *skipLog) add(reason, entity string) {
+	if l == nil {
+		return
+	}
+	l.entities[reason] = append(l.entities[reason], entity)
+}
+
+// merge records everything other recorded in l, after what l has.
+func (l *skipLog) merge(other *skipLog) {
+	if l == nil || other == nil {
+		return
+	}
+	for reason, entities := range other.entities {
+		l.entities[reason] = append(l.entities[reason], entities...)
+	}
+}
+
+// addFiles records the files that a package's build constraints exclude,
+// telling cgo files, which are excluded because cgo is disabled, apart from
+// the rest.
+func (l *skipLog) addFiles(paths []string) {
+	if l == nil {
+		return
+	}
+	for _, path := range paths {
+		reason := skipConstrained
+		if importsC(path) {
+			reason = skipCgoFile
+		}
+		l.add(reason, relPath(path))
+	}
+}
+
+// importsC returns true if the Go file at path imports "C".
+func importsC(path string) bool {
+	f, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.ImportsOnly)
+	if err != nil {
+		return false
+	}
+	for _, imp := range f.Imports {
+		if imp.Path.Value == `"C"` {
+			return true
+		}
+	}
+	return false
+}
+
+// addUnreadable records the Go files in dir that can't be read, or dir itself
+// if it can't be listed, and returns true if there are any. Files removed
+// while the run is looking at them, sockets and other files that aren't
+// regular, and files without read permission are all unreadable.
+func (l *skipLog) addUnreadable(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		l.add(skipUnreadable, fmt.Sprintf("%s: %s", relPath(dir), unwrapPathError(err)))
+		return true
+	}
+	found := false
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".go") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if err := readable(path); err != nil {
+			l.add(skipUnreadable, fmt.Sprintf("%s: %s", relPath(path), err))
+			found = true
+		}
+	}
+	return found
+}
+
+// readable returns why the regular file at path can't be read, or nil if it
+// can.
+func readable(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return unwrapPathError(err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("not a regular file")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return unwrapPathError(err)
+	}
+	return f.Close()
+}
+
+// unwrapPathError returns the error underneath an *os.PathError, whose path is
+// already given next to it.
+func unwrapPathError(err error) error {
+	if pe, ok := err.(*os.PathError); ok {
+		return pe.Err
+	}
+	return err
+}
+
+// isGeneratedFile returns true if the Go file at path has the standard
+// "// Code generated ... DO NOT EDIT." comment before its package clause.
+func isGeneratedFile(path string) bool {
+	f, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.PackageClauseOnly|parser.ParseComments)
+	if err != nil {
+		return false
+	}
+	return ast.IsGenerated(f)
+}
+
+// positionOf describes where node is for a list of skipped entities.
+func positionOf(fset *token.FileSet, node ast.Node, name string) string {
+	position := fset.Position(node.Pos())
+	return fmt.Sprintf("%s:%d: %s", relPath(position.Filename), position.Line, name)
+}
+
+// siteEntity describes site for a list of skipped entities.
+func siteEntity(site copySite, fset *token.FileSet) string {
+	position := fset.Position(site.pos)
+	return fmt.Sprintf("%s:%d: %s", relPath(position.Filename), position.Line, site.message(siteLabels{}))
+}
+
+// write writes how many entities were skipped for each reason and, if list is
+// true, the entities themselves.
+func (l *skipLog) write(w io.Writer, list bool) error {
+	reasons := make([]string, 0, len(l.entities))
+	for reason := range l.entities {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	if _, err := fmt.Fprintf(w, "skipped:\n"); err != nil {
+		return err
+	}
+	if len(reasons) == 0 {
+		_, err := fmt.Fprintf(w, "  nothing\n")
+		return err
+	}
+	for _, reason := range reasons {
+		entities := l.entities[reason]
+		if _, err := fmt.Fprintf(w, "  %d %s\n", len(entities), reason); err != nil {
+			return err
+		}
+		if !list {
+			continue
+		}
+		sort.Strings(entities)
+		for _, entity := range entities {
+			if _, err := fmt.Fprintf(w, "    %s\n", entity); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package copyfighter
+
+import (
+	"bytes"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSkipLogWrite(t *testing.T) {
+	skips := newSkipLog()
+	skips.add(skipOtherShard, "b/c")
+	skips.add(skipCgoFile, "a/x.go")
+	skips.add(skipOtherShard, "a/b")
+
+	b := &bytes.Buffer{}
+	if err := skips.write(b, false); err != nil {
+		t.Fatal(err)
+	}
+	want := "skipped:\n  1 cgo files\n  2 packages in other shards\n"
+	if b.String() != want {
+		t.Errorf("counts = %q, want %q", b.String(), want)
+	}
+
+	b.Reset()
+	if err := skips.write(b, true); err != nil {
+		t.Fatal(err)
+	}
+	want = "skipped:\n  1 cgo files\n    a/x.go\n  2 packages in other shards\n    a/b\n    b/c\n"
+	if b.String() != want {
+		t.Errorf("list = %q, want %q", b.String(), want)
+	}
+
+	var none *skipLog
+	none.add(skipCgoFile, "ignored.go")
+}
+
+func TestCheckSkipsUnreadable(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, src string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	const src = `package p
+
+type big struct{ a, b, c int64 }
+
+func F(b big) {}
+`
+	write("go.mod", "module example.com/m\n\ngo 1.22\n")
+	write("ok/ok.go", src)
+	write("broken/broken.go", src)
+	if err := os.Symlink(filepath.Join(dir, "missing.go"), filepath.Join(dir, "broken", "gone.go")); err != nil {
+		t.Skip(err)
+	}
+	t.Chdir(dir)
+
+	skips := newSkipLog()
+	fset := token.NewFileSet()
+	sites, err := check([]string{"./..."}, fset, limits{max: 16}, &types.StdSizes{WordSize: 8, MaxAlign: 8}, shard{}, nil, skips)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sites) != 1 || relPath(fset.Position(sites[0].pos).Filename) != "ok/ok.go" {
+		t.Errorf("found %d sites, want the one in ok/ok.go", len(sites))
+	}
+	if got := skips.entities[skipUnreadable]; len(got) != 1 || !strings.HasPrefix(got[0], "broken/gone.go: ") {
+		t.Errorf("skipped %v as unreadable, want broken/gone.go", got)
+	}
+	if got := skips.entities[skipUnreadablePkg]; len(got) != 1 || got[0] != "example.com/m/broken" {
+		t.Errorf("skipped %v as packages with unreadable files, want example.com/m/broken", got)
+	}
+}
+
+func TestSkipGenerated(t *testing.T) {
+	dir := t.TempDir()
+	gen := filepath.Join(dir, "api.pb.go")
+	src := filepath.Join(dir, "api.go")
+	if err := os.WriteFile(gen, []byte("// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage api\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(src, []byte("// Code for the API. DO NOT EDIT lightly.\n\npackage api\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	sites := []copySite{
+		{check: checkSelect, pos: fset.AddFile(gen, -1, 10).Pos(2)},
+		{check: checkSelect, pos: fset.AddFile(src, -1, 10).Pos(2)},
+	}
+	f := siteFilter{generated: make(map[string]bool)}
+	skips := newSkipLog()
+	if kept := f.apply(sites, fset, skips); len(kept) != 1 || kept[0].pos != sites[1].pos {
+		t.Errorf("kept %v, want the site in api.go", kept)
+	}
+	if n := len(skips.entities[skipGenerated]); n != 1 {
+		t.Errorf("skipped %d sites as generated, want 1", n)
+	}
+
+	*includeGenerated = true
+	defer func() { *includeGenerated = false }()
+	if kept := f.apply(sites, fset, nil); len(kept) != 2 {
+		t.Errorf("kept %d sites with -include-generated, want 2", len(kept))
+	}
+}
@@ -45,3 +45,243 @@ func (o *other) OnPtr2() {
 func (o *other) OnPtr3() {
 
 }
+
+func selects(in chan other, out chan other, done chan struct{}) {
+	for {
+		select {
+		case o := <-in:
+			out <- o
+		case out <- other{}:
+		case <-in:
+		case <-done:
+			return
+		}
+	}
+}
+
+func aggregates(bs [4]bar, pair [2]bar, s struct{ items [3]bar }) {
+
+}
+
+type group struct{}
+
+func (g *group) Go(f func() error) {}
+
+func submits(g *group, os []other) {
+	for _, o := range os {
+		g.Go(func() error {
+			o.OnPtr()
+			return nil
+		})
+		go func() {
+			o.OnPtr()
+		}()
+	}
+	for i := range os {
+		g.Go(func() error {
+			os[i].OnPtr()
+			return nil
+		})
+	}
+}
+
+type request struct {
+	cfg  other
+	name string
+}
+
+func literals(cfg other) []request {
+	return []request{
+		{cfg: cfg, name: "copied"},
+		{other{}, "built in place"},
+		{cfg, "positional"},
+	}
+}
+
+type session struct {
+	other
+	id int
+}
+
+func derefs(o *other, keep *other) {
+	v := *o
+	w := *keep
+	keep.OnPtr()
+	v.OnPtr()
+	w.OnPtr()
+}
+
+func (o *other) OnPtrCopy() {
+	var v = *o
+	v.OnPtr()
+}
+
+type onStructer interface {
+	OnStruct()
+}
+
+func boxes(o other) {
+	var s onStructer = o
+	s.OnStruct()
+	t := onStructer(o)
+	t.OnStruct()
+	var u onStructer = &o
+	u.OnStruct()
+	var unused onStructer = o
+	_ = unused
+}
+
+type pair[T any] struct {
+	a, b T
+}
+
+func process[T any](t T) T {
+	return t
+}
+
+func first[T any](ts []T) T {
+	return ts[0]
+}
+
+func generics() {
+	process(other{})
+	process[Foo](Foo{})
+	process(1)
+	first([]other{{}})
+	_ = pair[int]{}
+}
+
+func mapWrites(m map[string]Foo, p map[string]*Foo, f Foo) {
+	m["a"] = f
+	v := m["a"]
+	v.Timeout = 1
+	(m)["a"], p["b"] = v, &f
+	p["c"] = &f
+	_ = map[string]Foo{"d": f}
+}
+
+type consumer interface {
+	Consume(o other)
+}
+
+type sink struct{}
+
+func (s *sink) Consume(o other) {}
+
+var _ consumer = &sink{}
+
+func namedResults(f Foo, ok bool) (out Foo, err error) {
+	if ok {
+		out = f
+		return
+	}
+	out = Foo{}
+	return out, nil
+}
+
+func ranges(os []other, ptrs []*other, m map[string]other, c chan other, arr *[2]other) (n int64) {
+	for _, o := range os {
+		n += o.quux
+	}
+	for i := range os {
+		n += os[i].quux
+	}
+	for _, o := range ptrs {
+		n += o.quux
+	}
+	for k, o := range m {
+		n += int64(len(k)) + o.quux
+	}
+	for o := range c {
+		n += o.quux
+	}
+	var last other
+	for _, last = range arr {
+	}
+	return n + last.quux
+}
+
+func assigns(o other, p *other, os []other, box any) int64 {
+	x := o
+	x = *p
+	var y = os[0]
+	z, ok := box.(other)
+	_ = o
+	w := other{quux: o.quux}
+	if ok {
+		w = z
+	}
+	return x.quux + y.quux + w.quux
+}
+
+func dynamicTypes(o other, c chan any) []any {
+	var box any = o
+	alias := box
+	small := any(1)
+	held := []any{}
+	held = append(held, alias, small)
+	c <- box
+	go keep(alias)
+	go func() {
+		keep(box)
+	}()
+	return held
+}
+
+func keep(v any) {
+	_ = []any{v}
+}
+
+func calls(f *Foo, o *other, apply func(other)) {
+	CallsFoo(*f)
+	f.OnOtherToo(*o)
+	apply(*o)
+	apply(other{})
+	o.OnStruct()
+}
+
+func boxings(p *other, c chan any, log func(args ...any)) any {
+	log("other", *p)
+	held := []any{*p, p}
+	c <- *p
+	_ = map[any]bool{*p: true}
+	_ = held
+	return *p
+}
+
+var queue = make(chan other, 8)
+
+func chans(o *other) {
+	queue <- *o
+	ptrs := make(chan *other, 1)
+	ptrs <- o
+}
+
+type block [8]int64
+
+func (b block) sum() (n int64) {
+	for _, v := range b {
+		n += v
+	}
+	return n
+}
+
+func digest(data []byte) [32]byte {
+	return [32]byte{}
+}
+
+type otherAlias = other
+
+type pairAlias = struct{ a, b other }
+
+func aliases(o otherAlias, p pairAlias) {
+}
+
+func localArrays(b *block, rows [][4]int64) (n int64) {
+	c := *b
+	var d = c
+	for _, row := range rows {
+		n += row[0]
+	}
+	return c[0] + d[0] + n
+}
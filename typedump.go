@@ -0,0 +1,212 @@
+package copyfighter
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"go/types"
+	"io"
+	"sort"
+)
+
+// exportedType is the layout of a named type as export-types writes it.
+// Types are named by their full import paths.
+type exportedType struct {
+	Package  string `json:"package"`
+	Name     string `json:"name"`
+	Position string `json:"position"`
+	// Kind is the kind of the underlying type, like "struct" or "array".
+	Kind       string `json:"kind"`
+	Underlying string `json:"underlying"`
+	Size       int64  `json:"size"`
+	Align      int64  `json:"align"`
+	// Padding is the number of bytes of a struct that no field uses.
+	Padding int64           `json:"padding"`
+	Fields  []exportedField `json:"fields,omitempty"`
+	// References are the other named types the underlying type is made of.
+	References []string `json:"references"`
+}
+
+// exportedField is a field of an exportedType.
+type exportedField struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Offset   int64  `json:"offset"`
+	Size     int64  `json:"size"`
+	Align    int64  `json:"align"`
+	Embedded bool   `json:"embedded,omitempty"`
+	Tag      string `json:"tag,omitempty"`
+}
+
+// exportTypes returns the layouts of the package-level named types of the
+// packages matched by patterns, sorted by package and name. Generic types have
+// no layout and are recorded in skips, as are the packages of other shards.
+func exportTypes(patterns []string, sizes types.Sizes, sh shard, skips *skipLog) ([]exportedType, error) {
+	fset := token.NewFileSet()
+	pkgs, err := loadPackages(patterns, fset, sh, false, skips, nil, *excludePatterns)
+	if err != nil {
+		return nil, err
+	}
+	out := []exportedType{}
+	for _, pkg := range pkgs {
+		if len(pkg.Errors) > 0 {
+			return nil, fmt.Errorf("unable to type check package %#v: %s", pkg.PkgPath, pkg.Errors[0])
+		}
+		scope := pkg.Types.Scope()
+		for _, name := range scope.Names() {
+			tn, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok || tn.IsAlias() {
+				continue
+			}
+			if isGeneric(tn.Type()) {
+				position := fset.Position(tn.Pos())
+				skips.add(skipGenericType, fmt.Sprintf("%s:%d: %s", relPath(position.Filename), position.Line, name))
+				continue
+			}
+			out = append(out, layoutOf(tn, fset, sizes))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Package != out[j].Package {
+			return out[i].Package < out[j].Package
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out, nil
+}
+
+// layoutOf returns the layout of the named type tn.
+func layoutOf(tn *types.TypeName, fset *token.FileSet, sizes types.Sizes) exportedType {
+	position := fset.Position(tn.Pos())
+	u := tn.Type().Underlying()
+	t := exportedType{
+		Package:    tn.Pkg().Path(),
+		Name:       tn.Name(),
+		Position:   fmt.Sprintf("%s:%d", relPath(position.Filename), position.Line),
+		Kind:       kindOf(u),
+		Underlying: types.TypeString(u, nil),
+		Size:       sizes.Sizeof(tn.Type()),
+		Align:      sizes.Alignof(tn.Type()),
+		References: []string{},
+	}
+	if st, ok := u.(*types.Struct); ok {
+		vars := make([]*types.Var, st.NumFields())
+		for i := range vars {
+			vars[i] = st.Field(i)
+		}
+		offsets := sizes.Offsetsof(vars)
+		used := int64(0)
+		for i, f := range vars {
+			size := sizes.Sizeof(f.Type())
+			used += size
+			t.Fields = append(t.Fields, exportedField{
+				Name:     f.Name(),
+				Type:     types.TypeString(f.Type(), nil),
+				Offset:   offsets[i],
+				Size:     size,
+				Align:    sizes.Alignof(f.Type()),
+				Embedded: f.Embedded(),
+				Tag:      st.Tag(i),
+			})
+		}
+		t.Padding = t.Size - used
+	}
+	seen := map[*types.TypeName]bool{tn: true}
+	namedIn(u, seen, func(ref *types.TypeName) {
+		t.References = append(t.References, types.TypeString(ref.Type(), nil))
+	})
+	sort.Strings(t.References)
+	return t
+}
+
+// kindOf returns the kind of the underlying type u.
+func kindOf(u types.Type) string {
+	switch u.(type) {
+	case *types.Basic:
+		return "basic"
+	case *types.Struct:
+		return "struct"
+	case *types.Array:
+		return "array"
+	case *types.Slice:
+		return "slice"
+	case *types.Pointer:
+		return "pointer"
+	case *types.Map:
+		return "map"
+	case *types.Chan:
+		return "chan"
+	case *types.Signature:
+		return "func"
+	case *types.Interface:
+		return "interface"
+	}
+	return "other"
+}
+
+// namedIn calls fn once for every named type that t is made of and isn't in
+// seen, without looking into the named types themselves.
+func namedIn(t types.Type, seen map[*types.TypeName]bool, fn func(*types.TypeName)) {
+	switch t := t.(type) {
+	case *types.Named:
+		if obj := t.Origin().Obj(); !seen[obj] {
+			seen[obj] = true
+			fn(obj)
+		}
+		for i := 0; i < t.TypeArgs().Len(); i++ {
+			namedIn(t.TypeArgs().At(i), seen, fn)
+		}
+	case *types.Alias:
+		namedIn(types.Unalias(t), seen, fn)
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			namedIn(t.Field(i).Type(), seen, fn)
+		}
+	case *types.Array:
+		namedIn(t.Elem(), seen, fn)
+	case *types.Slice:
+		namedIn(t.Elem(), seen, fn)
+	case *types.Pointer:
+		namedIn(t.Elem(), seen, fn)
+	case *types.Chan:
+		namedIn(t.Elem(), seen, fn)
+	case *types.Map:
+		namedIn(t.Key(), seen, fn)
+		namedIn(t.Elem(), seen, fn)
+	case *types.Signature:
+		for _, tuple := range []*types.Tuple{t.Params(), t.Results()} {
+			for i := 0; i < tuple.Len(); i++ {
+				namedIn(tuple.At(i).Type(), seen, fn)
+			}
+		}
+	case *types.Interface:
+		for i := 0; i < t.NumMethods(); i++ {
+			namedIn(t.Method(i).Type(), seen, fn)
+		}
+	}
+}
+
+// writeExportedTypes writes the layouts in format, either "json" for a JSON
+// array of them, or "text" for a listing of each type with the offsets and
+// sizes of its fields.
+func writeExportedTypes(w io.Writer, layouts []exportedType, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(layouts)
+	case "text":
+		for _, t := range layouts {
+			if _, err := fmt.Fprintf(w, "%s.%s: %s, %d bytes, align %d\n", t.Package, t.Name, t.Kind, t.Size, t.Align); err != nil {
+				return err
+			}
+			for _, f := range t.Fields {
+				if _, err := fmt.Fprintf(w, "  %6d %6d  %s %s\n", f.Offset, f.Size, f.Name, f.Type); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("export-types can't write format %#v, must be json or text", format)
+}
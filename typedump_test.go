@@ -0,0 +1,48 @@
+package copyfighter
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"reflect"
+	"testing"
+)
+
+func TestLayoutOf(t *testing.T) {
+	const src = `package p
+
+import "time"
+
+type padded struct {
+	ok   bool
+	when time.Time
+	next *padded
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sizes := &types.StdSizes{WordSize: 8, MaxAlign: 8}
+	pkg, err := (&types.Config{Sizes: sizes, Importer: importer.ForCompiler(fset, "source", nil)}).Check("p", fset, []*ast.File{file}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := layoutOf(pkg.Scope().Lookup("padded").(*types.TypeName), fset, sizes)
+	if got.Kind != "struct" || got.Size != 40 || got.Align != 8 || got.Padding != 7 {
+		t.Errorf("layout = %s, %d bytes, align %d, padding %d, want struct, 40 bytes, align 8, padding 7", got.Kind, got.Size, got.Align, got.Padding)
+	}
+	offsets := []int64{}
+	for _, f := range got.Fields {
+		offsets = append(offsets, f.Offset)
+	}
+	if want := []int64{0, 8, 32}; !reflect.DeepEqual(offsets, want) {
+		t.Errorf("field offsets = %v, want %v", offsets, want)
+	}
+	if want := []string{"time.Time"}; !reflect.DeepEqual(got.References, want) {
+		t.Errorf("references = %v, want %v", got.References, want)
+	}
+}
@@ -0,0 +1,83 @@
+package copyfighter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// uploadSARIF implements the upload-sarif subcommand, which sends a SARIF
+// file to the GitHub code scanning API for a commit.
+func uploadSARIF(args []string) error {
+	fs := flag.NewFlagSet("upload-sarif", flag.ContinueOnError)
+	repo := fs.String("repo", os.Getenv("GITHUB_REPOSITORY"), "repository to upload to, as OWNER/NAME")
+	sha := fs.String("sha", os.Getenv("GITHUB_SHA"), "full SHA of the commit that was analyzed")
+	ref := fs.String("ref", os.Getenv("GITHUB_REF"), "git ref that was analyzed, e.g. refs/heads/main")
+	token := fs.String("token", os.Getenv("GITHUB_TOKEN"), "GitHub token with the security_events scope")
+	apiURL := fs.String("api-url", "https://api.github.com", "base URL of the GitHub API")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: %s upload-sarif [flags] SARIF_FILE", os.Args[0])
+	}
+	for name, v := range map[string]string{"repo": *repo, "sha": *sha, "ref": *ref, "token": *token} {
+		if v == "" {
+			return fmt.Errorf("upload-sarif: -%s is required", name)
+		}
+	}
+	sarif, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("unable to read SARIF file: %s", err)
+	}
+	return postSARIF(http.DefaultClient, *apiURL, *repo, *sha, *ref, *token, sarif)
+}
+
+// postSARIF uploads sarif to the code scanning API at apiURL. The API expects
+// the file gzipped and base64 encoded.
+func postSARIF(client *http.Client, apiURL, repo, sha, ref, token string, sarif []byte) error {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	if _, err := zw.Write(sarif); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	body, err := json.Marshal(struct {
+		CommitSHA string `json:"commit_sha"`
+		Ref       string `json:"ref"`
+		SARIF     string `json:"sarif"`
+		ToolName  string `json:"tool_name"`
+	}{sha, ref, base64.StdEncoding.EncodeToString(gz.Bytes()), "copyfighter"})
+	if err != nil {
+		return err
+	}
+
+	url := strings.TrimSuffix(apiURL, "/") + "/repos/" + repo + "/code-scanning/sarifs"
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to upload SARIF: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("unable to upload SARIF: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package copyfighter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPostSARIF(t *testing.T) {
+	const sarif = `{"version":"2.1.0","runs":[]}`
+	var got struct {
+		CommitSHA string `json:"commit_sha"`
+		Ref       string `json:"ref"`
+		SARIF     string `json:"sarif"`
+	}
+	var path, auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		auth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("unable to decode request: %s", err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	err := postSARIF(srv.Client(), srv.URL, "o/r", "abc123", "refs/heads/main", "tok", []byte(sarif))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if path != "/repos/o/r/code-scanning/sarifs" {
+		t.Errorf("posted to %#v", path)
+	}
+	if auth != "Bearer tok" {
+		t.Errorf("Authorization header is %#v", auth)
+	}
+	if got.CommitSHA != "abc123" || got.Ref != "refs/heads/main" {
+		t.Errorf("got commit_sha %#v and ref %#v", got.CommitSHA, got.Ref)
+	}
+	gz, err := base64.StdEncoding.DecodeString(got.SARIF)
+	if err != nil {
+		t.Fatalf("sarif isn't base64: %s", err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(gz))
+	if err != nil {
+		t.Fatalf("sarif isn't gzipped: %s", err)
+	}
+	b, _ := io.ReadAll(zr)
+	if string(b) != sarif {
+		t.Errorf("uploaded %#v, want %#v", string(b), sarif)
+	}
+}
+
+func TestPostSARIFError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad credentials", http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	err := postSARIF(srv.Client(), srv.URL, "o/r", "abc123", "refs/heads/main", "tok", []byte("{}"))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}